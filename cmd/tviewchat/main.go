@@ -2,44 +2,132 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/MelleKoning/ai-chat/internal/config"
+	"github.com/MelleKoning/ai-chat/internal/diffsource"
 	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+	"github.com/MelleKoning/ai-chat/internal/mcp"
 	"github.com/MelleKoning/ai-chat/internal/terminal"
+	"github.com/MelleKoning/ai-chat/internal/tools"
 	"github.com/MelleKoning/ai-chat/internal/tviewview"
 )
 
+// mcpStartTimeout limits the start and the tool listing of an MCP server
+const mcpStartTimeout = 30 * time.Second
+
 func main() {
+	// the review subcommand runs without the console, like in CI
+	if len(os.Args) > 1 && os.Args[1] == "review" {
+		os.Exit(runReview(os.Args[2:]))
+	}
+
 	mdRenderer, err := terminal.New()
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	systemPrompt := `Be a supportive technical assistant.`
+	// the flags default to the values of the config file
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Error reading config file: ", err)
+	}
+	backend := flag.String("backend", cfg.Backend, "backend to chat with: gemini, openai, ollama or anthropic")
+	baseURL := flag.String("base-url", cfg.BaseURL, "base url of an OpenAI compatible server or Ollama daemon, like http://localhost:8080/v1")
+	model := flag.String("model", cfg.Model, "model to start the chat with, can be changed with \"Select model\"")
+	contextBudget := flag.Int("context-budget", cfg.ContextBudget, "maximum tokens of history send with each request, 0 for no limit")
+	summarizeAfter := flag.Int("summarize-after", cfg.SummarizeAfter, "summarize older turns when the history passes this many tokens, 0 to disable")
+	maxRetries := flag.Int("max-retries", cfg.MaxRetries, "retries of a request that failed with a transient error, 0 for the default of 3, -1 to disable")
+	useTools := flag.Bool("tools", cfg.Tools, "let the model read files, grep and run git diff and git log in the working directory")
+	writeTools := flag.Bool("write-tools", cfg.WriteTools, "also let the model write files in the working directory, after your approval")
+	reviewSource := flag.String("review-source", cfg.ReviewSource, "diff to review: a file (default gitdiff.txt), - for standard input, or git:staged, git:worktree, git:branch or a range like git:main..feature")
+	reviewBatchTokens := flag.Int("review-batch-tokens", cfg.ReviewBatchTokens, "tokens of each batch of a chunked review, 0 for the default of 20000")
+	reviewWorkers := flag.Int("review-workers", cfg.ReviewWorkers, "batches of a chunked review that are reviewed at once, 0 for the default of 4")
+	autoContinue := flag.Bool("auto-continue", cfg.AutoContinue, "continue answers that are cut off at the maximum output tokens without asking")
+	requestTimeout := flag.Duration("request-timeout", time.Duration(cfg.RequestTimeout), "timeout of each request to the backend, like 2m, 0 for no timeout")
+	generation := genaimodel.GenerationConfig{
+		Temperature:     cfg.Temperature,
+		TopP:            cfg.TopP,
+		TopK:            cfg.TopK,
+		MaxOutputTokens: cfg.MaxOutputTokens,
+		Seed:            cfg.Seed,
+		StopSequences:   cfg.StopSequences,
+		ThinkingBudget:  cfg.ThinkingBudget,
+	}
+	generationFlags(flag.CommandLine, &generation)
+	flag.Parse()
+	if err := generation.Validate(); err != nil {
+		log.Fatal("Invalid generation parameters: ", err)
+	}
 
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		log.Fatal("Error: GEMINI_API_KEY environment variable not set. Please set it before running.")
+	source, err := loadReviewSource(*reviewSource)
+	if err != nil {
+		log.Fatal("Invalid review source: ", err)
 	}
 
+	systemPrompt := `Be a supportive technical assistant.`
+
 	ctx := context.Background()
-	genaiClient, err := genaimodel.NewGeminiClient(ctx, apiKey)
+	provider, err := newProvider(ctx, *backend, *baseURL, *model)
 	if err != nil {
-		log.Fatal("Error creating Gemini client: ", err)
+		log.Fatal("Error creating backend: ", err)
 	}
-	modelAction, err := genaimodel.NewModel(ctx, genaiClient, systemPrompt)
+	modelAction, err := genaimodel.NewModel(ctx, provider, systemPrompt)
 	if err != nil {
 		log.Fatal("Error creating AI model: ", err)
 	}
+	if *model != "" {
+		modelAction.SetModel(*model)
+	}
+	modelAction.SetTokenBudget(genaimodel.TokenBudget{
+		Default: *contextBudget,
+		Models:  cfg.ModelContextBudgets,
+	})
+	modelAction.SetCompaction(genaimodel.Compaction{
+		Threshold: *summarizeAfter,
+		KeepTurns: cfg.SummarizeKeepTurns,
+	})
+	modelAction.SetKeepCancelled(!cfg.DiscardCancelled)
+	modelAction.SetRetryPolicy(genaimodel.RetryPolicy{
+		MaxRetries:     *maxRetries,
+		InitialDelay:   time.Duration(cfg.RetryDelay),
+		MaxDelay:       time.Duration(cfg.MaxRetryDelay),
+		RequestTimeout: *requestTimeout,
+	})
+	modelAction.SetGeneration(generation)
+	modelAction.SetContinuation(genaimodel.Continuation{
+		Auto: *autoContinue,
+		Max:  cfg.MaxContinuations,
+	})
+	var registry *genaimodel.ToolRegistry
+	if *useTools || *writeTools || len(cfg.MCPServers) > 0 {
+		registry, err = newToolRegistry(*useTools || *writeTools, *writeTools)
+		if err != nil {
+			log.Fatal("Error creating the tools: ", err)
+		}
+		modelAction.SetTools(registry)
+	}
 	// Create the console view
 	tviewApp := tviewview.New(mdRenderer, modelAction)
+	tviewApp.SetReviewSource(source)
+	tviewApp.SetChunking(*reviewBatchTokens, *reviewWorkers)
 
 	// We want to have a default log
 	closeFile := OpenTheLog()
 	defer closeFile()
+	// the mcp servers are started after the log is opened, they log to it
+	closeServers := startMCPServers(ctx, cfg.MCPServers, registry)
+	defer closeServers()
 	// Run the application
 	if err := tviewApp.Run(); err != nil {
 		log.Fatal(err)
@@ -48,6 +136,176 @@ func main() {
 	fmt.Println(tviewApp.Output())
 }
 
+// generationFlags defines the flags of the generation parameters,
+// a flag that is given overrides the value of the config file
+func generationFlags(flags *flag.FlagSet, generation *genaimodel.GenerationConfig) {
+	flags.Func("temperature", "sampling temperature between 0 and 2, low for reviews, high for brainstorming", func(s string) error {
+		v, err := strconv.ParseFloat(s, 32)
+		temperature := float32(v)
+		generation.Temperature = &temperature
+		return err
+	})
+	flags.Func("top-p", "nucleus sampling probability between 0 and 1", func(s string) error {
+		v, err := strconv.ParseFloat(s, 32)
+		topP := float32(v)
+		generation.TopP = &topP
+		return err
+	})
+	flags.Func("top-k", "sample from the k most likely tokens", func(s string) error {
+		v, err := strconv.Atoi(s)
+		generation.TopK = &v
+		return err
+	})
+	flags.IntVar(&generation.MaxOutputTokens, "max-output-tokens", generation.MaxOutputTokens, "maximum tokens of an answer, 0 for the default of the backend")
+	flags.Func("seed", "seed for reproducible answers, when the backend supports it", func(s string) error {
+		v, err := strconv.Atoi(s)
+		generation.Seed = &v
+		return err
+	})
+	flags.Func("stop", "comma separated stop sequences", func(s string) error {
+		generation.StopSequences = strings.Split(s, ",")
+		return nil
+	})
+	flags.Func("thinking-budget", "tokens a thinking model can use before it answers, 0 to disable thinking, -1 to let the model decide", func(s string) error {
+		v, err := strconv.Atoi(s)
+		generation.ThinkingBudget = &v
+		return err
+	})
+}
+
+// loadReviewSource parses the review source, a diff on standard input
+// is read before the console takes over the terminal
+func loadReviewSource(spec string) (*diffsource.Source, error) {
+	source, err := diffsource.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	if source.Kind != diffsource.KindStdin {
+		return source, nil
+	}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		return nil, errors.New("standard input is a terminal, pipe the diff like: git diff | tviewchat -review-source -")
+	}
+	if _, err := source.Load(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// newToolRegistry returns the registry with the built-in tools for the
+// working directory, with write the tools that change files are added
+func newToolRegistry(builtin, write bool) (*genaimodel.ToolRegistry, error) {
+	if !builtin {
+		return genaimodel.NewToolRegistry()
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	readOnly, err := tools.Builtin(dir)
+	if err != nil {
+		return nil, err
+	}
+	if write {
+		writable, err := tools.Writable(dir)
+		if err != nil {
+			return nil, err
+		}
+		readOnly = append(readOnly, writable...)
+	}
+
+	return genaimodel.NewToolRegistry(readOnly...)
+}
+
+// startMCPServers starts the configured MCP servers and registers their
+// tools, a server that fails to start is logged and left out
+func startMCPServers(ctx context.Context, servers map[string]config.MCPServer, registry *genaimodel.ToolRegistry) func() {
+	var clients []*mcp.Client
+	for _, name := range slices.Sorted(maps.Keys(servers)) {
+		server := servers[name]
+		startCtx, cancel := context.WithTimeout(ctx, mcpStartTimeout)
+		client, err := mcp.Start(startCtx, mcp.ServerConfig{
+			Name:    name,
+			Command: server.Command,
+			Args:    server.Args,
+			Env:     server.Env,
+		})
+		if err != nil {
+			cancel()
+			log.Printf("Error starting MCP server %s: %v", name, err)
+			continue
+		}
+		clients = append(clients, client)
+		serverTools, err := client.Tools(startCtx)
+		cancel()
+		if err != nil {
+			log.Printf("Error listing the tools of MCP server %s: %v", name, err)
+			continue
+		}
+		for _, tool := range serverTools {
+			if err := registry.Register(tool); err != nil {
+				log.Printf("Skipping a tool of MCP server %s: %v", name, err)
+			}
+		}
+		log.Printf("MCP server %s offers %d tools", name, len(serverTools))
+	}
+
+	return func() {
+		for _, client := range clients {
+			if err := client.Close(); err != nil {
+				log.Printf("Error closing MCP server %s: %v", client.Name(), err)
+			}
+		}
+	}
+}
+
+// errNoModel is returned for a backend without a default model
+var errNoModel = errors.New("the openai backend has no default model, set -model or model in the config file")
+
+// newProvider creates the backend the chat runs against
+func newProvider(ctx context.Context, backend, baseURL, model string) (genaimodel.Provider, error) {
+	switch backend {
+	case "gemini":
+		apiKey := os.Getenv("GEMINI_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY environment variable not set. Please set it before running")
+		}
+		genaiClient, err := genaimodel.NewGeminiClient(ctx, apiKey)
+		if err != nil {
+			return nil, err
+		}
+		return genaimodel.NewGeminiProvider(genaiClient), nil
+	case "openai":
+		if model == "" {
+			return nil, errNoModel
+		}
+		// the api key is optional for local servers
+		return genaimodel.NewOpenAIProvider(genaimodel.OpenAIConfig{
+			BaseURL: baseURL,
+			APIKey:  os.Getenv("OPENAI_API_KEY"),
+			Model:   model,
+		}), nil
+	case "ollama":
+		return genaimodel.NewOllamaProvider(genaimodel.OllamaConfig{
+			BaseURL: baseURL,
+			Model:   model,
+		}), nil
+	case "anthropic":
+		apiKey := os.Getenv("ANTHROPIC_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable not set. Please set it before running")
+		}
+		return genaimodel.NewAnthropicProvider(genaimodel.AnthropicConfig{
+			BaseURL: baseURL,
+			APIKey:  apiKey,
+			Model:   model,
+		}), nil
+	}
+
+	return nil, fmt.Errorf("unknown backend %q", backend)
+}
+
 func OpenTheLog() func() {
 	// --- Logging Setup ---
 	logFile, err := os.OpenFile("tviewapp.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
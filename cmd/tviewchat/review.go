@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MelleKoning/ai-chat/internal/config"
+	"github.com/MelleKoning/ai-chat/internal/diff"
+	"github.com/MelleKoning/ai-chat/internal/diffsource"
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+	"github.com/MelleKoning/ai-chat/internal/prompts"
+	"github.com/MelleKoning/ai-chat/internal/report"
+)
+
+// runReview runs the review subcommand, it reviews the diff without the
+// console and returns the exit code of the most important finding:
+//
+//	tviewchat review -review-source git:branch -format sarif -output review.sarif
+func runReview(args []string) int {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading config file:", err)
+		return report.ExitFailed
+	}
+
+	flags := flag.NewFlagSet("review", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: tviewchat review [flags]\n\nReviews a diff without the console, the exit code is 0 without findings,\n"+
+			"1 when the review fails, 2 for invalid flags and 3, 4, 5 or 6 for an info, minor, major or critical finding.")
+		flags.PrintDefaults()
+	}
+	backend := flags.String("backend", cfg.Backend, "backend to review with: gemini, openai, ollama or anthropic")
+	baseURL := flags.String("base-url", cfg.BaseURL, "base url of an OpenAI compatible server or Ollama daemon")
+	model := flags.String("model", cfg.Model, "model to review with, empty for the default of the backend, the openai backend needs one")
+	reviewSource := flags.String("review-source", cfg.ReviewSource, "diff to review: a file (default gitdiff.txt), - for standard input, or git:staged, git:worktree, git:branch or a range like git:main..feature")
+	promptName := flags.String("prompt", strings.TrimSpace(prompts.PromptList[0].Name), "system prompt of the review, one of: "+promptNames())
+	formatName := flags.String("format", string(report.FormatMarkdown), "output format: markdown, json, sarif or comments, the inline review comments of a code host")
+	output := flags.String("output", "", "file to write the review to, empty or - for standard output")
+	failOn := flags.String("fail-on", string(genaimodel.SeverityInfo), "least severity that sets the exit code: critical, major, minor or info")
+	batchTokens := flags.Int("review-batch-tokens", cfg.ReviewBatchTokens, "tokens of each batch of the review, 0 for the default of 20000")
+	workers := flags.Int("review-workers", cfg.ReviewWorkers, "batches that are reviewed at once, 0 for the default of 4")
+	maxRetries := flags.Int("max-retries", cfg.MaxRetries, "retries of a request that failed with a transient error, 0 for the default of 3, -1 to disable")
+	requestTimeout := flags.Duration("request-timeout", time.Duration(cfg.RequestTimeout), "timeout of each request to the backend, like 2m, 0 for no timeout")
+	verbose := flags.Bool("verbose", false, "log the requests and the progress to standard error")
+	generation := genaimodel.GenerationConfig{
+		Temperature:     cfg.Temperature,
+		TopP:            cfg.TopP,
+		TopK:            cfg.TopK,
+		MaxOutputTokens: cfg.MaxOutputTokens,
+		Seed:            cfg.Seed,
+		StopSequences:   cfg.StopSequences,
+		ThinkingBudget:  cfg.ThinkingBudget,
+	}
+	generationFlags(flags, &generation)
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return report.ExitOK
+		}
+		return report.ExitUsage
+	}
+
+	usageError := func(err error) int {
+		fmt.Fprintln(os.Stderr, err)
+		return report.ExitUsage
+	}
+	format, err := report.ParseFormat(*formatName)
+	if err != nil {
+		return usageError(err)
+	}
+	threshold := genaimodel.Severity(strings.ToLower(*failOn))
+	if !slices.Contains(genaimodel.Severities, threshold) {
+		return usageError(fmt.Errorf("unknown severity %q, use critical, major, minor or info", *failOn))
+	}
+	prompt, ok := prompts.Find(*promptName)
+	if !ok {
+		return usageError(fmt.Errorf("unknown prompt %q, use one of: %s", *promptName, promptNames()))
+	}
+	if err := generation.Validate(); err != nil {
+		return usageError(fmt.Errorf("invalid generation parameters: %w", err))
+	}
+	source, err := loadReviewSource(*reviewSource)
+	if err != nil {
+		return usageError(fmt.Errorf("invalid review source: %w", err))
+	}
+
+	if *verbose {
+		log.SetOutput(os.Stderr)
+	} else {
+		log.SetOutput(io.Discard)
+	}
+	fail := func(err error) int {
+		fmt.Fprintln(os.Stderr, "Review failed:", err)
+		return report.ExitFailed
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	provider, err := newProvider(ctx, *backend, *baseURL, *model)
+	if errors.Is(err, errNoModel) {
+		return usageError(err)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	modelAction, err := genaimodel.NewModel(ctx, provider, prompt.Prompt)
+	if err != nil {
+		return fail(err)
+	}
+	if *model != "" {
+		modelAction.SetModel(*model)
+	}
+	modelAction.SetRetryPolicy(genaimodel.RetryPolicy{
+		MaxRetries:     *maxRetries,
+		InitialDelay:   time.Duration(cfg.RetryDelay),
+		MaxDelay:       time.Duration(cfg.MaxRetryDelay),
+		RequestTimeout: *requestTimeout,
+	})
+	modelAction.SetGeneration(generation)
+
+	name, files, err := source.Files(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	review, err := modelAction.ChunkedReview(ctx, diffsource.Batches(name, files, *batchTokens), *workers, func(done, total int) {
+		log.Printf("Reviewing file %d/%d", done, total)
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := writeReport(*output, format, review, files); err != nil {
+		return fail(err)
+	}
+	if format == report.FormatComments {
+		// the skipped findings still count for the exit code
+		if _, skipped := report.Comments(review, files); len(skipped) > 0 {
+			fmt.Fprintf(os.Stderr, "%d findings are not on a line of the diff and have no comment:\n", len(skipped))
+			for _, finding := range skipped {
+				fmt.Fprintf(os.Stderr, "  %s:%d: %s\n", finding.File, finding.StartLine, finding.Message)
+			}
+		}
+	}
+
+	return report.ExitCode(review, threshold)
+}
+
+// writeReport writes the review to the file, or to standard output
+func writeReport(output string, format report.Format, review genaimodel.Review, files []diff.File) error {
+	if output == "" || output == "-" {
+		return report.Write(os.Stdout, format, review, files)
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(file, format, review, files); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// promptNames lists the quoted names of the prompts, some names have a comma
+func promptNames() string {
+	var names []string
+	for _, name := range prompts.Names() {
+		names = append(names, fmt.Sprintf("%q", name))
+	}
+
+	return strings.Join(names, ", ")
+}
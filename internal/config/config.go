@@ -0,0 +1,138 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Config contains the settings that are read from
+// the config file, command line flags take precedence
+type Config struct {
+	// Backend is gemini, openai, ollama or anthropic
+	Backend string `json:"backend,omitempty"`
+	BaseURL string `json:"baseUrl,omitempty"`
+	// Model is the model that is active when the chat starts
+	Model string `json:"model,omitempty"`
+	// ContextBudget is the maximum number of tokens that is
+	// send with each request, older turns are trimmed when
+	// the history grows beyond it. Zero means no limit.
+	ContextBudget int `json:"contextBudget,omitempty"`
+	// ModelContextBudgets overrides the ContextBudget per model
+	ModelContextBudgets map[string]int `json:"modelContextBudgets,omitempty"`
+	// SummarizeAfter is the number of tokens of history after which
+	// the older turns are replaced by a summary. Zero disables it.
+	SummarizeAfter int `json:"summarizeAfter,omitempty"`
+	// SummarizeKeepTurns is the number of recent turns that are not summarized
+	SummarizeKeepTurns int `json:"summarizeKeepTurns,omitempty"`
+	// DiscardCancelled leaves cancelled responses out of the chat history
+	DiscardCancelled bool `json:"discardCancelled,omitempty"`
+	// Tools lets the model read files and the git history of the
+	// working directory with the built-in read-only tools
+	Tools bool `json:"tools,omitempty"`
+	// WriteTools also lets the model write files, every
+	// write needs the approval of the user
+	WriteTools bool `json:"writeTools,omitempty"`
+	// MCPServers are the Model Context Protocol servers by name,
+	// their tools are offered to the model
+	MCPServers map[string]MCPServer `json:"mcpServers,omitempty"`
+	// ReviewSource is the diff that ReviewFile starts with, a file,
+	// "-" for standard input or a git range like "git:staged"
+	ReviewSource string `json:"reviewSource,omitempty"`
+	// ReviewBatchTokens is the size of a batch of a chunked review,
+	// zero for the default
+	ReviewBatchTokens int `json:"reviewBatchTokens,omitempty"`
+	// ReviewWorkers is the number of batches of a chunked review
+	// that are reviewed at once, zero for the default
+	ReviewWorkers int `json:"reviewWorkers,omitempty"`
+	// AutoContinue continues answers that are cut off at the
+	// maximum output tokens without asking
+	AutoContinue bool `json:"autoContinue,omitempty"`
+	// MaxContinuations limits the continuations of one answer
+	MaxContinuations int `json:"maxContinuations,omitempty"`
+	// MaxRetries is the number of retries of a request that failed
+	// with a transient error, zero for the default, -1 disables retries
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// RetryDelay is the wait before the first retry, like "1s"
+	RetryDelay Duration `json:"retryDelay,omitempty"`
+	// MaxRetryDelay caps the wait between retries, like "30s"
+	MaxRetryDelay Duration `json:"maxRetryDelay,omitempty"`
+	// RequestTimeout limits each request to the backend, like "2m"
+	RequestTimeout Duration `json:"requestTimeout,omitempty"`
+	// The generation parameters, unset parameters
+	// use the defaults of the backend
+	Temperature     *float32 `json:"temperature,omitempty"`
+	TopP            *float32 `json:"topP,omitempty"`
+	TopK            *int     `json:"topK,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	Seed            *int     `json:"seed,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+	// ThinkingBudget is the number of tokens a thinking model can
+	// use before it answers, 0 disables thinking, -1 lets the model decide
+	ThinkingBudget *int `json:"thinkingBudget,omitempty"`
+}
+
+// MCPServer is the command that starts an MCP server,
+// it speaks JSON-RPC over its stdin and stdout
+type MCPServer struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+// Duration is a time.Duration that is written as "1m30s" in the config file
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+
+	return nil
+}
+
+// Load reads the config file, usually ~/.config/ai-chat/config.json.
+// A missing config file results in the default Config.
+func Load() (Config, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return Config{}, err
+	}
+
+	return LoadFile(filepath.Join(configDir, "ai-chat", "config.json"))
+}
+
+// LoadFile reads the config from the given file
+func LoadFile(filename string) (Config, error) {
+	cfg := Config{
+		Backend: "gemini",
+	}
+
+	jsonData, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	err = json.Unmarshal(jsonData, &cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
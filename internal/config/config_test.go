@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+
+	cfg, err := LoadFile(filename)
+	if err != nil {
+		t.Fatalf("a missing config file should not fail: %v", err)
+	}
+	if cfg.Backend != "gemini" {
+		t.Errorf("expected the gemini backend by default, got %q", cfg.Backend)
+	}
+
+	err = os.WriteFile(filename, []byte(`{"backend":"ollama","model":"llama3.2"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = LoadFile(filename)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.Backend != "ollama" || cfg.Model != "llama3.2" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+func TestLoadFileDurations(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(filename, []byte(`{"maxRetries":5,"retryDelay":"500ms","requestTimeout":"2m"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFile(filename)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.MaxRetries != 5 || time.Duration(cfg.RetryDelay) != 500*time.Millisecond ||
+		time.Duration(cfg.RequestTimeout) != 2*time.Minute {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	err = os.WriteFile(filename, []byte(`{"requestTimeout":"soon"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(filename); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+}
+
+func TestLoadFileMCPServers(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(filename, []byte(`{"mcpServers":{"fs":{"command":"mcp-fs","args":["--root","."],"env":{"DEBUG":"1"}}}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFile(filename)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	server := cfg.MCPServers["fs"]
+	if server.Command != "mcp-fs" || len(server.Args) != 2 || server.Env["DEBUG"] != "1" {
+		t.Errorf("unexpected config %+v", cfg.MCPServers)
+	}
+}
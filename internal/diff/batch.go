@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"path"
+	"strings"
+)
+
+// charsPerToken is the rule of thumb for code
+const charsPerToken = 4
+
+// Filter leaves out the files that match one of the globs and the
+// generated files. A glob matches the whole path, "**" matches any
+// number of directories, like "vendor/**" or "**/*.pb.go".
+func Filter(files []File, excludes []string) []File {
+	var kept []File
+	for _, file := range files {
+		if file.Generated() || matchAny(excludes, file.Path()) {
+			continue
+		}
+		kept = append(kept, file)
+	}
+
+	return kept
+}
+
+func matchAny(globs []string, name string) bool {
+	for _, glob := range globs {
+		if Match(glob, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match reports whether the slash separated path matches the glob,
+// "**" matches zero or more directories, the other parts of the
+// glob follow path.Match
+func Match(glob, name string) bool {
+	return matchParts(strings.Split(glob, "/"), strings.Split(name, "/"))
+}
+
+func matchParts(glob, name []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchParts(glob[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(glob[0], name[0]); err != nil || !ok {
+			return false
+		}
+		glob, name = glob[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// EstimateTokens estimates the tokens of the diff of the file
+func (f File) EstimateTokens() int {
+	return estimateTokens(f.String())
+}
+
+func estimateTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+// Batches splits the files into batches of at most maxTokens. The files
+// keep their order, a file that does not fit in a batch of its own is
+// split between its hunks. A single hunk is never split, it can make a
+// batch larger than maxTokens.
+func Batches(files []File, maxTokens int) [][]File {
+	var batches [][]File
+	var batch []File
+	tokens := 0
+	add := func(file File) {
+		fileTokens := file.EstimateTokens()
+		if len(batch) > 0 && tokens+fileTokens > maxTokens {
+			batches = append(batches, batch)
+			batch, tokens = nil, 0
+		}
+		batch = append(batch, file)
+		tokens += fileTokens
+	}
+	for _, file := range files {
+		if file.EstimateTokens() <= maxTokens {
+			add(file)
+			continue
+		}
+		for _, part := range splitHunks(file, maxTokens) {
+			add(part)
+		}
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// splitHunks splits a large file into parts of at most maxTokens
+// with the hunks of the file, each part repeats the header
+func splitHunks(file File, maxTokens int) []File {
+	header := File{OldPath: file.OldPath, NewPath: file.NewPath, Header: file.Header, Binary: file.Binary}
+	headerTokens := header.EstimateTokens()
+	var parts []File
+	part, tokens := header, headerTokens
+	for _, hunk := range file.Hunks {
+		hunkTokens := estimateTokens(hunk.String())
+		if len(part.Hunks) > 0 && tokens+hunkTokens > maxTokens {
+			parts = append(parts, part)
+			part, tokens = header, headerTokens
+		}
+		part.Hunks = append(part.Hunks, hunk)
+		tokens += hunkTokens
+	}
+
+	return append(parts, part)
+}
+
+// Paths returns the paths of the files, a file that
+// is split between batches is listed once
+func Paths(files []File) []string {
+	var paths []string
+	for i, file := range files {
+		if i > 0 && files[i-1].Path() == file.Path() {
+			continue
+		}
+		paths = append(paths, file.Path())
+	}
+
+	return paths
+}
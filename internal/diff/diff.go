@@ -0,0 +1,293 @@
+// Package diff parses unified diffs, like the output of git diff, into
+// files and hunks. The files can be filtered by glob and split into
+// batches that each fit in the context of a model.
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LineKind is the prefix of a line in a hunk
+type LineKind byte
+
+const (
+	Context LineKind = ' '
+	Added   LineKind = '+'
+	Removed LineKind = '-'
+	// NoNewline is the "\ No newline at end of file" marker
+	NoNewline LineKind = '\\'
+)
+
+// Line is a line of a hunk, the line numbers are
+// zero when the line is not in that version
+type Line struct {
+	Kind    LineKind
+	Text    string
+	OldLine int
+	NewLine int
+}
+
+// Hunk is a range of changed lines with their context
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	// Section is the text after the range, like the enclosing function
+	Section string
+	Lines   []Line
+}
+
+// File is the diff of a single file
+type File struct {
+	// OldPath is empty for an added file, NewPath for a deleted file
+	OldPath string
+	NewPath string
+	// Header are the lines before the first hunk, like
+	// "diff --git", "index" and the "---" and "+++" lines
+	Header []string
+	Hunks  []Hunk
+	// Binary is true when git left out the changes of a binary file
+	Binary bool
+}
+
+// hunkHeader matches "@@ -1,5 +1,6 @@ func main() {"
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// generatedMarker is the comment of generated Go code, and of many
+// other generators, see https://go.dev/s/generatedcode
+var generatedMarker = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// Parse reads the files of a unified diff. Text before the first file,
+// like the message of a patch, is ignored.
+func Parse(r io.Reader) ([]File, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var files []File
+	var file *File
+	// the lines that are left in the current hunk
+	var oldLeft, newLeft int
+	var hunk *Hunk
+	for scanner.Scan() {
+		line := scanner.Text()
+		if hunk != nil && (oldLeft > 0 || newLeft > 0 || strings.HasPrefix(line, `\`)) {
+			if err := addLine(hunk, line, &oldLeft, &newLeft); err != nil {
+				return nil, fmt.Errorf("%s: %w", file.Path(), err)
+			}
+			continue
+		}
+		hunk = nil
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			files = append(files, File{Header: []string{line}})
+			file = &files[len(files)-1]
+			file.OldPath, file.NewPath = gitPaths(line)
+		case strings.HasPrefix(line, "--- ") && (file == nil || len(file.Hunks) > 0 || hasHeader(file, "--- ")):
+			// a diff without the "diff --git" lines
+			files = append(files, File{Header: []string{line}})
+			file = &files[len(files)-1]
+			file.OldPath = headerPath(line)
+		case file == nil:
+			// the message of a patch
+		case strings.HasPrefix(line, "--- ") && len(file.Hunks) == 0:
+			file.Header = append(file.Header, line)
+			file.OldPath = headerPath(line)
+		case strings.HasPrefix(line, "+++ ") && len(file.Hunks) == 0:
+			file.Header = append(file.Header, line)
+			file.NewPath = headerPath(line)
+		case strings.HasPrefix(line, "@@ "):
+			h, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file.Path(), err)
+			}
+			file.Hunks = append(file.Hunks, h)
+			hunk = &file.Hunks[len(file.Hunks)-1]
+			oldLeft, newLeft = h.OldLines, h.NewLines
+		case len(file.Hunks) == 0:
+			file.Header = append(file.Header, line)
+			if strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch" {
+				file.Binary = true
+			}
+			// binary files have no "---" and "+++" lines
+			if strings.HasPrefix(line, "new file mode ") {
+				file.OldPath = ""
+			}
+			if strings.HasPrefix(line, "deleted file mode ") {
+				file.NewPath = ""
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+		return nil, fmt.Errorf("%s: the last hunk is cut off", file.Path())
+	}
+
+	return files, nil
+}
+
+// addLine adds a line to the hunk and numbers it
+func addLine(hunk *Hunk, text string, oldLeft, newLeft *int) error {
+	if text == "" {
+		// some editors strip the space of an empty context line
+		text = " "
+	}
+	line := Line{Kind: LineKind(text[0]), Text: text[1:]}
+	oldLine := hunk.OldStart + hunk.OldLines - *oldLeft
+	newLine := hunk.NewStart + hunk.NewLines - *newLeft
+	switch line.Kind {
+	case Context:
+		line.OldLine, line.NewLine = oldLine, newLine
+		*oldLeft--
+		*newLeft--
+	case Removed:
+		line.OldLine = oldLine
+		*oldLeft--
+	case Added:
+		line.NewLine = newLine
+		*newLeft--
+	case NoNewline:
+	default:
+		return fmt.Errorf("unexpected line %q in hunk %s", text, hunk.header())
+	}
+	if *oldLeft < 0 || *newLeft < 0 {
+		return fmt.Errorf("hunk %s has more lines than its header says", hunk.header())
+	}
+	hunk.Lines = append(hunk.Lines, line)
+
+	return nil
+}
+
+func parseHunkHeader(line string) (Hunk, error) {
+	match := hunkHeader.FindStringSubmatch(line)
+	if match == nil {
+		return Hunk{}, fmt.Errorf("invalid hunk header %q", line)
+	}
+	count := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	oldStart, _ := strconv.Atoi(match[1])
+	newStart, _ := strconv.Atoi(match[3])
+
+	return Hunk{
+		OldStart: oldStart,
+		OldLines: count(match[2]),
+		NewStart: newStart,
+		NewLines: count(match[4]),
+		Section:  match[5],
+	}, nil
+}
+
+// gitPaths reads the paths of "diff --git a/old b/new", the "---" and
+// "+++" lines are more reliable for paths with spaces
+func gitPaths(line string) (string, string) {
+	paths := strings.TrimPrefix(line, "diff --git ")
+	if i := strings.Index(paths, " b/"); i >= 0 {
+		return strings.TrimPrefix(paths[:i], "a/"), paths[i+3:]
+	}
+
+	return "", ""
+}
+
+// headerPath reads the path of a "---" or "+++" line,
+// /dev/null is the missing side of an added or deleted file
+func headerPath(line string) string {
+	path := line[4:]
+	// plain diffs add a timestamp after a tab
+	path, _, _ = strings.Cut(path, "\t")
+	if path == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		return path[2:]
+	}
+
+	return path
+}
+
+func hasHeader(file *File, prefix string) bool {
+	for _, line := range file.Header {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Path is the path of the new version, or of the old version of a deleted file
+func (f File) Path() string {
+	if f.NewPath != "" {
+		return f.NewPath
+	}
+
+	return f.OldPath
+}
+
+// Generated reports whether the file starts with the
+// "Code generated ... DO NOT EDIT." comment
+func (f File) Generated() bool {
+	for _, hunk := range f.Hunks {
+		for _, line := range hunk.Lines {
+			if line.NewLine > 0 && line.NewLine <= 20 && generatedMarker.MatchString(line.Text) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// String returns the diff of the file in the unified format
+func (f File) String() string {
+	var sb strings.Builder
+	for _, line := range f.Header {
+		sb.WriteString(line + "\n")
+	}
+	for _, hunk := range f.Hunks {
+		sb.WriteString(hunk.String())
+	}
+
+	return sb.String()
+}
+
+// String returns the hunk in the unified format
+func (h Hunk) String() string {
+	var sb strings.Builder
+	sb.WriteString(h.header() + "\n")
+	for _, line := range h.Lines {
+		sb.WriteByte(byte(line.Kind))
+		sb.WriteString(line.Text + "\n")
+	}
+
+	return sb.String()
+}
+
+func (h Hunk) header() string {
+	header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+	if h.Section != "" {
+		header += " " + h.Section
+	}
+
+	return header
+}
+
+// Format returns the diff of the files in the unified format
+func Format(files []File) string {
+	var sb strings.Builder
+	for _, file := range files {
+		sb.WriteString(file.String())
+	}
+
+	return sb.String()
+}
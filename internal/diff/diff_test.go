@@ -0,0 +1,219 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const gitDiff = `commit message that is ignored
+diff --git a/main.go b/main.go
+index 3b18e51..a042389 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,5 @@ package main
+ package main
+
+-func main() {}
++func main() {
++	run()
++}
+@@ -10,2 +11,2 @@ func run() {
+-	return
++	return // done
+ }
+\ No newline at end of file
+diff --git a/docs/new.md b/docs/new.md
+new file mode 100644
+index 0000000..e69de29
+--- /dev/null
++++ b/docs/new.md
+@@ -0,0 +1 @@
++--- a title that looks like a header
+diff --git a/logo.png b/logo.png
+deleted file mode 100644
+index 3b18e51..0000000
+Binary files a/logo.png and /dev/null differ
+`
+
+func TestParse(t *testing.T) {
+	files, err := Parse(strings.NewReader(gitDiff))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, got %+v", files)
+	}
+
+	main := files[0]
+	if main.Path() != "main.go" || len(main.Hunks) != 2 || len(main.Header) != 4 {
+		t.Fatalf("unexpected file %+v", main)
+	}
+	hunk := main.Hunks[0]
+	if hunk.OldStart != 1 || hunk.NewLines != 5 || hunk.Section != "package main" || len(hunk.Lines) != 6 {
+		t.Errorf("unexpected hunk %+v", hunk)
+	}
+	expected := []Line{
+		{Kind: Context, Text: "package main", OldLine: 1, NewLine: 1},
+		{Kind: Context, Text: "", OldLine: 2, NewLine: 2},
+		{Kind: Removed, Text: "func main() {}", OldLine: 3},
+		{Kind: Added, Text: "func main() {", NewLine: 3},
+		{Kind: Added, Text: "\trun()", NewLine: 4},
+		{Kind: Added, Text: "}", NewLine: 5},
+	}
+	if !slices.Equal(hunk.Lines, expected) {
+		t.Errorf("expected lines %+v, got %+v", expected, hunk.Lines)
+	}
+	if last := main.Hunks[1].Lines; len(last) != 4 || last[3].Kind != NoNewline || last[1].NewLine != 11 {
+		t.Errorf("unexpected last hunk %+v", last)
+	}
+
+	added := files[1]
+	if added.OldPath != "" || added.NewPath != "docs/new.md" || len(added.Hunks) != 1 ||
+		added.Hunks[0].Lines[0].Text != "--- a title that looks like a header" {
+		t.Errorf("unexpected added file %+v", added)
+	}
+	deleted := files[2]
+	if deleted.OldPath != "logo.png" || deleted.NewPath != "" || !deleted.Binary {
+		t.Errorf("unexpected deleted file %+v", deleted)
+	}
+
+	// the files format back to the same diff, without the commit message,
+	// with the counts in each hunk header and a space on empty context lines
+	_, expectedDiff, _ := strings.Cut(gitDiff, "\n")
+	expectedDiff = strings.NewReplacer("@@ -0,0 +1 @@", "@@ -0,0 +1,1 @@", "main\n\n", "main\n \n").Replace(expectedDiff)
+	if formatted := Format(files); formatted != expectedDiff {
+		t.Errorf("unexpected formatted diff:\n%s", formatted)
+	}
+}
+
+func TestParsePlainDiff(t *testing.T) {
+	files, err := Parse(strings.NewReader("--- a.txt\t2024-01-01\n+++ a.txt\t2024-01-02\n@@ -1 +1 @@\n-a\n+b\n" +
+		"--- b.txt\n+++ b.txt\n@@ -1 +1 @@\n-c\n+d\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Path() != "a.txt" || files[1].Path() != "b.txt" {
+		t.Errorf("unexpected files %+v", files)
+	}
+
+	if _, err := Parse(strings.NewReader("--- a.txt\n+++ a.txt\n@@ -1,3 +1,3 @@\n-a\n+b\n")); err == nil {
+		t.Error("expected an error for a hunk that is cut off")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	generated := File{NewPath: "api/api.go", Hunks: []Hunk{{Lines: []Line{
+		{Kind: Added, Text: "// Code generated by protoc-gen-go. DO NOT EDIT.", NewLine: 1},
+	}}}}
+	files := []File{
+		{NewPath: "main.go"},
+		{NewPath: "vendor/github.com/x/y.go"},
+		{NewPath: "internal/mock/store_mock.go"},
+		{NewPath: "go.sum"},
+		{NewPath: "cmd/go.sum"},
+		generated,
+	}
+	kept := Filter(files, []string{"vendor/**", "**/*_mock.go", "go.sum"})
+	var paths []string
+	for _, file := range kept {
+		paths = append(paths, file.Path())
+	}
+	if !slices.Equal(paths, []string{"main.go", "cmd/go.sum"}) {
+		t.Errorf("unexpected files %v", paths)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	hunk := func(start int, text string) Hunk {
+		return Hunk{OldStart: start, OldLines: 1, NewStart: start, NewLines: 1, Lines: []Line{
+			{Kind: Removed, Text: text, OldLine: start},
+			{Kind: Added, Text: text + "!", NewLine: start},
+		}}
+	}
+	small := func(path string) File {
+		return File{NewPath: path, OldPath: path, Header: []string{"--- a/" + path, "+++ b/" + path}, Hunks: []Hunk{hunk(1, "x")}}
+	}
+	large := small("large.go")
+	large.Hunks = []Hunk{hunk(1, strings.Repeat("a", 100)), hunk(20, strings.Repeat("b", 100)), hunk(40, strings.Repeat("c", 100))}
+
+	batches := Batches([]File{small("a.go"), small("b.go"), large, small("c.go")}, 80)
+	var layout []string
+	for _, batch := range batches {
+		var files []string
+		for _, file := range batch {
+			files = append(files, file.Path())
+			if file.EstimateTokens() > 80 {
+				t.Errorf("%s is too large for the batch: %d tokens", file.Path(), file.EstimateTokens())
+			}
+		}
+		layout = append(layout, strings.Join(files, ","))
+	}
+	expected := []string{"a.go,b.go", "large.go", "large.go", "large.go,c.go"}
+	if !slices.Equal(layout, expected) {
+		t.Errorf("expected batches %v, got %v", expected, layout)
+	}
+	if paths := Paths(batches[3]); !slices.Equal(paths, []string{"large.go", "c.go"}) {
+		t.Errorf("unexpected paths %v", paths)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		glob, name string
+		match      bool
+	}{
+		{"vendor/**", "vendor/a/b.go", true},
+		{"vendor/**", "internal/vendor/a.go", false},
+		{"**/vendor/**", "internal/vendor/a.go", true},
+		{"**/*.pb.go", "api.pb.go", true},
+		{"**/*.pb.go", "api/v1/api.pb.go", true},
+		{"*.go", "cmd/main.go", false},
+	}
+	for _, test := range tests {
+		if Match(test.glob, test.name) != test.match {
+			t.Errorf("Match(%q, %q) should be %v", test.glob, test.name, test.match)
+		}
+	}
+}
+
+func TestFindLine(t *testing.T) {
+	files, err := Parse(strings.NewReader(gitDiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, ok := FindFile(files, "b/main.go")
+	if !ok {
+		t.Fatal("expected main.go")
+	}
+	tests := []struct {
+		line     int
+		find     func(int) (int, bool)
+		hunk     int
+		expected bool
+	}{
+		{3, main.FindNewLine, 0, true},  // added
+		{2, main.FindNewLine, 0, true},  // context
+		{6, main.FindNewLine, 0, false}, // between the hunks
+		{11, main.FindNewLine, 1, true},
+		{3, main.FindOldLine, 0, true}, // removed
+		{4, main.FindOldLine, 0, false},
+		{0, main.FindNewLine, 0, false},
+	}
+	for i, test := range tests {
+		hunk, ok := test.find(test.line)
+		if ok != test.expected || (ok && hunk != test.hunk) {
+			t.Errorf("test %d: line %d should be %v in hunk %d, got %v in hunk %d", i, test.line, test.expected, test.hunk, ok, hunk)
+		}
+	}
+
+	if file, ok := FindFile(files, "new.md"); !ok || file.Path() != "docs/new.md" {
+		t.Errorf("expected the file that ends with the path, got %+v", file)
+	}
+	if file, ok := FindFile(files, "logo.png"); !ok || file.OldPath != "logo.png" {
+		t.Errorf("expected the deleted file, got %+v", file)
+	}
+	if _, ok := FindFile(files, "other.go"); ok {
+		t.Error("expected no file for a path that is not in the diff")
+	}
+}
@@ -0,0 +1,65 @@
+package diff
+
+import "strings"
+
+// FindFile returns the file with the path. The path of a finding can have
+// the "a/" or "b/" prefix of git, or be the end of the path in the diff,
+// like "cache.go" for "internal/cache/cache.go" when only one file matches.
+func FindFile(files []File, path string) (File, bool) {
+	path = strings.TrimPrefix(path, "./")
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		if file, ok := findPath(files, path); ok {
+			return file, true
+		}
+		path = path[2:]
+	}
+	if file, ok := findPath(files, path); ok {
+		return file, true
+	}
+
+	var matches []File
+	for _, file := range files {
+		if strings.HasSuffix(file.Path(), "/"+path) {
+			matches = append(matches, file)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], true
+	}
+
+	return File{}, false
+}
+
+func findPath(files []File, path string) (File, bool) {
+	for _, file := range files {
+		if file.NewPath == path || (file.NewPath == "" && file.OldPath == path) {
+			return file, true
+		}
+	}
+
+	return File{}, false
+}
+
+// FindNewLine returns the index of the hunk that shows the line of the
+// new version, as an added or a context line, false when no hunk has it
+func (f File) FindNewLine(line int) (int, bool) {
+	return f.findLine(func(l Line) bool { return l.NewLine == line && l.Kind != Removed })
+}
+
+// FindOldLine returns the index of the hunk that shows the line of the
+// old version, as a removed or a context line, false when no hunk has it
+func (f File) FindOldLine(line int) (int, bool) {
+	return f.findLine(func(l Line) bool { return l.OldLine == line && l.Kind != Added })
+}
+
+func (f File) findLine(match func(Line) bool) (int, bool) {
+	for i, hunk := range f.Hunks {
+		for _, line := range hunk.Lines {
+			if line.Kind != NoNewline && match(line) {
+				return i, true
+			}
+		}
+	}
+
+	return 0, false
+}
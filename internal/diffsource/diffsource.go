@@ -0,0 +1,289 @@
+// Package diffsource loads the diff to review. The diff is read from
+// a file, from standard input or is computed by running git diff, with
+// the vendored and the generated files left out.
+package diffsource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/MelleKoning/ai-chat/internal/diff"
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+	"github.com/MelleKoning/ai-chat/internal/tools"
+)
+
+// Kind tells where the diff comes from
+type Kind string
+
+const (
+	KindFile  Kind = "file"
+	KindStdin Kind = "stdin"
+	KindGit   Kind = "git"
+)
+
+// The git ranges that have a name of their own
+const (
+	// RangeStaged are the changes in the index
+	RangeStaged = "staged"
+	// RangeWorktree are all changes that are not committed yet
+	RangeWorktree = "worktree"
+	// RangeBranch are the changes of the current branch since
+	// it left main, or master when there is no main branch
+	RangeBranch = "branch"
+)
+
+// DefaultFile is reviewed when no source is given
+const DefaultFile = "gitdiff.txt"
+
+// DefaultBatchTokens is the size of a batch of a chunked review
+const DefaultBatchTokens = 20000
+
+// gitPrefix starts the spec of a git range
+const gitPrefix = "git:"
+
+// contextLines is the context around the changes in the git diff,
+// more than the default of 3 lines helps the review
+const contextLines = 10
+
+// DefaultExcludes are the globs of the vendored and generated
+// files that are left out of the git diff
+var DefaultExcludes = []string{
+	"vendor/**",
+	"**/vendor/**",
+	"**/*.pb.go",
+	"**/*_mock.go",
+	"**/mock_*.go",
+	"**/*_gen.go",
+	"**/*.gen.go",
+	"**/zz_generated*.go",
+	"go.sum",
+	"**/package-lock.json",
+	"**/yarn.lock",
+}
+
+// Source is the place to load the diff from
+type Source struct {
+	Kind Kind
+	// Path is the file of a KindFile source
+	Path string
+	// Range is RangeStaged, RangeWorktree, RangeBranch or a
+	// revision range like main..feature of a KindGit source
+	Range string
+	// Excludes are the globs left out of the git diff,
+	// nil uses DefaultExcludes
+	Excludes []string
+	// Dir is the directory git runs in, empty for the working directory
+	Dir string
+	// Stdin is read by a KindStdin source, nil reads os.Stdin
+	Stdin io.Reader
+
+	// stdin keeps the contents, standard input can only be read once
+	stdin []byte
+	read  bool
+}
+
+// Parse reads the spec of a source: "-" for standard input, "git:staged",
+// "git:worktree", "git:branch" or a range like "git:main..feature" for
+// git, anything else is the path of a file. An empty spec is DefaultFile.
+func Parse(spec string) (*Source, error) {
+	switch {
+	case spec == "":
+		return &Source{Kind: KindFile, Path: DefaultFile}, nil
+	case spec == "-":
+		return &Source{Kind: KindStdin}, nil
+	case strings.HasPrefix(spec, gitPrefix):
+		return Git(strings.TrimPrefix(spec, gitPrefix))
+	}
+
+	return &Source{Kind: KindFile, Path: spec}, nil
+}
+
+// Git returns the source of a git range
+func Git(gitRange string) (*Source, error) {
+	switch gitRange {
+	case RangeStaged, RangeWorktree, RangeBranch:
+	default:
+		// options like --output make git write files
+		if gitRange == "" || strings.HasPrefix(gitRange, "-") || !strings.Contains(gitRange, "..") {
+			return nil, fmt.Errorf("git range %q is not staged, worktree, branch or like main..feature", gitRange)
+		}
+	}
+
+	return &Source{Kind: KindGit, Range: gitRange}, nil
+}
+
+// String returns the spec of the source, Parse reads it back
+func (s *Source) String() string {
+	switch s.Kind {
+	case KindStdin:
+		return "-"
+	case KindGit:
+		return gitPrefix + s.Range
+	}
+
+	return s.Path
+}
+
+// Load reads or computes the diff
+func (s *Source) Load(ctx context.Context) (genaimodel.ReviewSource, error) {
+	switch s.Kind {
+	case KindFile:
+		contents, err := os.ReadFile(s.Path)
+		if err != nil {
+			return genaimodel.ReviewSource{}, err
+		}
+		return genaimodel.ReviewSource{Name: s.Path, Contents: contents}, nil
+	case KindStdin:
+		contents, err := s.readStdin()
+		if err != nil {
+			return genaimodel.ReviewSource{}, fmt.Errorf("reading standard input: %w", err)
+		}
+		return genaimodel.ReviewSource{Name: "standard input", Contents: contents}, nil
+	case KindGit:
+		revisions, err := s.revisions(ctx)
+		if err != nil {
+			return genaimodel.ReviewSource{}, err
+		}
+		contents, err := s.git(ctx, s.diffArgs(revisions)...)
+		if err != nil {
+			return genaimodel.ReviewSource{}, err
+		}
+		return genaimodel.ReviewSource{Name: "git diff " + strings.Join(revisions, " "), Contents: contents}, nil
+	}
+
+	return genaimodel.ReviewSource{}, fmt.Errorf("unknown source kind %q", s.Kind)
+}
+
+// Files loads the diff and parses the files that are reviewed, the
+// excluded and the generated files are left out, also of a diff from a
+// file. The name of the diff is returned with the files.
+func (s *Source) Files(ctx context.Context) (string, []diff.File, error) {
+	review, err := s.Load(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	files, err := diff.Parse(bytes.NewReader(review.Contents))
+	if err != nil {
+		return "", nil, fmt.Errorf("%s is not a valid diff: %w", review.Name, err)
+	}
+	if len(files) == 0 {
+		return "", nil, fmt.Errorf("nothing to review, %s has no changed files", review.Name)
+	}
+	files = diff.Filter(files, s.excludes())
+	if len(files) == 0 {
+		return "", nil, fmt.Errorf("nothing to review, %s only changes vendored or generated files", review.Name)
+	}
+
+	return review.Name, files, nil
+}
+
+// Batches loads the diff and splits the files into batches
+// of at most maxTokens for a chunked review
+func (s *Source) Batches(ctx context.Context, maxTokens int) ([]genaimodel.ReviewBatch, error) {
+	name, files, err := s.Files(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return Batches(name, files, maxTokens), nil
+}
+
+// Batches splits the files of the diff with the name into
+// batches of at most maxTokens, zero for DefaultBatchTokens
+func Batches(name string, files []diff.File, maxTokens int) []genaimodel.ReviewBatch {
+	if maxTokens <= 0 {
+		maxTokens = DefaultBatchTokens
+	}
+	parts := diff.Batches(files, maxTokens)
+	batches := make([]genaimodel.ReviewBatch, 0, len(parts))
+	for i, part := range parts {
+		batches = append(batches, genaimodel.ReviewBatch{
+			ReviewSource: genaimodel.ReviewSource{
+				Name:     fmt.Sprintf("%s (batch %d of %d)", name, i+1, len(parts)),
+				Contents: []byte(diff.Format(part)),
+			},
+			Files: diff.Paths(part),
+		})
+	}
+
+	return batches
+}
+
+func (s *Source) excludes() []string {
+	if s.Excludes == nil {
+		return DefaultExcludes
+	}
+
+	return s.Excludes
+}
+
+// readStdin reads standard input the first time, later
+// loads return the same contents
+func (s *Source) readStdin() ([]byte, error) {
+	if s.read {
+		return s.stdin, nil
+	}
+	r := s.Stdin
+	if r == nil {
+		r = os.Stdin
+	}
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s.stdin, s.read = contents, true
+
+	return contents, nil
+}
+
+// revisions returns the arguments of git diff that select the changes
+func (s *Source) revisions(ctx context.Context) ([]string, error) {
+	switch s.Range {
+	case RangeStaged:
+		return []string{"--staged"}, nil
+	case RangeWorktree:
+		return []string{"HEAD"}, nil
+	case RangeBranch:
+		base, err := s.mainBranch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []string{base + "...HEAD"}, nil
+	}
+
+	return []string{s.Range}, nil
+}
+
+// diffArgs returns the arguments of git diff for the revisions,
+// followed by the pathspecs that leave out the excludes
+func (s *Source) diffArgs(revisions []string) []string {
+	args := []string{"diff", "--no-color", "--no-ext-diff", fmt.Sprintf("--unified=%d", contextLines)}
+	args = append(args, revisions...)
+	args = append(args, "--", ".")
+	for _, exclude := range s.excludes() {
+		args = append(args, ":(exclude,glob)"+exclude)
+	}
+
+	return args
+}
+
+// mainBranch returns main, or master when there is no main branch
+func (s *Source) mainBranch(ctx context.Context) (string, error) {
+	for _, branch := range []string{"main", "master"} {
+		if _, err := s.git(ctx, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+			return branch, nil
+		}
+	}
+
+	return "", errors.New("there is no main or master branch to compare with")
+}
+
+// git runs git in the directory of the source
+func (s *Source) git(ctx context.Context, args ...string) ([]byte, error) {
+	return tools.Git(ctx, s.Dir, args...)
+}
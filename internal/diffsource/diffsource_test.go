@@ -0,0 +1,147 @@
+package diffsource
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected Source
+	}{
+		{"", Source{Kind: KindFile, Path: DefaultFile}},
+		{"review/pr.diff", Source{Kind: KindFile, Path: "review/pr.diff"}},
+		{"-", Source{Kind: KindStdin}},
+		{"git:staged", Source{Kind: KindGit, Range: RangeStaged}},
+		{"git:branch", Source{Kind: KindGit, Range: RangeBranch}},
+		{"git:cd71..HEAD", Source{Kind: KindGit, Range: "cd71..HEAD"}},
+	}
+	for _, test := range tests {
+		source, err := Parse(test.spec)
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if source.Kind != test.expected.Kind || source.Path != test.expected.Path || source.Range != test.expected.Range {
+			t.Errorf("%q: expected %+v, got %+v", test.spec, test.expected, source)
+		}
+		if test.spec != "" && source.String() != test.spec {
+			t.Errorf("%q: the spec reads back as %q", test.spec, source.String())
+		}
+	}
+
+	for _, spec := range []string{"git:", "git:HEAD", "git:--output=/tmp/x..HEAD"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestLoadFileAndStdin(t *testing.T) {
+	if _, err := (&Source{Kind: KindFile, Path: filepath.Join(t.TempDir(), "missing.diff")}).Load(context.Background()); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	source := &Source{Kind: KindStdin, Stdin: strings.NewReader("+added\n")}
+	for range 2 {
+		review, err := source.Load(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// standard input is read once, the second load returns the same diff
+		if string(review.Contents) != "+added\n" {
+			t.Errorf("unexpected contents %q", review.Contents)
+		}
+	}
+}
+
+func TestBatches(t *testing.T) {
+	file := func(path string) string {
+		return "diff --git a/" + path + " b/" + path + "\n--- a/" + path + "\n+++ b/" + path +
+			"\n@@ -1,1 +1,1 @@\n-" + strings.Repeat("a", 60) + "\n+" + strings.Repeat("b", 60) + "\n"
+	}
+	source := &Source{Kind: KindStdin, Stdin: strings.NewReader(file("a.go") + file("vendor/x/y.go") + file("b.go"))}
+	batches, err := source.Batches(context.Background(), 50)
+	if err != nil {
+		t.Fatalf("Batches failed: %v", err)
+	}
+	if len(batches) != 2 || batches[0].Files[0] != "a.go" || batches[1].Files[0] != "b.go" ||
+		batches[1].Name != "standard input (batch 2 of 2)" || string(batches[1].Contents) != file("b.go") {
+		t.Errorf("unexpected batches %+v", batches)
+	}
+
+	source = &Source{Kind: KindStdin, Stdin: strings.NewReader(file("vendor/x/y.go"))}
+	if _, err := source.Batches(context.Background(), 50); err == nil {
+		t.Error("expected an error when all files are excluded")
+	}
+}
+
+func TestLoadGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	write := func(name, contents string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "--quiet", "--initial-branch=main")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "test")
+	write("main.go", "package main\n")
+	git("add", ".")
+	git("commit", "--quiet", "-m", "initial")
+
+	git("checkout", "--quiet", "-b", "feature")
+	write("main.go", "package main\n\nfunc main() {}\n")
+	write("vendor/lib/lib.go", "package lib\n")
+	write("api/api.pb.go", "package api\n")
+	git("add", ".")
+
+	staged := &Source{Kind: KindGit, Range: RangeStaged, Dir: dir}
+	review, err := staged.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := string(review.Contents)
+	if review.Name != "git diff --staged" || !strings.Contains(diff, "+func main() {}") {
+		t.Errorf("unexpected review source %s:\n%s", review.Name, diff)
+	}
+	if strings.Contains(diff, "vendor/lib") || strings.Contains(diff, "api.pb.go") {
+		t.Errorf("expected the vendored and generated files to be left out:\n%s", diff)
+	}
+
+	git("commit", "--quiet", "-m", "add main")
+	branch := &Source{Kind: KindGit, Range: RangeBranch, Dir: dir}
+	review, err = branch.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if review.Name != "git diff main...HEAD" || !strings.Contains(string(review.Contents), "+func main() {}") {
+		t.Errorf("unexpected review source %s:\n%s", review.Name, review.Contents)
+	}
+
+	if _, err := (&Source{Kind: KindGit, Range: "nope..HEAD", Dir: dir}).Load(context.Background()); err == nil ||
+		!strings.HasPrefix(err.Error(), "git diff: ") {
+		t.Errorf("expected the error of git, got %v", err)
+	}
+}
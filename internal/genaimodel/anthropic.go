@@ -0,0 +1,532 @@
+package genaimodel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	defaultAnthropicBaseURL   = "https://api.anthropic.com/v1"
+	defaultAnthropicModel     = "claude-sonnet-4-5"
+	defaultAnthropicMaxTokens = 4096
+	// anthropicMinThinkingBudget is the smallest budget for thinking
+	anthropicMinThinkingBudget = 1024
+	anthropicVersion           = "2023-06-01"
+)
+
+// AnthropicConfig configures the backend for the Anthropic Messages API
+type AnthropicConfig struct {
+	// BaseURL defaults to https://api.anthropic.com/v1
+	BaseURL string
+	APIKey  string
+	// Model is the default model to use, defaults to claude-sonnet-4-5
+	Model string
+	// MaxTokens is required by the Messages API, defaults to 4096
+	MaxTokens  int
+	HTTPClient *http.Client
+}
+
+type anthropicProvider struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	maxTokens  int
+	httpClient *http.Client
+}
+
+// NewAnthropicProvider returns the Provider for the Anthropic Messages API
+func NewAnthropicProvider(cfg AnthropicConfig) Provider {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultAnthropicBaseURL
+	}
+	model := cfg.Model
+	if model == "" {
+		model = defaultAnthropicModel
+	}
+	maxTokens := cfg.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &anthropicProvider{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     cfg.APIKey,
+		model:      model,
+		maxTokens:  maxTokens,
+		httpClient: httpClient,
+	}
+}
+
+type anthropicMessage struct {
+	Role string `json:"role"`
+	// Content is the text of the message, or the
+	// content blocks when the message uses tools
+	Content any `json:"content"`
+}
+
+// anthropicBlock is a content block, the type tells which fields are set
+type anthropicBlock struct {
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Input     any    `json:"input,omitempty"`
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	// Source is the data of an image or document block
+	Source *anthropicSource `json:"source,omitempty"`
+}
+
+// anthropicSource holds the base64 encoded data of an attached file
+type anthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      []byte `json:"data"`
+}
+
+// anthropicImageTypes are the image types that the Messages API accepts
+var anthropicImageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+type anthropicTool struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	InputSchema *Schema `json:"input_schema"`
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	MaxTokens     int                `json:"max_tokens"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Stream        bool               `json:"stream"`
+	Temperature   *float32           `json:"temperature,omitempty"`
+	TopP          *float32           `json:"top_p,omitempty"`
+	TopK          *int               `json:"top_k,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Thinking      *anthropicThinking `json:"thinking,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+}
+
+// anthropicThinking enables the extended thinking
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// toAPIError classifies an error event in the middle of a stream
+func (e anthropicError) toAPIError() *APIError {
+	kind := ErrorUnknown
+	switch e.Type {
+	case "authentication_error", "permission_error":
+		kind = ErrorAuth
+	case "rate_limit_error":
+		kind = ErrorQuota
+	case "not_found_error":
+		kind = ErrorModelNotFound
+	case "overloaded_error", "api_error":
+		kind = ErrorUnavailable
+	}
+
+	return &APIError{Kind: kind, Message: fmt.Sprintf("%s: %s", e.Type, e.Message)}
+}
+
+// anthropicEvent contains the fields of the stream
+// events that are used, the type tells which are set
+type anthropicEvent struct {
+	Type string `json:"type"`
+	// Index is the content block the event belongs to
+	Index        int `json:"index"`
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Error anthropicError `json:"error"`
+}
+
+type anthropicModelList struct {
+	Data []struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"display_name"`
+	} `json:"data"`
+}
+
+func (a *anthropicProvider) Name() string {
+	return "anthropic"
+}
+
+func (a *anthropicProvider) DefaultModel() string {
+	return a.model
+}
+
+// Stream posts the conversation to /messages and reads the
+// text of the content_block_delta events of the response
+func (a *anthropicProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		maxTokens := a.maxTokens
+		if req.Generation.MaxOutputTokens != 0 {
+			maxTokens = req.Generation.MaxOutputTokens
+		}
+		// the Messages API has no seed parameter
+		messagesRequest := anthropicRequest{
+			Model:         req.Model,
+			MaxTokens:     maxTokens,
+			System:        anthropicSystem(req),
+			Messages:      toAnthropicMessages(req),
+			Stream:        true,
+			Temperature:   req.Generation.Temperature,
+			TopP:          req.Generation.TopP,
+			TopK:          req.Generation.TopK,
+			StopSequences: req.Generation.StopSequences,
+			Tools:         toAnthropicTools(req.Tools),
+		}
+		// with tools the API expects the signed thinking blocks back
+		// in the tool results, the neutral messages do not keep them
+		switch {
+		case req.Generation.thinking() && len(req.Tools) > 0:
+			log.Printf("Thinking is off for this request to %s, the tool results cannot send the thinking back", req.Model)
+		case req.Generation.thinking():
+			setAnthropicThinking(&messagesRequest, *req.Generation.ThinkingBudget)
+		}
+		body, err := json.Marshal(messagesRequest)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		httpResp, err := a.do(ctx, http.MethodPost, "/messages", body)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer func() {
+			_ = httpResp.Body.Close()
+		}()
+
+		// the input of a tool use is streamed as pieces of json
+		toolUses := map[int]*FunctionCall{}
+		toolInputs := map[int]*strings.Builder{}
+		for sse, err := range readSSE(httpResp.Body) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			var event anthropicEvent
+			if err := json.Unmarshal([]byte(sse.Data), &event); err != nil {
+				yield(nil, fmt.Errorf("decoding %s event: %w", sse.Event, err))
+				return
+			}
+			switch event.Type {
+			case "content_block_start":
+				if event.ContentBlock.Type == "tool_use" {
+					toolUses[event.Index] = &FunctionCall{ID: event.ContentBlock.ID, Name: event.ContentBlock.Name}
+					toolInputs[event.Index] = &strings.Builder{}
+				}
+			case "content_block_stop":
+				call, ok := toolUses[event.Index]
+				if !ok {
+					continue
+				}
+				if input := toolInputs[event.Index].String(); input != "" {
+					if err := json.Unmarshal([]byte(input), &call.Args); err != nil {
+						yield(nil, fmt.Errorf("decoding the input of %s: %w", call.Name, err))
+						return
+					}
+				}
+				if !yield(&Response{Parts: []Part{{FunctionCall: call}}}, nil) {
+					return
+				}
+			case "content_block_delta":
+				var part Part
+				switch {
+				case event.Delta.Type == "input_json_delta":
+					if input, ok := toolInputs[event.Index]; ok {
+						input.WriteString(event.Delta.PartialJSON)
+					}
+					continue
+				case event.Delta.Type == "text_delta" && event.Delta.Text != "":
+					part = Part{Text: event.Delta.Text}
+				case event.Delta.Type == "thinking_delta" && event.Delta.Thinking != "":
+					part = Part{Text: event.Delta.Thinking, Thought: true}
+				default:
+					// signatures of the thinking blocks are not kept
+					continue
+				}
+				if !yield(&Response{Parts: []Part{part}}, nil) {
+					return
+				}
+			case "message_delta":
+				if event.Delta.StopReason == "" {
+					continue
+				}
+				if !yield(&Response{FinishReason: fromAnthropicStopReason(event.Delta.StopReason)}, nil) {
+					return
+				}
+			case "error":
+				yield(nil, event.Error.toAPIError())
+				return
+			case "message_stop":
+				return
+			}
+		}
+	}
+}
+
+// UploadFile inlines the file contents as text
+func (a *anthropicProvider) UploadFile(ctx context.Context, r io.Reader, mimeType string) (Part, error) {
+	return inlineFile(r)
+}
+
+func (a *anthropicProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	httpResp, err := a.do(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = httpResp.Body.Close()
+	}()
+
+	var list anthropicModelList
+	if err := json.NewDecoder(httpResp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var modelInfos []ModelInfo
+	for _, model := range list.Data {
+		modelInfos = append(modelInfos, ModelInfo{
+			Name:        model.ID,
+			DisplayName: model.DisplayName,
+		})
+	}
+
+	return modelInfos, nil
+}
+
+// do sends the request and returns the response when the
+// api answered with 200 OK, otherwise the error is returned
+func (a *anthropicProvider) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("x-api-key", a.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+
+	httpResp, err := a.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		defer func() {
+			_ = httpResp.Body.Close()
+		}()
+		respBody, _ := io.ReadAll(io.LimitReader(httpResp.Body, 64*1024))
+		var event anthropicEvent
+		if err := json.Unmarshal(respBody, &event); err == nil && event.Error.Message != "" {
+			return nil, newHTTPError(httpResp, event.Error.Message)
+		}
+		return nil, newHTTPError(httpResp, strings.TrimSpace(string(respBody)))
+	}
+
+	return httpResp, nil
+}
+
+// anthropicSystem returns the system prompt. The Messages API has no
+// response schema, the schema of a structured answer is described in
+// the system prompt instead.
+func anthropicSystem(req Request) string {
+	if req.ResponseSchema == nil {
+		return req.SystemInstruction
+	}
+	schema, err := json.Marshal(req.ResponseSchema)
+	if err != nil {
+		return req.SystemInstruction
+	}
+	instruction := "Answer only with a JSON object that matches this JSON schema, " +
+		"without any text or markdown around it:\n" + string(schema)
+	if req.SystemInstruction == "" {
+		return instruction
+	}
+
+	return req.SystemInstruction + "\n\n" + instruction
+}
+
+// setAnthropicThinking enables the extended thinking. The API has no
+// budget for "the model decides", a budget below the minimum of 1024,
+// -1 included, is raised to the minimum. The budget must be below
+// max_tokens, which is raised when needed. Thinking does not accept a
+// temperature or top_k.
+func setAnthropicThinking(messagesRequest *anthropicRequest, budget int) {
+	budget = max(budget, anthropicMinThinkingBudget)
+	if messagesRequest.MaxTokens <= budget {
+		messagesRequest.MaxTokens = budget + defaultAnthropicMaxTokens
+	}
+	messagesRequest.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+	messagesRequest.Temperature = nil
+	messagesRequest.TopK = nil
+}
+
+// fromAnthropicStopReason maps the stop reason of a message
+func fromAnthropicStopReason(reason string) FinishReason {
+	switch reason {
+	case "end_turn", "stop_sequence", "tool_use", "pause_turn":
+		return FinishStop
+	case "max_tokens":
+		return FinishMaxTokens
+	case "refusal":
+		return FinishSafety
+	}
+
+	return FinishOther
+}
+
+// toAnthropicMessages converts the history and the new message,
+// consecutive turns of the same role are joined as the Messages
+// API expects the user and assistant turns to alternate. Messages
+// without tools are send as text, the others as content blocks.
+func toAnthropicMessages(req Request) []anthropicMessage {
+	var roles []string
+	var contents [][]anthropicBlock
+	for _, m := range append(append([]Message{}, req.History...), req.Message) {
+		role := "user"
+		if m.Role == RoleModel {
+			role = "assistant"
+		}
+		blocks := toAnthropicBlocks(m)
+		last := len(roles) - 1
+		if last >= 0 && roles[last] == role {
+			contents[last] = append(contents[last], blocks...)
+			continue
+		}
+		roles = append(roles, role)
+		contents = append(contents, blocks)
+	}
+
+	messages := make([]anthropicMessage, 0, len(roles))
+	for i, role := range roles {
+		messages = append(messages, anthropicMessage{Role: role, Content: anthropicContent(contents[i])})
+	}
+
+	return messages
+}
+
+func toAnthropicBlocks(m Message) []anthropicBlock {
+	var blocks []anthropicBlock
+	for _, p := range m.Parts {
+		if p.FunctionResponse != nil {
+			// the results come first in the user turn
+			blocks = append(blocks, anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: p.FunctionResponse.ID,
+				Content:   p.FunctionResponse.text(),
+			})
+		}
+	}
+	for _, p := range m.Parts {
+		if p.InlineData != nil {
+			blocks = append(blocks, toAnthropicAttachment(p.InlineData)...)
+		}
+	}
+	if text := m.Text(); text != "" {
+		blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+	}
+	for _, p := range m.Parts {
+		if p.FunctionCall != nil {
+			input := p.FunctionCall.Args
+			if input == nil {
+				input = map[string]any{}
+			}
+			blocks = append(blocks, anthropicBlock{
+				Type:  "tool_use",
+				ID:    p.FunctionCall.ID,
+				Name:  p.FunctionCall.Name,
+				Input: input,
+			})
+		}
+	}
+
+	return blocks
+}
+
+// toAnthropicAttachment sends images and pdf files as data,
+// text files and files of other types as text
+func toAnthropicAttachment(d *InlineData) []anthropicBlock {
+	blockType := ""
+	switch {
+	case slices.Contains(anthropicImageTypes, d.MIMEType):
+		blockType = "image"
+	case d.MIMEType == "application/pdf":
+		blockType = "document"
+	default:
+		return []anthropicBlock{{Type: "text", Text: d.text()}}
+	}
+
+	return []anthropicBlock{
+		{Type: "text", Text: attachmentLabel(d.DisplayName)},
+		{Type: blockType, Source: &anthropicSource{Type: "base64", MediaType: d.MIMEType, Data: d.Data}},
+	}
+}
+
+// anthropicContent returns the text when the blocks are
+// all text, otherwise the blocks themselves
+func anthropicContent(blocks []anthropicBlock) any {
+	texts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		if block.Type != "text" {
+			return blocks
+		}
+		texts = append(texts, block.Text)
+	}
+
+	return strings.Join(texts, "\n\n")
+}
+
+func toAnthropicTools(declarations []ToolDeclaration) []anthropicTool {
+	var tools []anthropicTool
+	for _, declaration := range declarations {
+		schema := declaration.Parameters
+		if schema == nil {
+			// the input schema is required, also without arguments
+			schema = &Schema{Type: "object"}
+		}
+		tools = append(tools, anthropicTool{
+			Name:        declaration.Name,
+			Description: declaration.Description,
+			InputSchema: schema,
+		})
+	}
+
+	return tools
+}
@@ -0,0 +1,120 @@
+package genaimodel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnthropicStream(t *testing.T) {
+	var received anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "secret" || r.Header.Get("anthropic-version") != anthropicVersion {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{}}\n\n")
+		_, _ = fmt.Fprint(w, "event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0}\n\n")
+		_, _ = fmt.Fprint(w, "event: ping\ndata: {\"type\":\"ping\"}\n\n")
+		_, _ = fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\n")
+		_, _ = fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"!\"}}\n\n")
+		_, _ = fmt.Fprint(w, "event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"}}\n\n")
+		_, _ = fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider(AnthropicConfig{BaseURL: server.URL, APIKey: "secret", Model: "claude"})
+	text, err := collectText(provider.Stream(context.Background(), Request{
+		Model:             "claude",
+		SystemInstruction: "be kind",
+		History: []Message{
+			NewTextMessage("first", RoleUser),
+			NewTextMessage("second", RoleUser),
+		},
+		Message: NewTextMessage("question", RoleUser),
+	}))
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if text != "Hello!" {
+		t.Errorf("unexpected text %q", text)
+	}
+
+	if received.System != "be kind" || received.MaxTokens != defaultAnthropicMaxTokens {
+		t.Errorf("unexpected request %+v", received)
+	}
+	// consecutive user turns are joined into one message
+	if len(received.Messages) != 1 || received.Messages[0].Content != "first\n\nsecond\n\nquestion" {
+		t.Errorf("unexpected messages %+v", received.Messages)
+	}
+}
+
+func TestAnthropicErrorEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider(AnthropicConfig{BaseURL: server.URL})
+	_, err := collectText(provider.Stream(context.Background(), Request{Message: NewTextMessage("hi", RoleUser)}))
+	if err == nil || err.Error() != "overloaded_error: Overloaded" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestAnthropicToolUse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":1,\"content_block\":{\"type\":\"tool_use\",\"id\":\"toolu_1\",\"name\":\"echo\",\"input\":{}}}\n\n")
+		_, _ = fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"text\\\": \"}}\n\n")
+		_, _ = fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"\\\"pong\\\"}\"}}\n\n")
+		_, _ = fmt.Fprint(w, "event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":1}\n\n")
+		_, _ = fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider(AnthropicConfig{BaseURL: server.URL})
+	var calls []*FunctionCall
+	for resp, err := range provider.Stream(context.Background(), Request{Message: NewTextMessage("hi", RoleUser)}) {
+		if err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		for _, p := range resp.Parts {
+			calls = append(calls, p.FunctionCall)
+		}
+	}
+	if len(calls) != 1 || calls[0].ID != "toolu_1" || calls[0].Name != "echo" || calls[0].Args["text"] != "pong" {
+		t.Errorf("unexpected calls %+v", calls)
+	}
+}
+
+func TestAnthropicToolMessages(t *testing.T) {
+	messages := toAnthropicMessages(Request{
+		History: []Message{
+			NewTextMessage("ping", RoleUser),
+			{Role: RoleModel, Parts: []Part{{FunctionCall: &FunctionCall{ID: "toolu_1", Name: "echo"}}}},
+		},
+		Message: Message{Role: RoleUser, Parts: []Part{{FunctionResponse: &FunctionResponse{
+			ID: "toolu_1", Name: "echo", Response: map[string]any{"output": "pong"},
+		}}}},
+	})
+	data, _ := json.Marshal(messages)
+	expected := `[{"role":"user","content":"ping"},` +
+		`{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"echo","input":{}}]},` +
+		`{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"pong"}]}]`
+	if string(data) != expected {
+		t.Errorf("unexpected messages\n%s\nexpected\n%s", data, expected)
+	}
+}
+
+func TestAnthropicDefaultModel(t *testing.T) {
+	if model := NewAnthropicProvider(AnthropicConfig{}).DefaultModel(); model != defaultAnthropicModel {
+		t.Errorf("expected the default model %s, got %q", defaultAnthropicModel, model)
+	}
+}
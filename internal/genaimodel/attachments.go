@@ -0,0 +1,161 @@
+package genaimodel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// maxInlineAttachment is the size up to which an attachment is send
+// inline with the message, larger files are uploaded to the provider
+const maxInlineAttachment = 4 << 20
+
+// textMIMETypes are the application types that hold plain text
+var textMIMETypes = []string{
+	"application/json",
+	"application/javascript",
+	"application/toml",
+	"application/x-sh",
+	"application/x-yaml",
+	"application/xml",
+	"application/yaml",
+}
+
+// AddAttachment attaches the file to the next chat message. Small
+// files are send inline, larger files are uploaded to the provider.
+// Backends without file storage can only take larger text files.
+func (m *theModel) AddAttachment(ctx context.Context, path string) error {
+	name := filepath.Base(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", name)
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	mimeType := detectMIMEType(path, head[:n])
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if info.Size() <= maxInlineAttachment {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		m.attachments = append(m.attachments, Part{InlineData: &InlineData{
+			MIMEType:    mimeType,
+			Data:        data,
+			DisplayName: name,
+		}})
+		log.Printf("Attached %s (%s, %d bytes) inline", name, mimeType, len(data))
+		return nil
+	}
+
+	uploadType := mimeType
+	if isTextMIMEType(mimeType) {
+		uploadType = "text/plain"
+	}
+	part, err := m.provider.UploadFile(ctx, f, uploadType)
+	if err != nil {
+		return fmt.Errorf("uploading %s: %w", name, err)
+	}
+	switch {
+	case part.FileData != nil:
+		part.FileData.DisplayName = name
+		log.Printf("Attached %s (%s) as %s", name, mimeType, part.FileData.FileURI)
+	case isTextMIMEType(mimeType):
+		// the provider inlined the text
+		part = Part{InlineData: &InlineData{MIMEType: mimeType, Data: []byte(part.Text), DisplayName: name}}
+		log.Printf("Attached %s (%s, %d bytes) inline", name, mimeType, info.Size())
+	default:
+		return fmt.Errorf("%s is too large to send inline and %s can not store files", name, m.provider.Name())
+	}
+	m.attachments = append(m.attachments, part)
+
+	return nil
+}
+
+// Attachments returns the names of the files that are
+// attached to the next chat message
+func (m *theModel) Attachments() []string {
+	return Message{Parts: m.attachments}.Attachments()
+}
+
+func (m *theModel) ClearAttachments() {
+	m.attachments = nil
+}
+
+// detectMIMEType uses the extension of the file, the contents
+// decide when the extension is unknown or the file is plain text
+func detectMIMEType(path string, head []byte) string {
+	sniffed := baseMIMEType(http.DetectContentType(head))
+	byExtension := baseMIMEType(mime.TypeByExtension(filepath.Ext(path)))
+	switch {
+	case byExtension == "":
+		return sniffed
+	case sniffed == "text/plain" && !isTextMIMEType(byExtension):
+		// extensions like .ts are also known for binary formats
+		return sniffed
+	default:
+		return byExtension
+	}
+}
+
+// baseMIMEType strips parameters like the charset
+func baseMIMEType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
+
+	return mediaType
+}
+
+func isTextMIMEType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") || slices.Contains(textMIMETypes, mimeType)
+}
+
+// isText is true for an attached text file, backends get its
+// contents as text instead of as data
+func (d *InlineData) isText() bool {
+	return isTextMIMEType(d.MIMEType)
+}
+
+// text returns the attachment as text for the message, a text file
+// as a code block and other files as a note that they are left out
+func (d *InlineData) text() string {
+	if !d.isText() {
+		return fmt.Sprintf("[Attached file %s (%s) is not supported by this backend]\n\n",
+			d.DisplayName, d.MIMEType)
+	}
+	contents := string(bytes.TrimRight(d.Data, "\n"))
+
+	return fmt.Sprintf("%s\n```\n%s\n```\n\n", attachmentLabel(d.DisplayName), contents)
+}
+
+// attachmentLabel names the attached file for the model
+func attachmentLabel(name string) string {
+	return fmt.Sprintf("Attached file %s:", name)
+}
@@ -0,0 +1,118 @@
+package genaimodel
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pngHeader is enough of a png file for the content sniffing
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestDetectMIMEType(t *testing.T) {
+	tests := []struct {
+		path     string
+		head     []byte
+		expected string
+	}{
+		{"screenshot.png", pngHeader, "image/png"},
+		{"screenshot", pngHeader, "image/png"},
+		{"spec.pdf", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"Makefile", []byte("build:\n\tgo build ./...\n"), "text/plain"},
+		{"data.json", []byte(`{"a": 1}`), "application/json"},
+		{"blob", []byte{0, 1, 2, 3}, "application/octet-stream"},
+	}
+	for _, test := range tests {
+		if mimeType := detectMIMEType(test.path, test.head); mimeType != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.path, test.expected, mimeType)
+		}
+	}
+}
+
+func TestChatMessageSendsAttachments(t *testing.T) {
+	dir := t.TempDir()
+	screenshot := filepath.Join(dir, "screenshot.png")
+	logFile := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(screenshot, pngHeader, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(logFile, []byte("panic: nil map\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	provider := &fakeProvider{chunks: []string{"A nil map."}}
+	model, _ := NewModel(context.Background(), provider, "")
+
+	for _, path := range []string{screenshot, logFile} {
+		if err := model.AddAttachment(context.Background(), path); err != nil {
+			t.Fatalf("AddAttachment failed: %v", err)
+		}
+	}
+	if err := model.AddAttachment(context.Background(), dir); err == nil {
+		t.Error("expected an error for a directory")
+	}
+	if names := model.Attachments(); strings.Join(names, ",") != "screenshot.png,app.log" {
+		t.Errorf("unexpected attachments %v", names)
+	}
+
+	if _, err := model.ChatMessage(context.Background(), "what went wrong?", func(string) {}); err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	parts := provider.requests[0].Message.Parts
+	if len(parts) != 3 || parts[0].InlineData.MIMEType != "image/png" ||
+		!parts[1].InlineData.isText() || parts[2].Text != "what went wrong?" {
+		t.Errorf("unexpected message parts %+v", parts)
+	}
+	if len(model.Attachments()) != 0 {
+		t.Errorf("expected the attachments to be cleared, got %v", model.Attachments())
+	}
+
+	// the attachments are stored with the chat history
+	data, err := model.GetChatHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, _ := NewModel(context.Background(), &fakeProvider{}, "")
+	history, err := loaded.LoadChatHistory(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := history[0].Attachments(); len(names) != 2 || history[0].Text() != "what went wrong?" {
+		t.Errorf("unexpected loaded question %+v", history[0])
+	}
+}
+
+func TestAttachmentsPerBackend(t *testing.T) {
+	message := Message{Role: RoleUser, Parts: []Part{
+		{InlineData: &InlineData{MIMEType: "image/png", Data: pngHeader, DisplayName: "screenshot.png"}},
+		{InlineData: &InlineData{MIMEType: "text/plain", Data: []byte("panic: nil map\n"), DisplayName: "app.log"}},
+		{Text: "what went wrong?"},
+	}}
+	req := Request{Message: message}
+
+	parts := toGenaiParts(message.Parts)
+	if len(parts) != 4 || parts[1].InlineData == nil || parts[1].InlineData.MIMEType != "image/png" ||
+		!strings.Contains(parts[2].Text, "panic: nil map") {
+		t.Errorf("unexpected gemini parts %+v", parts)
+	}
+
+	content, _ := json.Marshal(toOpenAIMessages(req)[0].Content)
+	if !strings.Contains(string(content), `"image_url":{"url":"data:image/png;base64,`) ||
+		!strings.Contains(string(content), "Attached file app.log:") {
+		t.Errorf("unexpected openai content %s", content)
+	}
+
+	ollama := toOllamaMessages(req)[0]
+	if len(ollama.Images) != 1 || !strings.HasPrefix(ollama.Content, "Attached file screenshot.png: image 1") ||
+		!strings.HasSuffix(ollama.Content, "what went wrong?") {
+		t.Errorf("unexpected ollama message %+v", ollama)
+	}
+
+	blocks := toAnthropicBlocks(message)
+	if len(blocks) != 4 || blocks[1].Type != "image" || blocks[1].Source.MediaType != "image/png" ||
+		blocks[3].Text != "what went wrong?" {
+		t.Errorf("unexpected anthropic blocks %+v", blocks)
+	}
+}
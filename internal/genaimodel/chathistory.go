@@ -0,0 +1,37 @@
+package genaimodel
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// savedChat is the layout of a stored chat history file
+type savedChat struct {
+	Model string `json:"model,omitempty"`
+	// Generation is nil when the chat used the defaults of the backend
+	Generation *GenerationConfig `json:"generation,omitempty"`
+	History    []Message         `json:"history"`
+	// Findings are the findings of the last review with their status
+	Findings []TrackedFinding `json:"findings,omitempty"`
+}
+
+// UnmarshalJSON also accepts the earlier layout of the
+// history file, which was only the list of messages
+func (sc *savedChat) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		sc.Model = ""
+		sc.Generation = nil
+		sc.Findings = nil
+		return json.Unmarshal(trimmed, &sc.History)
+	}
+
+	// the alias type prevents calling this method recursively
+	type savedChatLayout savedChat
+	var chat savedChatLayout
+	if err := json.Unmarshal(data, &chat); err != nil {
+		return err
+	}
+	*sc = savedChat(chat)
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package genaimodel
+
+import (
+	"context"
+	"testing"
+)
+
+func TestChatHistoryKeepsModel(t *testing.T) {
+	provider := NewOpenAIProvider(OpenAIConfig{Model: "default-model"})
+	model, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	if model.GetModel() != "default-model" {
+		t.Fatalf("expected the default model of the provider, got %q", model.GetModel())
+	}
+
+	stored := []byte(`{"model":"picked-model","history":[{"parts":[{"text":"hi"}],"role":"user"}]}`)
+	history, err := model.LoadChatHistory(stored)
+	if err != nil {
+		t.Fatalf("LoadChatHistory failed: %v", err)
+	}
+	if len(history) != 1 || model.GetModel() != "picked-model" {
+		t.Errorf("unexpected history %+v with model %q", history, model.GetModel())
+	}
+
+	jsonData, err := model.GetChatHistory()
+	if err != nil {
+		t.Fatalf("GetChatHistory failed: %v", err)
+	}
+	if string(jsonData) != string(stored) {
+		t.Errorf("expected %s, got %s", stored, jsonData)
+	}
+}
+
+func TestChatHistoryLoadsListLayout(t *testing.T) {
+	model, err := NewModel(context.Background(), NewOpenAIProvider(OpenAIConfig{Model: "default-model"}), "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+
+	history, err := model.LoadChatHistory([]byte(`[{"parts":[{"text":"hi"}],"role":"user"}]`))
+	if err != nil {
+		t.Fatalf("LoadChatHistory failed: %v", err)
+	}
+	if len(history) != 1 || history[0].Text() != "hi" {
+		t.Errorf("unexpected history %+v", history)
+	}
+	// a history without model leaves the active model alone
+	if model.GetModel() != "default-model" {
+		t.Errorf("unexpected model %q", model.GetModel())
+	}
+}
+
+func TestChatHistoryKeepsGeneration(t *testing.T) {
+	model, err := NewModel(context.Background(), &fakeProvider{chunks: []string{"ok"}}, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	temperature := float32(0.2)
+	model.SetGeneration(GenerationConfig{Temperature: &temperature, StopSequences: []string{"END"}})
+
+	jsonData, err := model.GetChatHistory()
+	if err != nil {
+		t.Fatalf("GetChatHistory failed: %v", err)
+	}
+
+	reloaded, err := NewModel(context.Background(), &fakeProvider{}, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	if _, err := reloaded.LoadChatHistory(jsonData); err != nil {
+		t.Fatalf("LoadChatHistory failed: %v", err)
+	}
+	if got := reloaded.GetGeneration().String(); got != `temperature 0.2, stop ["END"]` {
+		t.Errorf("unexpected generation %s", got)
+	}
+}
@@ -0,0 +1,153 @@
+package genaimodel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// defaultReviewWorkers is the number of batches that are reviewed at once
+const defaultReviewWorkers = 4
+
+// ReviewBatch is a part of a large diff that is reviewed on its own
+type ReviewBatch struct {
+	ReviewSource
+	// Files are the paths of the files in the batch
+	Files []string
+}
+
+// ChunkedReview reviews the batches of a large diff concurrently, at most
+// workers at once, like StructuredReview without the chat history. The
+// findings of the batches are merged into one Review, onProgress receives
+// the number of files that are reviewed completely. When a batch fails the
+// other batches are cancelled, the review of the finished batches is
+// returned with the error. The merged review is added to the chat history.
+func (m *theModel) ChunkedReview(ctx context.Context, batches []ReviewBatch, workers int,
+	onProgress func(done, total int)) (Review, error) {
+	if len(batches) == 0 {
+		return Review{}, errors.New("nothing to review, the diff has no files")
+	}
+	if workers <= 0 {
+		workers = defaultReviewWorkers
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// remaining counts the batches of each file that are not reviewed yet
+	remaining := map[string]int{}
+	for _, batch := range batches {
+		for _, file := range batch.Files {
+			remaining[file]++
+		}
+	}
+	total, done := len(remaining), 0
+	onProgress(done, total)
+
+	reviews := make([]Review, len(batches))
+	errs := make([]error, len(batches))
+	jobs := make(chan int)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for range min(workers, len(batches)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				reviews[i], errs[i] = m.reviewBatch(ctx, batches[i])
+				if errs[i] != nil {
+					log.Printf("Review of %s failed: %v", batches[i].Name, errs[i])
+					cancel()
+					continue
+				}
+				mutex.Lock()
+				for _, file := range batches[i].Files {
+					remaining[file]--
+					if remaining[file] == 0 {
+						done++
+					}
+				}
+				onProgress(done, total)
+				mutex.Unlock()
+			}
+		}()
+	}
+	for i := range batches {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	review := mergeReviews(reviews)
+	if err := firstError(errs); err != nil {
+		return review, err
+	}
+	// the batches that were not sent to a worker after a
+	// cancellation have no error, the review is not complete
+	if err := ctx.Err(); err != nil {
+		return review, err
+	}
+	answer, err := json.Marshal(review)
+	if err != nil {
+		return review, err
+	}
+	m.recordTurn(NewTextMessage(fmt.Sprintf("Review the diff of %d files in %d batches", total, len(batches)), RoleUser),
+		string(answer))
+
+	return review, nil
+}
+
+// reviewBatch reviews the batch with a model of its own, so that the
+// batches do not share the chat history or the context usage
+func (m *theModel) reviewBatch(ctx context.Context, batch ReviewBatch) (Review, error) {
+	worker := &theModel{
+		systemInstruction: m.systemInstruction,
+		provider:          m.provider,
+		model:             m.model,
+		retryPolicy:       m.retryPolicy,
+		generation:        m.generation,
+		continuation:      m.continuation,
+		onThought:         func(string) {},
+	}
+
+	return worker.StructuredReview(ctx, batch.ReviewSource, func(string) {})
+}
+
+// mergeReviews joins the summaries and the findings of the batches
+func mergeReviews(reviews []Review) Review {
+	var summaries []string
+	var merged Review
+	for _, review := range reviews {
+		if review.Summary != "" {
+			summaries = append(summaries, review.Summary)
+		}
+		merged.Findings = append(merged.Findings, review.Findings...)
+	}
+	merged.Summary = strings.Join(summaries, "\n\n")
+	sortFindings(merged.Findings)
+
+	return merged
+}
+
+// firstError returns the error that made the review fail,
+// the other batches failed with context.Canceled after it
+func firstError(errs []error) error {
+	var cancelled error
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, context.Canceled):
+			cancelled = err
+		default:
+			return err
+		}
+	}
+
+	return cancelled
+}
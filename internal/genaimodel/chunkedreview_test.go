@@ -0,0 +1,145 @@
+package genaimodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// batchProvider reviews each batch with a finding for every
+// file in the diff, the diff "fail" fails the request
+type batchProvider struct {
+	fakeProvider
+	mutex    sync.Mutex
+	requests int
+}
+
+func (b *batchProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	b.mutex.Lock()
+	b.requests++
+	b.mutex.Unlock()
+	diff := req.Message.Parts[0].Text
+	return func(yield func(*Response, error) bool) {
+		if diff == "fail" {
+			yield(nil, &APIError{Kind: ErrorAuth, Message: "invalid api key"})
+			return
+		}
+		var findings []string
+		for _, file := range strings.Fields(diff) {
+			findings = append(findings, fmt.Sprintf(
+				`{"file":%q,"startLine":1,"endLine":1,"severity":"minor","category":"style","message":"naming"}`, file))
+		}
+		yield(&Response{Parts: []Part{{Text: fmt.Sprintf(`{"summary":"Changes %s.","findings":[%s]}`,
+			diff, strings.Join(findings, ","))}}}, nil)
+	}
+}
+
+func TestChunkedReview(t *testing.T) {
+	provider := &batchProvider{}
+	model, _ := NewModel(context.Background(), provider, "review")
+	batches := []ReviewBatch{
+		{ReviewSource: ReviewSource{Name: "batch 1", Contents: []byte("c.go a.go")}, Files: []string{"c.go", "a.go"}},
+		{ReviewSource: ReviewSource{Name: "batch 2", Contents: []byte("b.go")}, Files: []string{"b.go"}},
+		{ReviewSource: ReviewSource{Name: "batch 3", Contents: []byte("b.go")}, Files: []string{"b.go"}},
+	}
+
+	var mutex sync.Mutex
+	var progress []string
+	review, err := model.ChunkedReview(context.Background(), batches, 2, func(done, total int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		progress = append(progress, fmt.Sprintf("%d/%d", done, total))
+	})
+	if err != nil {
+		t.Fatalf("ChunkedReview failed: %v", err)
+	}
+	if provider.requests != 3 {
+		t.Errorf("expected a request per batch, got %d", provider.requests)
+	}
+	var files []string
+	for _, finding := range review.Findings {
+		files = append(files, finding.File)
+	}
+	if strings.Join(files, ",") != "a.go,b.go,b.go,c.go" || strings.Count(review.Summary, "Changes") != 3 {
+		t.Errorf("unexpected review %+v", review)
+	}
+	if progress[0] != "0/3" || progress[len(progress)-1] != "3/3" {
+		t.Errorf("unexpected progress %v", progress)
+	}
+	// the batches are not added to the history, the merged review is
+	if model.GetHistoryLength() != 2 {
+		t.Errorf("expected the merged review in the history, got %d messages", model.GetHistoryLength())
+	}
+}
+
+func TestChunkedReviewFails(t *testing.T) {
+	model, _ := NewModel(context.Background(), &batchProvider{}, "review")
+	batches := []ReviewBatch{
+		{ReviewSource: ReviewSource{Name: "batch 1", Contents: []byte("fail")}, Files: []string{"a.go"}},
+		{ReviewSource: ReviewSource{Name: "batch 2", Contents: []byte("b.go")}, Files: []string{"b.go"}},
+	}
+
+	_, err := model.ChunkedReview(context.Background(), batches, 1, func(int, int) {})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != ErrorAuth {
+		t.Errorf("expected the error of the failed batch, got %v", err)
+	}
+	if model.GetHistoryLength() != 0 {
+		t.Errorf("expected no history after a failure, got %d messages", model.GetHistoryLength())
+	}
+
+	if _, err := model.ChunkedReview(context.Background(), nil, 1, func(int, int) {}); err == nil {
+		t.Error("expected an error without batches")
+	}
+}
+
+// cancelledBatchProvider reviews the first batch and waits for the
+// cancellation in the others
+type cancelledBatchProvider struct {
+	batchProvider
+	started chan struct{}
+	once    sync.Once
+}
+
+func (b *cancelledBatchProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	if req.Message.Parts[0].Text == "a.go" {
+		return b.batchProvider.Stream(ctx, req)
+	}
+	return func(yield func(*Response, error) bool) {
+		b.once.Do(func() { close(b.started) })
+		<-ctx.Done()
+		yield(nil, ctx.Err())
+	}
+}
+
+func TestChunkedReviewCancelled(t *testing.T) {
+	provider := &cancelledBatchProvider{started: make(chan struct{})}
+	model, _ := NewModel(context.Background(), provider, "review")
+	batches := []ReviewBatch{
+		{ReviewSource: ReviewSource{Name: "batch 1", Contents: []byte("a.go")}, Files: []string{"a.go"}},
+		{ReviewSource: ReviewSource{Name: "batch 2", Contents: []byte("b.go")}, Files: []string{"b.go"}},
+		{ReviewSource: ReviewSource{Name: "batch 3", Contents: []byte("c.go")}, Files: []string{"c.go"}},
+		{ReviewSource: ReviewSource{Name: "batch 4", Contents: []byte("d.go")}, Files: []string{"d.go"}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-provider.started
+		cancel()
+	}()
+
+	// one worker, the batches after the blocked one are never sent to it
+	review, err := model.ChunkedReview(ctx, batches, 1, func(int, int) {})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(review.Findings) != 1 {
+		t.Errorf("expected the findings of the first batch, got %+v", review.Findings)
+	}
+	if model.GetHistoryLength() != 0 {
+		t.Errorf("expected no history after a cancellation, got %d messages", model.GetHistoryLength())
+	}
+}
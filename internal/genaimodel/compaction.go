@@ -0,0 +1,119 @@
+package genaimodel
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+const defaultKeepTurns = 2
+
+const summarizePrompt = `Summarize the conversation so far for yourself, so that the
+  conversation can continue without the original messages. Keep decisions, code
+  snippets that are still relevant, file names and open questions. When the
+  conversation starts with an earlier summary, include it in the new summary.
+  Only respond with the summary.`
+
+// summaryAcknowledgement answers the summary, so that the roles
+// keep alternating when the next user message follows the summary
+const summaryAcknowledgement = "Understood, I continue from this summary."
+
+// Compaction configures the rolling summarization of the
+// chat history. Zero Threshold disables the compaction.
+type Compaction struct {
+	// Threshold is the number of (estimated) tokens of the history
+	// after which the older turns are replaced by a summary
+	Threshold int
+	// KeepTurns is the number of most recent turns that are
+	// always send verbatim, defaults to 2
+	KeepTurns int
+}
+
+// requestHistory returns the history that is send to the model,
+// the compacted messages are replaced by their summary
+func (m *theModel) requestHistory() []Message {
+	var history []Message
+	for _, msg := range m.chatHistory {
+		if msg.Compacted {
+			continue
+		}
+		history = append(history, msg)
+	}
+
+	return history
+}
+
+// compactHistory asks the model to summarize the older turns when the
+// history that is send grows past the threshold. The summarized messages
+// remain in the chat history, marked as compacted, and are followed by
+// the summary message and its acknowledgement by the model. Pinned turns
+// and the most recent turns are kept.
+func (m *theModel) compactHistory(ctx context.Context) {
+	if m.compaction.Threshold <= 0 {
+		return
+	}
+	keepTurns := m.compaction.KeepTurns
+	if keepTurns <= 0 {
+		keepTurns = defaultKeepTurns
+	}
+
+	// indexes in chatHistory of the messages that can be compacted
+	var candidates []int
+	tokens := 0
+	var turnStarts []int
+	for i, msg := range m.chatHistory {
+		if msg.Compacted {
+			continue
+		}
+		tokens += estimateMessageTokens(msg)
+		if msg.Role == RoleUser && !msg.Summary {
+			turnStarts = append(turnStarts, i)
+		}
+	}
+	if tokens <= m.compaction.Threshold || len(turnStarts) <= keepTurns {
+		return
+	}
+	keepFrom := turnStarts[len(turnStarts)-keepTurns]
+	for i := 0; i < keepFrom; i++ {
+		msg := m.chatHistory[i]
+		if msg.Compacted || msg.Pinned {
+			continue
+		}
+		candidates = append(candidates, i)
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	var toSummarize []Message
+	for _, i := range candidates {
+		toSummarize = append(toSummarize, m.chatHistory[i])
+	}
+	summary, err := collectText(m.stream(ctx, Request{
+		Model:   m.model,
+		History: toSummarize,
+		Message: NewTextMessage(summarizePrompt, RoleUser),
+	}))
+	if err != nil || strings.TrimSpace(summary) == "" {
+		// without summary the full history is send, the
+		// token budget still trims it when needed
+		log.Printf("Error compacting chat history: %v", err)
+		return
+	}
+
+	for _, i := range candidates {
+		m.chatHistory[i].Compacted = true
+	}
+	summaryMessage := NewTextMessage(
+		fmt.Sprintf("Summary of the earlier conversation:\n\n%s", summary), RoleUser)
+	summaryMessage.Summary = true
+	acknowledgement := NewTextMessage(summaryAcknowledgement, RoleModel)
+	acknowledgement.Summary = true
+
+	// the summary takes the place right after the last compacted message
+	last := candidates[len(candidates)-1] + 1
+	m.chatHistory = append(m.chatHistory[:last],
+		append([]Message{summaryMessage, acknowledgement}, m.chatHistory[last:]...)...)
+	log.Printf("Compacted %d messages of the chat history into a summary", len(candidates))
+}
@@ -0,0 +1,99 @@
+package genaimodel
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCompactHistoryReplacesOlderTurnsBySummary(t *testing.T) {
+	provider := &fakeProvider{chunks: []string{"answer"}}
+	model, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	model.SetCompaction(Compaction{Threshold: 200, KeepTurns: 1})
+
+	long := strings.Repeat("x", 400)
+	for _, q := range []string{"first", "second", "third"} {
+		if _, err := model.ChatMessage(context.Background(), q+long, func(string) {}); err != nil {
+			t.Fatalf("ChatMessage failed: %v", err)
+		}
+	}
+
+	// the last request is send with the summary instead of the older turns
+	last := provider.requests[len(provider.requests)-1]
+	if !last.History[0].Summary || !strings.Contains(last.History[0].Text(), "answer") {
+		t.Errorf("expected the request to start with the summary, got %+v", last.History[0])
+	}
+	for _, msg := range last.History {
+		if strings.HasPrefix(msg.Text(), "first") {
+			t.Error("the compacted first turn should not be send")
+		}
+	}
+
+	// the stored history still has the full transcript
+	jsonData, err := model.GetChatHistory()
+	if err != nil {
+		t.Fatalf("GetChatHistory failed: %v", err)
+	}
+	var chat savedChat
+	if err := json.Unmarshal(jsonData, &chat); err != nil {
+		t.Fatalf("unmarshal history: %v", err)
+	}
+	if !strings.HasPrefix(chat.History[0].Text(), "first") || !chat.History[0].Compacted {
+		t.Errorf("expected the first turn to be kept as compacted, got %+v", chat.History[0])
+	}
+}
+
+func TestCompactHistoryDisabledByDefault(t *testing.T) {
+	provider := &fakeProvider{chunks: []string{"answer"}}
+	model, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	long := strings.Repeat("x", 4000)
+	for range 3 {
+		if _, err := model.ChatMessage(context.Background(), long, func(string) {}); err != nil {
+			t.Fatalf("ChatMessage failed: %v", err)
+		}
+	}
+	if len(provider.requests) != 3 {
+		t.Errorf("expected no summarization requests, got %d requests", len(provider.requests))
+	}
+}
+
+func TestCompactHistoryWithTokenBudget(t *testing.T) {
+	provider := &fakeProvider{chunks: []string{"answer"}}
+	model, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	model.SetCompaction(Compaction{Threshold: 200, KeepTurns: 1})
+	// the summary and the new message fit, the kept second turn does not
+	model.SetTokenBudget(TokenBudget{Default: 150})
+
+	long := strings.Repeat("x", 400)
+	for _, q := range []string{"first", "second", "third"} {
+		if _, err := model.ChatMessage(context.Background(), q+long, func(string) {}); err != nil {
+			t.Fatalf("ChatMessage failed: %v", err)
+		}
+	}
+
+	// the budget drops the second turn, the summary and its
+	// acknowledgement are kept so the roles keep alternating
+	last := provider.requests[len(provider.requests)-1]
+	if len(last.History) < 2 || !last.History[0].Summary || last.History[0].Role != RoleUser ||
+		!last.History[1].Summary || last.History[1].Role != RoleModel {
+		t.Errorf("expected the summary and its acknowledgement, got %+v", last.History)
+	}
+	for _, m := range last.History {
+		if strings.HasPrefix(m.Text(), "second") {
+			t.Errorf("expected the second turn to be dropped, got %+v", last.History)
+		}
+	}
+	if usage := model.GetContextUsage(); usage.Dropped != 2 {
+		t.Errorf("expected the second turn to be dropped, got %+v", usage)
+	}
+}
@@ -0,0 +1,178 @@
+package genaimodel
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"log"
+	"slices"
+	"strings"
+)
+
+const defaultMaxContinuations = 3
+
+// continuePrompt asks the model to go on with an answer that was cut off
+const continuePrompt = "Your previous answer was cut off at the maximum output length. " +
+	"Continue exactly where it stopped, without repeating anything and without an introduction."
+
+// continuedMarker shows where a continuation is joined to the answer
+const continuedMarker = " [continued] "
+
+// errNothingToContinue is returned by ContinueAnswer when
+// the last answer was not cut off
+var errNothingToContinue = errors.New("the last answer was not cut off at the maximum output tokens")
+
+// Continuation configures what happens with an answer that
+// is cut off at the maximum output tokens
+type Continuation struct {
+	// Auto continues the answer without asking
+	Auto bool
+	// Max limits the continuations of one answer, defaults to 3
+	Max int
+}
+
+func (c Continuation) max() int {
+	if c.Max <= 0 {
+		return defaultMaxContinuations
+	}
+
+	return c.Max
+}
+
+func (m *theModel) SetContinuation(continuation Continuation) {
+	m.continuation = continuation
+}
+
+// continuationRequest asks to continue the answer to the message of req.
+// The question and the answer are pinned in the request, trimming the
+// history to the token budget must not drop what is continued.
+func continuationRequest(req Request, answer string) Request {
+	question := req.Message
+	previous := NewTextMessage(strings.ReplaceAll(answer, continuedMarker, ""), RoleModel)
+	question.Pinned, previous.Pinned = true, true
+	req.History = append(slices.Clone(req.History), question, previous)
+	req.Message = NewTextMessage(continuePrompt, RoleUser)
+
+	return req
+}
+
+// continued streams the answer to req with generate. With a non empty
+// answer it streams the continuation of that answer instead. When the
+// answer is cut off at the maximum output tokens and the continuation
+// is automatic, the continuations are streamed as part of the same
+// answer until the answer is complete or the maximum is reached. Each
+// continuation starts with continuedMarker, except in a JSON answer.
+func (m *theModel) continued(ctx context.Context, req Request, answer string,
+	generate func(context.Context, Request) iter.Seq2[*Response, error]) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		var sb strings.Builder
+		sb.WriteString(answer)
+		next := req
+		continuing := answer != ""
+		if continuing {
+			next = m.fitRequest(ctx, continuationRequest(req, answer))
+		}
+		for {
+			if continuing && req.ResponseSchema == nil {
+				if !yield(&Response{Parts: []Part{{Text: continuedMarker}}}, nil) {
+					return
+				}
+			}
+			m.contextUsage.FinishReason = ""
+			for resp, err := range generate(ctx, next) {
+				if err != nil {
+					yield(nil, err)
+					return
+				}
+				for _, part := range resp.Parts {
+					if !part.Thought {
+						sb.WriteString(part.Text)
+					}
+				}
+				if !yield(resp, nil) {
+					return
+				}
+			}
+			if m.contextUsage.FinishReason != FinishMaxTokens || !m.continuation.Auto ||
+				m.contextUsage.Continuations >= m.continuation.max() {
+				return
+			}
+			m.contextUsage.Continuations++
+			continuations := m.contextUsage.Continuations
+			log.Printf("Continuing the answer that was cut off, continuation %d of %d",
+				continuations, m.continuation.max())
+			// fitting the request starts a new context usage
+			next = m.fitRequest(ctx, continuationRequest(req, sb.String()))
+			m.contextUsage.Continuations = continuations
+			continuing = true
+		}
+	}
+}
+
+// ContinueAnswer continues the last answer when it was cut off at the
+// maximum output tokens. The continuation is added to the same answer
+// in the history, the result contains the complete answer.
+func (m *theModel) ContinueAnswer(ctx context.Context, onChunk func(string)) (ChatResult, error) {
+	n := len(m.chatHistory)
+	if m.contextUsage.FinishReason != FinishMaxTokens || n < 2 || m.chatHistory[n-1].Role != RoleModel {
+		return ChatResult{}, errNothingToContinue
+	}
+	question, answer := m.chatHistory[n-2], m.chatHistory[n-1]
+	previous := buildString(answer.Parts)
+	history := m.requestHistory()
+
+	// the continuation request is fitted to the token budget by continued
+	stream := m.continued(ctx, Request{
+		Model:             m.model,
+		SystemInstruction: m.systemInstruction,
+		History:           history[:max(len(history)-2, 0)],
+		Message:           question,
+		Generation:        m.generation,
+	}, previous, m.generate)
+
+	var allModelParts []Part
+	var thoughts strings.Builder
+	var chunkCounter int
+	for chunk, err := range stream {
+		if err != nil {
+			result := ChatResult{
+				Response:   previous + buildString(allModelParts),
+				ChunkCount: chunkCounter,
+				Thoughts:   thoughts.String(),
+			}
+			if isCancelled(ctx, err) {
+				if m.keepCancelled && len(allModelParts) > 0 {
+					m.setLastAnswer(result.Response + cancelledMarker)
+				}
+				return result, context.Canceled
+			}
+
+			return result, err
+		}
+		parts := m.answerParts(chunk.Parts, &thoughts)
+		for _, part := range parts {
+			onChunk(part.Text)
+		}
+		allModelParts = append(allModelParts, parts...)
+		chunkCounter++
+	}
+
+	result := ChatResult{
+		Response:     previous + buildString(allModelParts),
+		ChunkCount:   chunkCounter,
+		Thoughts:     thoughts.String(),
+		FinishReason: m.contextUsage.FinishReason,
+	}
+	if err := finishError(result.FinishReason); err != nil {
+		return result, err
+	}
+	m.setLastAnswer(result.Response)
+
+	return result, nil
+}
+
+// setLastAnswer replaces the text of the last answer in the history
+func (m *theModel) setLastAnswer(text string) {
+	last := &m.chatHistory[len(m.chatHistory)-1]
+	last.Parts = []Part{{Text: text}}
+}
@@ -0,0 +1,128 @@
+package genaimodel
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"strings"
+	"testing"
+)
+
+// cutOffProvider answers with the next text of its answers, every
+// answer but the last one is cut off at the maximum output tokens
+type cutOffProvider struct {
+	fakeProvider
+	answers []string
+}
+
+func (c *cutOffProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	c.requests = append(c.requests, req)
+	n := len(c.requests) - 1
+	return func(yield func(*Response, error) bool) {
+		finishReason := FinishMaxTokens
+		if n >= len(c.answers)-1 {
+			finishReason = FinishStop
+		}
+		if !yield(&Response{Parts: []Part{{Text: c.answers[min(n, len(c.answers)-1)]}}}, nil) {
+			return
+		}
+		yield(&Response{FinishReason: finishReason}, nil)
+	}
+}
+
+func TestChatMessageContinuesAutomatically(t *testing.T) {
+	provider := &cutOffProvider{answers: []string{"Hello", "world", "!"}}
+	model, _ := NewModel(context.Background(), provider, "")
+	model.SetContinuation(Continuation{Auto: true})
+
+	result, err := model.ChatMessage(context.Background(), "hi", func(string) {})
+	if err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	// the joins of the continuations are marked
+	stitched := "Hello" + continuedMarker + "world" + continuedMarker + "!"
+	if result.Response != stitched || result.FinishReason != FinishStop {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if usage := model.GetContextUsage(); usage.Continuations != 2 {
+		t.Errorf("expected 2 continuations, got %+v", usage)
+	}
+	last := provider.requests[2]
+	if buildString(last.Message.Parts) != continuePrompt ||
+		buildString(last.History[len(last.History)-1].Parts) != "Helloworld" {
+		t.Errorf("unexpected continuation request %+v", last)
+	}
+
+	// the continuations are stitched into a single answer in the history
+	history := model.(*theModel).chatHistory
+	if len(history) != 2 || buildString(history[1].Parts) != stitched {
+		t.Errorf("unexpected history %+v", history)
+	}
+}
+
+func TestChatMessageContinuationsAreCapped(t *testing.T) {
+	provider := &cutOffProvider{answers: []string{"a", "b", "c", "d"}}
+	model, _ := NewModel(context.Background(), provider, "")
+	model.SetContinuation(Continuation{Auto: true, Max: 1})
+
+	result, err := model.ChatMessage(context.Background(), "hi", func(string) {})
+	if err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	if result.Response != "a"+continuedMarker+"b" || result.FinishReason != FinishMaxTokens || len(provider.requests) != 2 {
+		t.Errorf("unexpected result %+v after %d requests", result, len(provider.requests))
+	}
+}
+
+func TestContinueAnswer(t *testing.T) {
+	provider := &cutOffProvider{answers: []string{"Hello", "world"}}
+	model, _ := NewModel(context.Background(), provider, "")
+
+	result, err := model.ChatMessage(context.Background(), "hi", func(string) {})
+	if err != nil || result.FinishReason != FinishMaxTokens || len(provider.requests) != 1 {
+		t.Fatalf("expected a cut off answer without continuation, got %+v, %v", result, err)
+	}
+
+	result, err = model.ContinueAnswer(context.Background(), func(string) {})
+	if err != nil {
+		t.Fatalf("ContinueAnswer failed: %v", err)
+	}
+	if result.Response != "Hello"+continuedMarker+"world" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	history := model.(*theModel).chatHistory
+	if len(history) != 2 || buildString(history[1].Parts) != result.Response {
+		t.Errorf("unexpected history %+v", history)
+	}
+
+	if _, err := model.ContinueAnswer(context.Background(), func(string) {}); !errors.Is(err, errNothingToContinue) {
+		t.Errorf("expected nothing to continue, got %v", err)
+	}
+}
+
+func TestContinuationFitsTheTokenBudget(t *testing.T) {
+	answer := strings.Repeat("a", 200)
+	provider := &cutOffProvider{answers: []string{answer, "b"}}
+	model, _ := NewModel(context.Background(), provider, "")
+	model.(*theModel).chatHistory = []Message{
+		NewTextMessage(strings.Repeat("q", 100), RoleUser),
+		NewTextMessage("a", RoleModel),
+	}
+	model.SetContinuation(Continuation{Auto: true})
+	model.SetTokenBudget(TokenBudget{Default: 60})
+
+	if _, err := model.ChatMessage(context.Background(), "hi", func(string) {}); err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	if len(provider.requests) != 2 || len(provider.requests[0].History) != 2 {
+		t.Fatalf("expected the first request with the whole history, got %+v", provider.requests)
+	}
+	// the older turn is dropped, the question and the answer that is continued are kept
+	history := provider.requests[1].History
+	if len(history) != 2 || history[0].Text() != "hi" || history[1].Text() != answer {
+		t.Errorf("unexpected history of the continuation %+v", history)
+	}
+	if usage := model.GetContextUsage(); usage.Dropped != 2 || usage.Continuations != 1 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
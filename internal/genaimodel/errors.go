@@ -0,0 +1,180 @@
+package genaimodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorKind classifies the errors of the backends
+type ErrorKind int
+
+const (
+	ErrorUnknown ErrorKind = iota
+	// ErrorAuth is a missing or invalid api key
+	ErrorAuth
+	// ErrorQuota is a rate limit or an exhausted quota
+	ErrorQuota
+	// ErrorSafety is a prompt or response blocked by the safety filters
+	ErrorSafety
+	// ErrorNetwork is a failure to reach the backend
+	ErrorNetwork
+	// ErrorModelNotFound is an unknown model name
+	ErrorModelNotFound
+	// ErrorUnavailable is an overloaded or failing backend
+	ErrorUnavailable
+	// ErrorTimeout is a request that took longer than the timeout
+	ErrorTimeout
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorAuth:
+		return "authentication error"
+	case ErrorQuota:
+		return "quota exceeded"
+	case ErrorSafety:
+		return "blocked by safety filters"
+	case ErrorNetwork:
+		return "network error"
+	case ErrorModelNotFound:
+		return "model not found"
+	case ErrorUnavailable:
+		return "service unavailable"
+	case ErrorTimeout:
+		return "request timed out"
+	}
+
+	return "error"
+}
+
+// APIError is the classified error of a request to a backend
+type APIError struct {
+	Kind       ErrorKind
+	StatusCode int
+	Message    string
+	// RetryAfter is the delay the server asked for, zero when not given
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable is true for errors that can succeed when the
+// same request is send again a bit later
+func (e *APIError) Retryable() bool {
+	switch e.Kind {
+	case ErrorQuota, ErrorNetwork, ErrorUnavailable, ErrorTimeout:
+		return true
+	}
+
+	return false
+}
+
+// Advice returns what the user can do about the error
+func (e *APIError) Advice() string {
+	switch e.Kind {
+	case ErrorAuth:
+		return "Check the api key in the environment variable of the backend."
+	case ErrorQuota:
+		return "The rate limit or quota of the backend is reached, wait a moment and retry."
+	case ErrorSafety:
+		return "The request or answer was blocked, rephrase the prompt."
+	case ErrorNetwork:
+		return "The backend can not be reached, check the network or the base url."
+	case ErrorModelNotFound:
+		return "Choose another model with \"Select model\"."
+	case ErrorUnavailable:
+		return "The backend is overloaded or failing, retry in a moment."
+	case ErrorTimeout:
+		return "The backend did not answer in time, retry or increase the request timeout."
+	}
+
+	return ""
+}
+
+// newHTTPError classifies an error response of a http backend,
+// detail is the error message found in the response body
+func newHTTPError(httpResp *http.Response, detail string) *APIError {
+	message := httpResp.Status
+	if detail != "" {
+		message = fmt.Sprintf("%s: %s", httpResp.Status, detail)
+	}
+
+	return &APIError{
+		Kind:       kindFromStatus(httpResp.StatusCode),
+		StatusCode: httpResp.StatusCode,
+		Message:    message,
+		RetryAfter: parseRetryAfter(httpResp.Header.Get("Retry-After")),
+	}
+}
+
+func kindFromStatus(statusCode int) ErrorKind {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorAuth
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorQuota
+	case statusCode == http.StatusNotFound:
+		return ErrorModelNotFound
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout:
+		return ErrorTimeout
+	case statusCode >= 500:
+		// includes 529 overloaded of the Anthropic api
+		return ErrorUnavailable
+	}
+
+	return ErrorUnknown
+}
+
+// parseRetryAfter reads the Retry-After header, which
+// is either a number of seconds or a http date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
+
+// classifyError turns any error of a request into an *APIError,
+// errors of a cancelled request are returned unchanged
+func classifyError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &APIError{Kind: ErrorTimeout, Message: err.Error(), Err: err}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return &APIError{Kind: ErrorTimeout, Message: err.Error(), Err: err}
+		}
+		return &APIError{Kind: ErrorNetwork, Message: err.Error(), Err: err}
+	}
+
+	return &APIError{Kind: ErrorUnknown, Message: err.Error(), Err: err}
+}
@@ -0,0 +1,96 @@
+package genaimodel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FindingStatus is what the user decided about a finding
+type FindingStatus string
+
+const (
+	StatusOpen     FindingStatus = ""
+	StatusResolved FindingStatus = "resolved"
+	StatusIgnored  FindingStatus = "ignored"
+)
+
+// nearbyLines is how far a finding can move between two reviews,
+// the lines shift when the code above the finding changes
+const nearbyLines = 3
+
+// TrackedFinding is a finding of the last review with its status,
+// the tracked findings are stored with the chat history
+type TrackedFinding struct {
+	Finding
+	Status FindingStatus `json:"status,omitempty"`
+}
+
+// TrackReview merges the findings of a new review into the tracked
+// findings. A finding that is like a resolved or ignored finding keeps
+// that status and is left out of the returned review, so a re-review
+// reports only the new and the unresolved findings. The number of
+// findings that are left out is returned with the review.
+func (m *theModel) TrackReview(review Review) (Review, int) {
+	previous := m.findings
+	matched := make([]bool, len(previous))
+	var tracked []TrackedFinding
+	var reported []Finding
+	for _, finding := range review.Findings {
+		status := StatusOpen
+		for i, old := range previous {
+			if !matched[i] && sameFinding(old.Finding, finding) {
+				matched[i] = true
+				status = old.Status
+				break
+			}
+		}
+		tracked = append(tracked, TrackedFinding{Finding: finding, Status: status})
+		if status == StatusOpen {
+			reported = append(reported, finding)
+		}
+	}
+	// the decisions about the findings that the review did not
+	// repeat are kept, a later review can find them again
+	for i, old := range previous {
+		if !matched[i] && old.Status != StatusOpen {
+			tracked = append(tracked, old)
+		}
+	}
+	m.findings = tracked
+
+	left := len(review.Findings) - len(reported)
+	review.Findings = reported
+
+	return review, left
+}
+
+// Findings returns the tracked findings of the last review
+func (m *theModel) Findings() []TrackedFinding {
+	findings := make([]TrackedFinding, len(m.findings))
+	copy(findings, m.findings)
+
+	return findings
+}
+
+// SetFindingStatus marks the tracked finding with the index in Findings
+func (m *theModel) SetFindingStatus(index int, status FindingStatus) error {
+	if index < 0 || index >= len(m.findings) {
+		return fmt.Errorf("there is no finding %d", index)
+	}
+	m.findings[index].Status = status
+
+	return nil
+}
+
+// sameFinding reports whether two findings are about the same issue, the
+// model words a finding differently in each review and the lines move
+func sameFinding(a, b Finding) bool {
+	if a.File != b.File || a.Category != b.Category {
+		return false
+	}
+	if strings.EqualFold(strings.TrimSpace(a.Message), strings.TrimSpace(b.Message)) {
+		return true
+	}
+
+	return a.StartLine-nearbyLines <= b.EndLine && b.StartLine <= a.EndLine+nearbyLines
+}
@@ -0,0 +1,63 @@
+package genaimodel
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTrackReview(t *testing.T) {
+	model, _ := NewModel(context.Background(), &fakeProvider{}, "review")
+	finding := func(file string, line int, message string) Finding {
+		return Finding{File: file, StartLine: line, EndLine: line, Severity: SeverityMinor, Category: "bug", Message: message}
+	}
+
+	review, left := model.TrackReview(Review{Findings: []Finding{
+		finding("a.go", 10, "the error is ignored"),
+		finding("a.go", 40, "the loop never ends"),
+		finding("b.go", 5, "the lock is not released"),
+	}})
+	if len(review.Findings) != 3 || left != 0 {
+		t.Fatalf("expected all findings of the first review, got %+v and %d left out", review.Findings, left)
+	}
+	if err := model.SetFindingStatus(0, StatusResolved); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.SetFindingStatus(2, StatusIgnored); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.SetFindingStatus(3, StatusIgnored); err == nil {
+		t.Error("expected an error for a finding that does not exist")
+	}
+
+	// the findings are stored with the session
+	history, err := model.GetChatHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := NewModel(context.Background(), &fakeProvider{}, "review")
+	if _, err := restored.LoadChatHistory(history); err != nil {
+		t.Fatal(err)
+	}
+
+	// the resolved finding moved two lines and is worded differently,
+	// the ignored finding has the same message on another line
+	review, left = restored.TrackReview(Review{Findings: []Finding{
+		finding("a.go", 12, "the error of Close is ignored"),
+		finding("a.go", 40, "the loop never ends"),
+		finding("b.go", 50, "The lock is not released"),
+		finding("c.go", 1, "a new issue"),
+	}})
+	if left != 2 || len(review.Findings) != 2 || review.Findings[0].StartLine != 40 || review.Findings[1].File != "c.go" {
+		t.Errorf("expected the unresolved and the new finding, got %+v and %d left out", review.Findings, left)
+	}
+	tracked := restored.Findings()
+	if len(tracked) != 4 || tracked[0].Status != StatusResolved || tracked[2].Status != StatusIgnored || tracked[3].Status != StatusOpen {
+		t.Errorf("unexpected tracked findings %+v", tracked)
+	}
+
+	// a decision is kept when the review does not repeat the finding
+	restored.TrackReview(Review{})
+	if tracked := restored.Findings(); len(tracked) != 2 {
+		t.Errorf("expected the resolved and the ignored finding, got %+v", tracked)
+	}
+}
@@ -0,0 +1,489 @@
+package genaimodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// geminiProvider implements the Provider interface
+// on top of the (wrapped) genai client
+type geminiProvider struct {
+	client GeminiClientAPI
+
+	// the chat session is reused for as long as the requests
+	// continue the conversation that the session holds
+	sessionMutex sync.Mutex
+	session      *geminiSession
+}
+
+// geminiSession is a genai chat with the settings it was
+// created with and the turns it contains
+type geminiSession struct {
+	chat              ChatSessionAPI
+	model             string
+	systemInstruction string
+	generation        GenerationConfig
+	tools             []ToolDeclaration
+	responseSchema    *Schema
+	history           []Message
+	// busy is true while a request streams in the session, concurrent
+	// requests, like the batches of a chunked review, get a session of
+	// their own
+	busy bool
+}
+
+// continues is true when the request is the next turn of the session
+func (s *geminiSession) continues(req Request) bool {
+	return s.model == req.Model &&
+		s.systemInstruction == req.SystemInstruction &&
+		reflect.DeepEqual(s.generation, req.Generation) &&
+		reflect.DeepEqual(s.tools, req.Tools) &&
+		reflect.DeepEqual(s.responseSchema, req.ResponseSchema) &&
+		sameTurns(s.history, req.History)
+}
+
+// sameTurns compares the roles and contents of the messages
+func sameTurns(a, b []Message) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Role != b[i].Role || !reflect.DeepEqual(a[i].Parts, b[i].Parts) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func NewGeminiClient(ctx context.Context, apiKey string) (GeminiClientAPI, error) {
+	genaiClient, _ := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+
+	// we return wrapper to the genai client to support
+	// mocking the actual genaiClient
+	return &genaiClientWrapper{
+		client: genaiClient,
+	}, nil
+}
+
+// NewGeminiProvider returns the Provider for the Gemini API
+func NewGeminiProvider(client GeminiClientAPI) Provider {
+	return &geminiProvider{
+		client: client,
+	}
+}
+
+func (g *geminiProvider) Name() string {
+	return "gemini"
+}
+
+func (g *geminiProvider) DefaultModel() string {
+	return modelName
+}
+
+// Stream sends the new message in the chat session of the
+// conversation. A new session seeded with the history is created
+// when the history, the model or the config of the request differ
+// from the session, like after trimming or loading a chat.
+func (g *geminiProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		session, err := g.chatSession(ctx, req)
+		if err != nil {
+			yield(nil, fromGenaiError(err))
+			return
+		}
+		defer g.releaseSession(session)
+
+		var answer []Part
+		thoughts := false
+		for chunk, err := range session.chat.SendMessageStream(ctx, toGenaiParts(req.Message.Parts)...) {
+			if err != nil {
+				g.endSession(session)
+				yield(nil, fromGenaiError(err))
+				return
+			}
+			if chunk != nil && chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+				g.endSession(session)
+				yield(nil, &APIError{
+					Kind:    ErrorSafety,
+					Message: fmt.Sprintf("prompt blocked: %s", chunk.PromptFeedback.BlockReason),
+				})
+				return
+			}
+			resp := fromGenaiResponse(chunk)
+			for _, p := range resp.Parts {
+				if p.Thought {
+					thoughts = true
+					continue
+				}
+				answer = append(answer, p)
+			}
+			if !yield(resp, nil) {
+				// the genai chat does not record an answer that was not read completely
+				g.endSession(session)
+				return
+			}
+		}
+
+		if thoughts {
+			// the genai chat keeps the thoughts in its history, start
+			// the next request from the history without thoughts
+			g.endSession(session)
+			return
+		}
+		g.sessionMutex.Lock()
+		defer g.sessionMutex.Unlock()
+		session.history = append(session.history, req.Message, newModelMessage(answer))
+	}
+}
+
+// chatSession returns the session that the request continues,
+// or creates a new session seeded with the history of the request
+func (g *geminiProvider) chatSession(ctx context.Context, req Request) (*geminiSession, error) {
+	g.sessionMutex.Lock()
+	defer g.sessionMutex.Unlock()
+	if g.session != nil && !g.session.busy && g.session.continues(req) {
+		g.session.busy = true
+		return g.session, nil
+	}
+
+	chat, err := g.client.ChatCreate().Create(ctx, req.Model, toGenaiConfig(req), toGenaiContents(req.History))
+	if err != nil {
+		return nil, err
+	}
+	session := &geminiSession{
+		chat:              chat,
+		model:             req.Model,
+		systemInstruction: req.SystemInstruction,
+		generation:        req.Generation,
+		tools:             req.Tools,
+		responseSchema:    req.ResponseSchema,
+		history:           slices.Clone(req.History),
+		busy:              true,
+	}
+	// a busy session is kept for the conversation it streams
+	if g.session == nil || !g.session.busy {
+		g.session = session
+	}
+
+	return session, nil
+}
+
+// releaseSession makes the session available for the next request
+func (g *geminiProvider) releaseSession(session *geminiSession) {
+	g.sessionMutex.Lock()
+	defer g.sessionMutex.Unlock()
+	session.busy = false
+}
+
+// endSession forgets the session after a failed or incomplete answer,
+// the next request starts a new session from the history
+func (g *geminiProvider) endSession(session *geminiSession) {
+	g.sessionMutex.Lock()
+	defer g.sessionMutex.Unlock()
+	if g.session == session {
+		g.session = nil
+	}
+}
+
+func (g *geminiProvider) UploadFile(ctx context.Context, r io.Reader, mimeType string) (Part, error) {
+	upFile, err := g.client.Files().Upload(ctx, r, &genai.UploadFileConfig{
+		MIMEType: mimeType,
+	})
+	if err != nil {
+		return Part{}, fromGenaiError(err)
+	}
+
+	return Part{FileData: &FileData{
+		FileURI:  upFile.URI,
+		MIMEType: upFile.MIMEType,
+	}}, nil
+}
+
+// CountTokens counts the tokens of the request with the api, the
+// Gemini API does not accept the system instruction as config
+// so it is counted as part of the contents
+func (g *geminiProvider) CountTokens(ctx context.Context, req Request) (int, error) {
+	var messages []Message
+	if req.SystemInstruction != "" {
+		messages = append(messages, NewTextMessage(req.SystemInstruction, RoleUser))
+	}
+	messages = append(messages, req.History...)
+	messages = append(messages, req.Message)
+
+	resp, err := g.client.Models().CountTokens(ctx, req.Model, toGenaiContents(messages), nil)
+	if err != nil {
+		return 0, fromGenaiError(err)
+	}
+
+	return int(resp.TotalTokens), nil
+}
+
+func (g *geminiProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	models, err := g.client.Models().List(ctx, &genai.ListModelsConfig{})
+	if err != nil {
+		return nil, fromGenaiError(err)
+	}
+
+	var modelInfos []ModelInfo
+	for _, model := range models.Items {
+		modelInfos = append(modelInfos, ModelInfo{
+			Name:        model.Name,
+			DisplayName: model.DisplayName,
+			Description: model.Description,
+		})
+	}
+
+	return modelInfos, nil
+}
+
+// toGenaiConfig returns the config of the request,
+// nil when there is nothing to configure
+func toGenaiConfig(req Request) *genai.GenerateContentConfig {
+	if req.SystemInstruction == "" && req.Generation.IsZero() && len(req.Tools) == 0 && req.ResponseSchema == nil {
+		return nil
+	}
+
+	gc := req.Generation
+	config := &genai.GenerateContentConfig{
+		Temperature:     gc.Temperature,
+		TopP:            gc.TopP,
+		MaxOutputTokens: int32(gc.MaxOutputTokens),
+		StopSequences:   gc.StopSequences,
+	}
+	if req.SystemInstruction != "" {
+		config.SystemInstruction = genai.NewContentFromText(req.SystemInstruction, genai.RoleModel)
+	}
+	if gc.TopK != nil {
+		config.TopK = genai.Ptr(float32(*gc.TopK))
+	}
+	if gc.Seed != nil {
+		config.Seed = genai.Ptr(int32(*gc.Seed))
+	}
+	if gc.ThinkingBudget != nil {
+		config.ThinkingConfig = &genai.ThinkingConfig{
+			IncludeThoughts: gc.thinking(),
+			ThinkingBudget:  genai.Ptr(int32(*gc.ThinkingBudget)),
+		}
+	}
+	if len(req.Tools) != 0 {
+		tool := &genai.Tool{}
+		for _, declaration := range req.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, &genai.FunctionDeclaration{
+				Name:        declaration.Name,
+				Description: declaration.Description,
+				Parameters:  toGenaiSchema(declaration.Parameters),
+			})
+		}
+		config.Tools = []*genai.Tool{tool}
+	}
+	if req.ResponseSchema != nil {
+		config.ResponseMIMEType = "application/json"
+		config.ResponseSchema = toGenaiSchema(req.ResponseSchema)
+	}
+
+	return config
+}
+
+// toGenaiSchema converts the JSON schema to the OpenAPI
+// schema of the Gemini API, which has upper case types
+func toGenaiSchema(schema *Schema) *genai.Schema {
+	if schema == nil {
+		return nil
+	}
+	genaiSchema := &genai.Schema{
+		Type:        genai.Type(strings.ToUpper(schema.Type)),
+		Description: schema.Description,
+		Required:    schema.Required,
+		Items:       toGenaiSchema(schema.Items),
+		Enum:        schema.Enum,
+	}
+	for name, property := range schema.Properties {
+		if genaiSchema.Properties == nil {
+			genaiSchema.Properties = map[string]*genai.Schema{}
+		}
+		genaiSchema.Properties[name] = toGenaiSchema(property)
+	}
+
+	return genaiSchema
+}
+
+func toGenaiContents(messages []Message) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(messages))
+	for _, m := range messages {
+		parts := toGenaiParts(m.Parts)
+		genaiParts := make([]*genai.Part, 0, len(parts))
+		for i := range parts {
+			genaiParts = append(genaiParts, &parts[i])
+		}
+		contents = append(contents, genai.NewContentFromParts(genaiParts, genai.Role(m.Role)))
+	}
+
+	return contents
+}
+
+func toGenaiParts(parts []Part) []genai.Part {
+	genaiParts := make([]genai.Part, 0, len(parts))
+	for _, p := range parts {
+		switch {
+		case p.FileData != nil:
+			if p.FileData.DisplayName != "" {
+				genaiParts = append(genaiParts, genai.Part{Text: attachmentLabel(p.FileData.DisplayName)})
+			}
+			genaiParts = append(genaiParts, *genai.NewPartFromURI(p.FileData.FileURI, p.FileData.MIMEType))
+		case p.InlineData != nil && p.InlineData.isText():
+			genaiParts = append(genaiParts, genai.Part{Text: p.InlineData.text()})
+		case p.InlineData != nil:
+			// the display name is not supported by the Gemini API
+			genaiParts = append(genaiParts,
+				genai.Part{Text: attachmentLabel(p.InlineData.DisplayName)},
+				genai.Part{InlineData: &genai.Blob{MIMEType: p.InlineData.MIMEType, Data: p.InlineData.Data}})
+		case p.FunctionCall != nil:
+			genaiParts = append(genaiParts, genai.Part{
+				FunctionCall: &genai.FunctionCall{
+					ID:   p.FunctionCall.ID,
+					Name: p.FunctionCall.Name,
+					Args: p.FunctionCall.Args,
+				},
+				ThoughtSignature: p.ThoughtSignature,
+			})
+		case p.FunctionResponse != nil:
+			genaiParts = append(genaiParts, genai.Part{FunctionResponse: &genai.FunctionResponse{
+				ID:       p.FunctionResponse.ID,
+				Name:     p.FunctionResponse.Name,
+				Response: p.FunctionResponse.Response,
+			}})
+		default:
+			genaiParts = append(genaiParts, genai.Part{Text: p.Text})
+		}
+	}
+
+	return genaiParts
+}
+
+// fromGenaiResponse converts the parts and the finish reason of the
+// first candidate, a chunk without candidates results in a Response
+// with only the usage
+func fromGenaiResponse(resp *genai.GenerateContentResponse) *Response {
+	if resp == nil {
+		return &Response{}
+	}
+	var usage *Usage
+	if resp.UsageMetadata != nil {
+		usage = &Usage{
+			InputTokens:   int(resp.UsageMetadata.PromptTokenCount),
+			OutputTokens:  int(resp.UsageMetadata.CandidatesTokenCount),
+			ThoughtTokens: int(resp.UsageMetadata.ThoughtsTokenCount),
+		}
+	}
+	if len(resp.Candidates) == 0 {
+		return &Response{Usage: usage}
+	}
+	candidate := resp.Candidates[0]
+	response := &Response{Usage: usage, FinishReason: fromGenaiFinishReason(candidate.FinishReason)}
+	if candidate.Content == nil {
+		return response
+	}
+
+	for _, p := range candidate.Content.Parts {
+		if p == nil {
+			continue
+		}
+		part := Part{Text: p.Text, Thought: p.Thought}
+		switch {
+		case p.FileData != nil:
+			part.FileData = &FileData{
+				FileURI:  p.FileData.FileURI,
+				MIMEType: p.FileData.MIMEType,
+			}
+		case p.FunctionCall != nil:
+			part.FunctionCall = &FunctionCall{
+				ID:   p.FunctionCall.ID,
+				Name: p.FunctionCall.Name,
+				Args: p.FunctionCall.Args,
+			}
+			part.ThoughtSignature = p.ThoughtSignature
+		case p.ExecutableCode != nil:
+			// code that the model ran with the code execution tool
+			part.Text = fmt.Sprintf("\n```%s\n%s\n```\n",
+				strings.ToLower(string(p.ExecutableCode.Language)), strings.TrimSuffix(p.ExecutableCode.Code, "\n"))
+		case p.CodeExecutionResult != nil:
+			part.Text = fmt.Sprintf("\nOutput (%s):\n```\n%s\n```\n",
+				strings.ToLower(string(p.CodeExecutionResult.Outcome)), strings.TrimSuffix(p.CodeExecutionResult.Output, "\n"))
+		case p.InlineData != nil:
+			// the chat shows text only, the data is not kept
+			part.Text = fmt.Sprintf("\n[%s data of %d bytes]\n", p.InlineData.MIMEType, len(p.InlineData.Data))
+		}
+		response.Parts = append(response.Parts, part)
+	}
+
+	return response
+}
+
+// fromGenaiFinishReason maps the finish reason of a candidate,
+// the reasons of the safety filters are all reported as safety
+func fromGenaiFinishReason(reason genai.FinishReason) FinishReason {
+	switch reason {
+	case "", genai.FinishReasonUnspecified:
+		return ""
+	case genai.FinishReasonStop:
+		return FinishStop
+	case genai.FinishReasonMaxTokens:
+		return FinishMaxTokens
+	case genai.FinishReasonSafety, genai.FinishReasonBlocklist, genai.FinishReasonProhibitedContent,
+		genai.FinishReasonSPII, genai.FinishReasonImageSafety:
+		return FinishSafety
+	case genai.FinishReasonRecitation:
+		return FinishRecitation
+	}
+
+	return FinishOther
+}
+
+// fromGenaiError classifies the errors of the genai client
+// by the status of the google api error
+func fromGenaiError(err error) error {
+	var genaiErr genai.APIError
+	if !errors.As(err, &genaiErr) {
+		return err
+	}
+
+	apiErr := &APIError{
+		Kind:       kindFromStatus(genaiErr.Code),
+		StatusCode: genaiErr.Code,
+		Message:    fmt.Sprintf("%d %s: %s", genaiErr.Code, genaiErr.Status, genaiErr.Message),
+		Err:        err,
+	}
+	switch {
+	case genaiErr.Status == "RESOURCE_EXHAUSTED":
+		apiErr.Kind = ErrorQuota
+	case genaiErr.Status == "UNAUTHENTICATED" || genaiErr.Status == "PERMISSION_DENIED":
+		apiErr.Kind = ErrorAuth
+	case strings.Contains(genaiErr.Message, "API key"):
+		// an invalid key is reported as a bad request
+		apiErr.Kind = ErrorAuth
+	}
+	for _, detail := range genaiErr.Details {
+		// google.rpc.RetryInfo carries the delay as a duration string like "30s"
+		if delay, ok := detail["retryDelay"].(string); ok {
+			if d, err := time.ParseDuration(delay); err == nil {
+				apiErr.RetryAfter = d
+			}
+		}
+	}
+
+	return apiErr
+}
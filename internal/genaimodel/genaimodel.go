@@ -1,33 +1,59 @@
 package genaimodel
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"iter"
 	"log"
-	"os"
+	"slices"
 	"strings"
 	"sync"
-
-	// genai is the successor of the previous
-	// generative-ai-go model
-	"google.golang.org/genai"
 )
 
+// cancelledMarker is added to a partial response that was cancelled
+const cancelledMarker = "\n\n[cancelled]"
+
+// confirmInstructionPrompt is send by SendSystemPrompt
+const confirmInstructionPrompt = `Briefly confirm in your own words how you are going to
+  assist with the system instruction you were given.`
+
 const (
+	// modelName is the default gemini model
 	modelName = "gemini-2.0-flash"
 	//modelName = "gemini-2.5-flash-preview-05-20"
 )
 
 type theModel struct {
 	systemInstruction string
-	client            GeminiClientAPI
-	chatHistory       []*genai.Content
+	provider          Provider
+	model             string // the active model of the session
+	chatHistory       []Message
+	tokenBudget       TokenBudget
+	compaction        Compaction
+	contextUsage      ContextUsage // of the last request
+	keepCancelled     bool
+	retryPolicy       RetryPolicy
+	generation        GenerationConfig
+	onThought         func(string)
+	tools             *ToolRegistry
+	approve           Approver
+	continuation      Continuation
+	attachments       []Part           // send with the next chat message
+	findings          []TrackedFinding // of the last review
 }
 
 type ChatResult struct {
 	Response   string
 	ChunkCount int
+	// Thoughts is the reasoning of a thinking model, it is
+	// not part of the Response nor of the chat history
+	Thoughts string
+	// FinishReason tells why the model stopped, like at
+	// the maximum output tokens
+	FinishReason FinishReason
 }
 
 // Action is the interface for the model
@@ -35,62 +61,228 @@ type ChatResult struct {
 // the callback function in the chat is to present
 // intermediate results in the console
 // and to allow for streaming of the response
+// Cancelling the context of a request stops the response, the
+// partial response is returned together with context.Canceled
 type Action interface {
-	SendSystemPrompt(func(string)) (ChatResult, error)
-	ReviewFile(func(string)) (string, error)
+	SendSystemPrompt(context.Context, func(string)) (ChatResult, error)
+	// ReviewFile reviews the diff of the source
+	ReviewFile(context.Context, ReviewSource, func(string)) (string, error)
+	// StructuredReview reviews like ReviewFile, the answer is
+	// JSON with the findings that is returned as a Review
+	StructuredReview(context.Context, ReviewSource, func(string)) (Review, error)
+	// ChunkedReview reviews the batches of a large diff concurrently
+	// and merges their findings, the callback receives the progress
+	// in reviewed files
+	ChunkedReview(context.Context, []ReviewBatch, int, func(done, total int)) (Review, error)
+	// TrackReview keeps the findings of the review with the session, the
+	// returned review leaves out the findings that were resolved or ignored
+	TrackReview(Review) (Review, int)
+	// Findings returns the tracked findings with their status
+	Findings() []TrackedFinding
+	SetFindingStatus(int, FindingStatus) error
 	// ChatMessage provides a callback function for each
 	// chunk of the response. Eventually will return the full
 	// response as a string
-	ChatMessage(string, func(string)) (ChatResult, error)
+	ChatMessage(context.Context, string, func(string)) (ChatResult, error)
 	UpdateSystemInstruction(string)
 	GetHistoryLength() int
+	// SetTokenBudget limits the history that is send with each request
+	SetTokenBudget(TokenBudget)
+	GetContextUsage() ContextUsage
+	// SetCompaction enables the summarization of older turns
+	SetCompaction(Compaction)
+	// PinLastTurn keeps the last question and answer in the
+	// history that is send, even when it is over budget
+	PinLastTurn() bool
+	// SetKeepCancelled sets whether a cancelled partial
+	// response is recorded in the chat history
+	SetKeepCancelled(bool)
+	// SetRetryPolicy configures the retries of failing requests
+	SetRetryPolicy(RetryPolicy)
+	// SetGeneration sets the sampling parameters for the rest of
+	// the session, they are stored with the chat history
+	SetGeneration(GenerationConfig)
+	GetGeneration() GenerationConfig
+	// SetThoughtHandler sets the callback that receives the thoughts
+	// of a thinking model while the response streams
+	SetThoughtHandler(func(string))
+	// SetTools offers the tools to the model in chats and reviews,
+	// nil switches the function calling off
+	SetTools(*ToolRegistry)
+	// SetToolApprover sets the callback that asks the user to approve
+	// the tools that are not read-only, without it they are denied
+	SetToolApprover(Approver)
+	// SetContinuation sets whether answers that are cut off at the
+	// maximum output tokens are continued automatically
+	SetContinuation(Continuation)
+	// ContinueAnswer continues the last answer that was cut off
+	// at the maximum output tokens, in the same history entry
+	ContinueAnswer(context.Context, func(string)) (ChatResult, error)
+	// AddAttachment attaches a file, like a screenshot or a pdf,
+	// to the next chat message
+	AddAttachment(context.Context, string) error
+	// Attachments returns the names of the attached files that
+	// are send with the next chat message
+	Attachments() []string
+	ClearAttachments()
 
 	// Chat History
 	GetChatHistory() ([]byte, error)
-	LoadChatHistory([]byte) ([]*genai.Content, error)
-	GenerateChatSummary() (string, error)
-	ListModels() (string, error)
-}
-
-func NewGeminiClient(ctx context.Context, apiKey string) (GeminiClientAPI, error) {
-	genaiClient, _ := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
-	})
-
-	// we return wrapper to the genai client to support
-	// mocking the actual genaiClient
-	return &genaiClientWrapper{
-		client: genaiClient,
-	}, nil
+	LoadChatHistory([]byte) ([]Message, error)
+	GenerateChatSummary(context.Context) (string, error)
+	ListModels(context.Context) ([]ModelInfo, error)
+	// SetModel sets the active model for the rest of the session
+	SetModel(string)
+	GetModel() string
+	// PullModel downloads a model for local backends, the
+	// callback receives the progress of the download
+	PullModel(context.Context, string, func(string)) error
 }
 
+// NewModel creates the Action on top of a Provider,
+// for example the one returned by NewGeminiProvider
 func NewModel(ctx context.Context,
-	genaiClient GeminiClientAPI,
+	provider Provider,
 	systemInstruction string) (Action, error) {
 
 	return &theModel{
 		systemInstruction: systemInstruction,
-		client:            genaiClient,
+		provider:          provider,
+		model:             provider.DefaultModel(),
+		keepCancelled:     true,
+		onThought:         func(string) {},
 	}, nil
 }
 
-func (m *theModel) ListModels() (string, error) {
-	models, err := m.client.Models().List(context.Background(), &genai.ListModelsConfig{})
+func (m *theModel) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	modelInfos, err := m.provider.ListModels(ctx)
 	if err != nil {
-		return "nil", err
+		return nil, classifyError(err)
 	}
 
-	var modelNames string
-	for _, model := range models.Items {
-		modelNames = modelNames + ", \n" + model.Name
+	return modelInfos, nil
+}
+
+func (m *theModel) SetModel(model string) {
+	m.model = model
+}
+
+func (m *theModel) GetModel() string {
+	return m.model
+}
+
+func (m *theModel) PullModel(ctx context.Context, name string, onStatus func(string)) error {
+	puller, ok := m.provider.(ModelPuller)
+	if !ok {
+		return fmt.Errorf("the %s backend can not pull models", m.provider.Name())
 	}
 
-	return modelNames, nil
+	return puller.PullModel(ctx, name, func(status PullStatus) {
+		onStatus(status.String())
+	})
 }
 func (m *theModel) GetHistoryLength() int {
 	return len(m.chatHistory)
 }
+
+func (m *theModel) SetTokenBudget(budget TokenBudget) {
+	m.tokenBudget = budget
+}
+
+func (m *theModel) GetContextUsage() ContextUsage {
+	return m.contextUsage
+}
+
+func (m *theModel) SetCompaction(compaction Compaction) {
+	m.compaction = compaction
+}
+
+func (m *theModel) PinLastTurn() bool {
+	pinned := false
+	for i := len(m.chatHistory) - 1; i >= 0; i-- {
+		m.chatHistory[i].Pinned = true
+		pinned = true
+		if m.chatHistory[i].Role == RoleUser {
+			break
+		}
+	}
+
+	return pinned
+}
+
+func (m *theModel) SetKeepCancelled(keep bool) {
+	m.keepCancelled = keep
+}
+
+func (m *theModel) SetRetryPolicy(retryPolicy RetryPolicy) {
+	m.retryPolicy = retryPolicy
+}
+
+func (m *theModel) SetGeneration(generation GenerationConfig) {
+	m.generation = generation
+}
+
+func (m *theModel) GetGeneration() GenerationConfig {
+	return m.generation
+}
+
+func (m *theModel) SetThoughtHandler(onThought func(string)) {
+	m.onThought = onThought
+}
+
+// answerParts passes the thoughts of a chunk to the thought handler
+// and collects them, it returns the parts that make up the answer
+func (m *theModel) answerParts(parts []Part, thoughts *strings.Builder) []Part {
+	var answer []Part
+	for _, part := range parts {
+		if part.Thought {
+			m.onThought(part.Text)
+			thoughts.WriteString(part.Text)
+			continue
+		}
+		answer = append(answer, part)
+	}
+
+	return answer
+}
+
+// recordTurn adds the question and the answer to the history, the
+// question is only added once the answer is complete so that a
+// failed request leaves no unanswered question behind
+func (m *theModel) recordTurn(question Message, answer string) {
+	m.chatHistory = append(m.chatHistory, question)
+	m.addModelResponse(answer)
+}
+
+// recordCancelled adds the question with the partial answer of a
+// cancelled request to the history, or leaves the request out of
+// the history entirely when cancelled responses are not kept. It
+// reports whether the turn was added.
+func (m *theModel) recordCancelled(question Message, partial string) bool {
+	if !m.keepCancelled || partial == "" {
+		return false
+	}
+	m.recordTurn(question, partial+cancelledMarker)
+
+	return true
+}
+
+// addModelResponse adds the answer to the history together
+// with the system instruction it was generated with
+func (m *theModel) addModelResponse(text string) {
+	modelResponse := NewTextMessage(text, RoleModel)
+	modelResponse.SystemInstruction = m.systemInstruction
+	m.chatHistory = append(m.chatHistory, modelResponse)
+}
+
+// isCancelled reports whether the request stopped because the
+// caller cancelled the context
+func isCancelled(ctx context.Context, err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled)
+}
+
+// UpdateSystemInstruction sets the instruction that is send
+// with the next requests, the history is left as it is
 func (m *theModel) UpdateSystemInstruction(systemInstruction string) {
 	m.systemInstruction = systemInstruction
 }
@@ -113,13 +305,14 @@ func (m *theModel) UpdateSystemInstruction(systemInstruction string) {
 //
 //	moment, any remaining chunks are going to be consumed
 //	and not raised in the callback.
-func (m *theModel) ChatMessage(userPrompt string, onChunk func(string)) (ChatResult, error) {
+func (m *theModel) ChatMessage(ctx context.Context, userPrompt string, onChunk func(string)) (ChatResult, error) {
 	// Use context for cancellation. This is the primary way to signal goroutines to stop.
-	ctx, cancel := context.WithCancel(context.Background())
+	// The streamCtx is also cancelled when the caller cancels ctx
+	streamCtx, cancel := context.WithCancel(ctx)
 	defer cancel() // Ensure context is cancelled when ChatMessage returns, signaling cleanup
 
 	// Create a buffered channel to process chunks.
-	chunkChan := make(chan string, 100)
+	chunkChan := make(chan Part, 100)
 
 	// Use a WaitGroup to ensure the chunk processing goroutine finishes before `ChatMessage` exits.
 	var wg sync.WaitGroup
@@ -148,30 +341,39 @@ func (m *theModel) ChatMessage(userPrompt string, onChunk func(string)) (ChatRes
 					log.Println("Chunk processing goroutine: Chunk channel closed, exiting.")
 					return // Exit the select loop, then run the draining defer
 				}
-				onChunk(chunk)
+				if chunk.Thought {
+					m.onThought(chunk.Text)
+				} else {
+					onChunk(chunk.Text)
+				}
 
-			case <-ctx.Done(): // Context cancelled (signal to stop)
+			case <-streamCtx.Done(): // Context cancelled (signal to stop)
 				log.Println("Chunk processing goroutine: Context cancelled, exiting.")
 				return // Exit the select loop, then run the draining defer
 			}
 		}
 	}()
-	// Add user prompt to chat history
-	m.chatHistory = append(m.chatHistory, genai.NewContentFromText(userPrompt, genai.RoleUser))
-
-	// Create chat with history
-	chat, err := m.client.ChatCreate().Create(ctx, modelName, nil, m.chatHistory)
-	if err != nil {
-		// If chat creation fails, immediately return and cancel context.
-		cancel()
-		close(chunkChan)
-		wg.Wait()
-		return ChatResult{}, err
+	// Summarize older turns when the history grows too long
+	m.compactHistory(streamCtx)
+
+	// The history holds the earlier turns, the user prompt is send
+	// as the new message and is added to the history with the answer,
+	// the attached files come before the prompt
+	question := Message{
+		Parts: append(slices.Clone(m.attachments), Part{Text: userPrompt}),
+		Role:  RoleUser,
 	}
 
 	// Send message to the model using streaming
-	stream := chat.SendMessageStream(ctx, genai.Part{Text: userPrompt})
+	stream := m.continued(streamCtx, m.fitRequest(streamCtx, Request{
+		Model:             m.model,
+		SystemInstruction: m.systemInstruction,
+		History:           m.requestHistory(),
+		Message:           question,
+		Generation:        m.generation,
+	}), "", m.generate)
 	var fullString strings.Builder
+	var thoughts strings.Builder
 	var chunkCount int
 	var streamErr error // to capture a streamErr if it occurs
 	// Loop through the stream responses.
@@ -183,28 +385,30 @@ func (m *theModel) ChatMessage(userPrompt string, onChunk func(string)) (ChatRes
 			streamErr = err
 			break // exit the loop
 		}
-		// defensive check on received respChunk
-		if respChunk == nil || len(respChunk.Candidates) == 0 || respChunk.Candidates[0].Content == nil || len(respChunk.
-			Candidates[0].Content.Parts) == 0 {
-			log.Println("Received nil or malformed chunk from stream (no explicit error reported).")
-			// Decide how to handle this. You might want to treat it as an error and break,
-			// or just skip this malformed chunk if acceptable.
-			// For robustness, treating it as an error is safer:
-			streamErr = errors.New("received malformed chunk data")
-			break
+		// chunks that only carry the usage or the finish reason have
+		// no parts, the stream already recorded those in the context usage
+		if respChunk == nil || len(respChunk.Parts) == 0 {
+			continue
 		}
-		part := respChunk.Candidates[0].Content.Parts[0] // Potential nil dereference if respChunk is nil!
-		select {
-		case chunkChan <- part.Text:
-			// Send chunk to channel
-		default:
-			// If channel and channel buffer is full, discard
-			// sending the chunk to the channelprocess - the UI
-			// is simply too slow to keep up, but will eventually
-			// get the final result
+		for _, part := range respChunk.Parts {
+			select {
+			case chunkChan <- part:
+				// Send chunk to channel
+			default:
+				// If channel and channel buffer is full, discard
+				// sending the chunk to the channelprocess - the UI
+				// is simply too slow to keep up, but will eventually
+				// get the final result
+			}
+			// thoughts are returned apart from the answer and are
+			// not added to the history
+			if part.Thought {
+				thoughts.WriteString(part.Text)
+				continue
+			}
+			fullString.WriteString(part.Text)
+			chunkCount++
 		}
-		fullString.WriteString(part.Text)
-		chunkCount++
 	}
 
 	cancel()         // Signal the goroutine to stop processing chunks
@@ -212,11 +416,30 @@ func (m *theModel) ChatMessage(userPrompt string, onChunk func(string)) (ChatRes
 	// Wait for the chunk processing goroutine to finish its cleanup.
 	wg.Wait()
 
-	if streamErr != nil {
-		log.Printf("Stream error: %v\n", streamErr)
+	if isCancelled(ctx, streamErr) {
+		log.Println("Chat message cancelled")
+		// a turn that is not recorded keeps the attachments for a retry
+		if m.recordCancelled(question, fullString.String()) {
+			m.ClearAttachments()
+		}
 		return ChatResult{
 			Response:   fullString.String(),
 			ChunkCount: chunkCount,
+			Thoughts:   thoughts.String(),
+		}, context.Canceled
+	}
+
+	if streamErr == nil {
+		// an answer that was blocked is not added to the history
+		streamErr = finishError(m.contextUsage.FinishReason)
+	}
+	if streamErr != nil {
+		log.Printf("Stream error: %v\n", streamErr)
+		return ChatResult{
+			Response:     fullString.String(),
+			ChunkCount:   chunkCount,
+			Thoughts:     thoughts.String(),
+			FinishReason: m.contextUsage.FinishReason,
 		}, streamErr
 	}
 
@@ -229,145 +452,188 @@ func (m *theModel) ChatMessage(userPrompt string, onChunk func(string)) (ChatRes
 	}
 
 	chatResponse := fullString.String()
-	modelResponse := genai.NewContentFromText(chatResponse, genai.RoleModel)
-	m.chatHistory = append(m.chatHistory, modelResponse)
-
-	return ChatResult{chatResponse, chunkCount}, nil
+	m.recordTurn(question, chatResponse)
+	// a failed message keeps the attachments for a retry
+	m.ClearAttachments()
+
+	return ChatResult{
+		Response:     chatResponse,
+		ChunkCount:   chunkCount,
+		Thoughts:     thoughts.String(),
+		FinishReason: m.contextUsage.FinishReason,
+	}, nil
 }
 
-func (m *theModel) SendSystemPrompt(onChunk func(string)) (ChatResult, error) {
-	ctx := context.Background()
-	// Add the prompt to the chat history to not forget about it
-	m.chatHistory = append(m.chatHistory, genai.NewContentFromText(m.systemInstruction, genai.RoleModel))
-
-	// Create chat with history
-	chat, err := m.client.ChatCreate().Create(ctx, modelName, nil, m.chatHistory)
-	if err != nil {
-		return ChatResult{}, err
-	}
-
+// SendSystemPrompt asks the model to confirm the active system
+// instruction. The instruction itself is send with every request,
+// so neither the question nor the confirmation is added to the history.
+func (m *theModel) SendSystemPrompt(ctx context.Context, onChunk func(string)) (ChatResult, error) {
 	log.Println(m.systemInstruction)
 	// Send message to the model using streaming
-	stream := chat.SendMessageStream(ctx, *genai.NewPartFromText(m.systemInstruction))
+	stream := m.stream(ctx, m.fitRequest(ctx, Request{
+		Model:             m.model,
+		SystemInstruction: m.systemInstruction,
+		History:           m.requestHistory(),
+		Message:           NewTextMessage(confirmInstructionPrompt, RoleUser),
+		Generation:        m.generation,
+	}))
 
 	// process response
-	var allModelParts []*genai.Part
+	var allModelParts []Part
+	var thoughts strings.Builder
 	var chunkCounter int
 	for chunk, err := range stream {
 		if err != nil {
 			log.Printf("Error receiving stream: %v", err)
 
-			fullString := buildString(allModelParts)
+			result := ChatResult{
+				Response:   buildString(allModelParts),
+				ChunkCount: chunkCounter,
+				Thoughts:   thoughts.String(),
+			}
+			if isCancelled(ctx, err) {
+				return result, context.Canceled
+			}
 
-			return ChatResult{fullString, chunkCounter}, err
+			return result, err
 		}
 
-		part := chunk.Candidates[0].Content.Parts[0]
-		onChunk(part.Text)
-		allModelParts = append(allModelParts, part)
+		answer := m.answerParts(chunk.Parts, &thoughts)
+		for _, part := range answer {
+			onChunk(part.Text)
+		}
+		allModelParts = append(allModelParts, answer...)
 		chunkCounter++
 	}
 
-	fullString := buildString(allModelParts)
+	result := ChatResult{
+		Response:     buildString(allModelParts),
+		ChunkCount:   chunkCounter,
+		Thoughts:     thoughts.String(),
+		FinishReason: m.contextUsage.FinishReason,
+	}
 
-	return ChatResult{fullString, chunkCounter}, nil
+	return result, finishError(result.FinishReason)
 }
 
-// ReviewFile revies the "gitdiff.txt" file
-func (m *theModel) ReviewFile(onChunk func(string)) (string, error) {
-	filePart, fileUri := m.addAFile(context.Background(), m.client)
-	log.Printf("fileUri is %s", fileUri)
+// reviewPrompt asks for a review in markdown
+const reviewPrompt = `* Do not include the provided diff output in the response.
+
+		The file {fileUri} contains the git diff output to be reviewed.
+
+		AI OUTPUT:`
+
+// ReviewSource is the diff, or any other text, to review
+type ReviewSource struct {
+	// Name tells the model and the user where the contents
+	// come from, like "gitdiff.txt" or "git diff --staged"
+	Name     string
+	Contents []byte
+}
+
+// ReviewFile reviews the contents of the source
+func (m *theModel) ReviewFile(ctx context.Context, source ReviewSource, onChunk func(string)) (string, error) {
+	return m.review(ctx, source, reviewPrompt, nil, onChunk)
+}
 
-	// Start with chatHistory
-	genaiContents := append([]*genai.Content{}, m.chatHistory...)
+// review sends the source with the prompt, with a schema the answer
+// is JSON that matches the schema. The backends do not combine function
+// calling with a response schema, so with a schema the tools are left
+// out of the request.
+func (m *theModel) review(ctx context.Context, source ReviewSource, prompt string, schema *Schema,
+	onChunk func(string)) (string, error) {
+	filePart, fileUri, err := m.uploadSource(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("fileUri is %s", fileUri)
+	m.compactHistory(ctx)
 
 	// we first create a Part for file,
 	// later we add an additional part
 	// to this slice to add the Command below
-	parts := []*genai.Part{
+	parts := []Part{
 		filePart,
 	}
 
-	fileContent := genai.NewContentFromParts(parts, genai.RoleUser)
-
-	// Include fileContent
-	genaiContents = append(genaiContents, fileContent)
+	commandText := strings.Replace(prompt, "{fileUri}", fileUri, 1)
 
-	config := &genai.GenerateContentConfig{
-		SystemInstruction: genai.NewContentFromText(m.systemInstruction, genai.RoleModel),
+	// add command as additional part
+	// to the file contents
+	parts = append(parts, Part{Text: commandText})
+	question := Message{Parts: parts, Role: RoleUser}
+
+	req := m.fitRequest(ctx, Request{
+		Model:             m.model,
+		SystemInstruction: m.systemInstruction,
+		History:           m.requestHistory(),
+		Message:           question,
+		Generation:        m.generation,
+		ResponseSchema:    schema,
+	})
+	var stream iter.Seq2[*Response, error]
+	if schema != nil {
+		if tools := m.tools.Declarations(); len(tools) > 0 {
+			log.Printf("The %d tools are left out of the request with a response schema", len(tools))
+		}
+		stream = m.continued(ctx, req, "", m.stream)
+	} else {
+		stream = m.continued(ctx, req, "", m.generate)
 	}
 
-	commandText := `* Do not include the provided diff output in the response.
-
-		The file {fileUri} contains the git diff output to be reviewed.
-
-		AI OUTPUT:`
-	commandText = strings.Replace(commandText, "{fileUri}", fileUri, 1)
-
-	// add command as additional part
-	// to the last item in the genaiContents
-	genaiCommandPart := &genai.Part{Text: commandText}
-	lastContentPart := len(genaiContents) - 1
-	genaiContents[lastContentPart].Parts = append(genaiContents[lastContentPart].Parts, genaiCommandPart)
-
-	// add the command text to the file contents
-	//genaiCommandText := genai.Text(commandText)
-	//genaiContents = append(genaiContents, genaiCommandText...)
-	stream := m.client.Models().GenerateContentStream(
-		context.Background(),
-		modelName,
-		genaiContents,
-		config,
-	)
-
-	var allModelParts []*genai.Part
+	var allModelParts []Part
+	var thoughts strings.Builder
 
 	for chunk, err := range stream {
 		if err != nil {
+			if isCancelled(ctx, err) {
+				partial := buildString(allModelParts)
+				m.recordCancelled(question, partial)
+				return partial, context.Canceled
+			}
 			return "", err
 
 		}
-		part := chunk.Candidates[0].Content.Parts[0]
-		onChunk(part.Text) // raise callback func
-		allModelParts = append(allModelParts, part)
+		answer := m.answerParts(chunk.Parts, &thoughts)
+		for _, part := range answer {
+			onChunk(part.Text) // raise callback func
+		}
+		allModelParts = append(allModelParts, answer...)
 
 	}
 
 	fullString := buildString(allModelParts)
+	if err := finishError(m.contextUsage.FinishReason); err != nil {
+		return fullString, err
+	}
 
 	// Combine all parts into a single part and add to chat history
-	modelResponse := genai.NewContentFromText(fullString, genai.RoleModel)
-	m.chatHistory = append(m.chatHistory, modelResponse)
+	m.recordTurn(question, fullString)
 
 	return fullString, nil
 }
 
-// uploads a file to gemini
-func (m *theModel) addAFile(ctx context.Context, client GeminiClientAPI) (*genai.Part, string) {
-	// during the chat, we can continuously update the below file by providing
-	// a different diff. For example to get a diff for a golang repository,
-	// we can issue the following command:
-	// git diff -U10 7c904..dcfc69 -- . ':!vendor' > gitdiff.txt
-	// the hashes are examples from two consecutive git hashes found when
-	// simply doing a "git log" statement. Put the oldest hash first so that added
-	// lines get a + and removed lines get a -, or you get it backwards.
-	// note that the "-- . `:! vendor` part is to ignore the vendor file, as we are
-	// only interested in actual updates of changes.
-	fileContents, err := os.Open("./gitdiff.txt")
-	if err != nil {
-		panic(err)
+// uploadSource uploads the contents of the source to the provider,
+// it returns the part that refers to it and the name of the file
+func (m *theModel) uploadSource(ctx context.Context, source ReviewSource) (Part, string, error) {
+	if len(bytes.TrimSpace(source.Contents)) == 0 {
+		return Part{}, "", fmt.Errorf("nothing to review, %s is empty", source.Name)
 	}
-	upFile, err := client.Files().Upload(ctx, fileContents, &genai.UploadFileConfig{
-		MIMEType: "text/plain",
-	})
+	filePart, err := m.provider.UploadFile(ctx, bytes.NewReader(source.Contents), "text/plain")
 	if err != nil {
-		panic(err)
+		return Part{}, "", fmt.Errorf("uploading %s: %w", source.Name, err)
 	}
 
-	return genai.NewPartFromURI(upFile.URI, upFile.MIMEType), upFile.URI
+	// providers without file storage inline the contents
+	fileUri := source.Name
+	if filePart.FileData != nil {
+		fileUri = filePart.FileData.FileURI
+	}
+
+	return filePart, fileUri, nil
 }
 
-func buildString(resp []*genai.Part) string {
+func buildString(resp []Part) string {
 	var build strings.Builder
 	for _, p := range resp {
 
@@ -377,39 +643,62 @@ func buildString(resp []*genai.Part) string {
 	return build.String()
 }
 
-func (m *theModel) GenerateChatSummary() (string, error) {
-	ctx := context.Background()
-
-	chat, err := m.client.ChatCreate().Create(ctx, modelName, nil, m.chatHistory)
-	if err != nil {
-		return "", err
-	}
-
+func (m *theModel) GenerateChatSummary(ctx context.Context) (string, error) {
 	// Craft the prompt for the AI model
 	prompt := `Summarize the chat history in approximately 10-15 keywords, suitable for use in
   a filename.  Do not include punctuation or special characters.
   Only respond with the summary for the filename`
 
 	// Send the message to the model
-	prt := genai.Part{Text: prompt}
-	resp, err := chat.SendMessage(ctx, prt) // Use SendMessage instead of SendMessageStream
+	summary, err := collectText(m.stream(ctx, m.fitRequest(ctx, Request{
+		Model:             m.model,
+		SystemInstruction: m.systemInstruction,
+		History:           m.requestHistory(),
+		Message:           NewTextMessage(prompt, RoleUser),
+	})))
 	if err != nil {
 		return "", err
 	}
 
-	summary := resp.Candidates[0].Content.Parts[0].Text
-
-	return string(summary), nil
+	return summary, nil
 }
 
-func (m *theModel) LoadChatHistory(jsonData []byte) ([]*genai.Content, error) {
-	err := json.Unmarshal(jsonData, &m.chatHistory)
+// LoadChatHistory restores the history, when the stored chat
+// contains the model, the generation parameters or the system
+// instruction of the last answer those become active again
+func (m *theModel) LoadChatHistory(jsonData []byte) ([]Message, error) {
+	var chat savedChat
+	err := json.Unmarshal(jsonData, &chat)
 	if err != nil {
 		return nil, err
 	}
+	m.chatHistory = chat.History
+	m.findings = chat.Findings
+	if chat.Model != "" {
+		m.model = chat.Model
+	}
+	if chat.Generation != nil {
+		m.generation = *chat.Generation
+	}
+	// continue with the instruction of the last answer
+	for i := len(m.chatHistory) - 1; i >= 0; i-- {
+		if m.chatHistory[i].SystemInstruction != "" {
+			m.systemInstruction = m.chatHistory[i].SystemInstruction
+			break
+		}
+	}
 	return m.chatHistory, nil
 }
 
 func (m *theModel) GetChatHistory() ([]byte, error) {
-	return json.Marshal(m.chatHistory)
+	chat := savedChat{
+		Model:    m.model,
+		History:  m.chatHistory,
+		Findings: m.findings,
+	}
+	if !m.generation.IsZero() {
+		chat.Generation = &m.generation
+	}
+
+	return json.Marshal(chat)
 }
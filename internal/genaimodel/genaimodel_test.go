@@ -2,8 +2,12 @@ package genaimodel
 
 import (
 	"context"
+	"errors"
 	"iter"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -26,7 +30,7 @@ func TestChatSlowChunkProcessing(t *testing.T) {
 	mockClient := NewMockGeminiClientAPI(ctrl)
 
 	// Arrange subject under test
-	model, err := NewModel(context.Background(), mockClient, "system instruction be kind")
+	model, err := NewModel(context.Background(), NewGeminiProvider(mockClient), "system instruction be kind")
 	if err != nil {
 		t.Fatalf("Failed to create model: %v", err)
 	}
@@ -40,7 +44,11 @@ func TestChatSlowChunkProcessing(t *testing.T) {
 	)
 
 	mockChatCreateServiceAPI := NewMockChatCreateServiceAPI(ctrl)
-	mockChatCreateServiceAPI.EXPECT().Create(gomock.Any(), modelName, nil, gomock.Any()).
+	// the system instruction is send with every chat message
+	withSystemInstruction := gomock.Cond(func(config *genai.GenerateContentConfig) bool {
+		return config != nil && config.SystemInstruction.Parts[0].Text == "system instruction be kind"
+	})
+	mockChatCreateServiceAPI.EXPECT().Create(gomock.Any(), modelName, withSystemInstruction, gomock.Any()).
 		Return(mockChatSessionAPI, nil)
 
 		// Arrange expected calls, wire up our mock Func to the assumed client.ChatCreate field
@@ -60,7 +68,7 @@ func TestChatSlowChunkProcessing(t *testing.T) {
 	// Act!
 	// When 50 chunks of 100ms take 5 seconds, but the UI is not able to handle the chunks that fast,
 	// then the returned chatResult should still contain all chunks
-	chatResult, err := model.ChatMessage("hello world", chunkReceiver)
+	chatResult, err := model.ChatMessage(context.Background(), "hello world", chunkReceiver)
 
 	if err != nil {
 		t.Fatalf("ChatMessage failed: %v", err)
@@ -94,3 +102,242 @@ func SimulateModelChunks(chunkCount int, chunkDuration time.Duration) func(yield
 
 	}
 }
+
+// TestChatMessageReusesGeminiChat proves that each question is send once,
+// as the new message of a chat session that is reused for the next question
+func TestChatMessageReusesGeminiChat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := NewMockGeminiClientAPI(ctrl)
+	model, err := NewModel(context.Background(), NewGeminiProvider(mockClient), "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+
+	var sent []string
+	mockChatSessionAPI := NewMockChatSessionAPI(ctrl)
+	mockChatSessionAPI.EXPECT().SendMessageStream(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, parts ...genai.Part) iter.Seq2[*genai.GenerateContentResponse, error] {
+			sent = append(sent, parts[0].Text)
+			return SimulateModelChunks(1, 0)
+		},
+	).Times(2)
+
+	// the session starts with an empty history and is created only once
+	mockChatCreateServiceAPI := NewMockChatCreateServiceAPI(ctrl)
+	mockChatCreateServiceAPI.EXPECT().Create(gomock.Any(), modelName, nil, gomock.Len(0)).
+		Return(mockChatSessionAPI, nil)
+	mockClient.EXPECT().ChatCreate().Return(mockChatCreateServiceAPI)
+
+	for _, question := range []string{"first", "second"} {
+		if _, err := model.ChatMessage(context.Background(), question, func(string) {}); err != nil {
+			t.Fatalf("ChatMessage failed: %v", err)
+		}
+	}
+
+	if len(sent) != 2 || sent[0] != "first" || sent[1] != "second" {
+		t.Errorf("unexpected messages %v", sent)
+	}
+	if model.GetHistoryLength() != 4 {
+		t.Errorf("expected 4 history items, got %d", model.GetHistoryLength())
+	}
+}
+
+func TestFailedChatMessageLeavesNoQuestion(t *testing.T) {
+	provider := &failingProvider{
+		errs: []error{&APIError{Kind: ErrorAuth, Message: "401 Unauthorized"}},
+	}
+	model, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+
+	if _, err := model.ChatMessage(context.Background(), "hi", func(string) {}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if model.GetHistoryLength() != 0 {
+		t.Errorf("expected an empty history, got %d items", model.GetHistoryLength())
+	}
+}
+
+// blockingProvider yields one chunk and then waits
+// until the request is cancelled
+type blockingProvider struct {
+	fakeProvider
+}
+
+func (b *blockingProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		if !yield(&Response{Parts: []Part{{Text: "partial"}}}, nil) {
+			return
+		}
+		<-ctx.Done()
+		yield(nil, ctx.Err())
+	}
+}
+
+func TestChatMessageCancelled(t *testing.T) {
+	for _, keep := range []bool{true, false} {
+		model, err := NewModel(context.Background(), &blockingProvider{}, "")
+		if err != nil {
+			t.Fatalf("Failed to create model: %v", err)
+		}
+		model.SetKeepCancelled(keep)
+		attachment := filepath.Join(t.TempDir(), "app.log")
+		if err := os.WriteFile(attachment, []byte("panic: nil map\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := model.AddAttachment(context.Background(), attachment); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		result, err := model.ChatMessage(ctx, "hello", func(string) { cancel() })
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		if result.Response != "partial" {
+			t.Errorf("expected the partial response, got %q", result.Response)
+		}
+		expectedLength := 0
+		if keep {
+			expectedLength = 2
+		}
+		if model.GetHistoryLength() != expectedLength {
+			t.Errorf("keep %v: expected %d history items, got %d", keep, expectedLength, model.GetHistoryLength())
+		}
+		// the attachments are sent again by a retry when the turn was not kept
+		if attached := len(model.Attachments()) == 1; attached == keep {
+			t.Errorf("keep %v: unexpected attachments %v", keep, model.Attachments())
+		}
+	}
+}
+
+func TestSystemInstructionIsSendWithEveryRequest(t *testing.T) {
+	provider := &fakeProvider{chunks: []string{"ok"}}
+	model, err := NewModel(context.Background(), provider, "be kind")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+
+	if _, err := model.ChatMessage(context.Background(), "hi", func(string) {}); err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	model.UpdateSystemInstruction("be brief")
+	if _, err := model.SendSystemPrompt(context.Background(), func(string) {}); err != nil {
+		t.Fatalf("SendSystemPrompt failed: %v", err)
+	}
+	if _, err := model.ChatMessage(context.Background(), "again", func(string) {}); err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+
+	expected := []string{"be kind", "be brief", "be brief"}
+	for i, req := range provider.requests {
+		if req.SystemInstruction != expected[i] {
+			t.Errorf("request %d: expected instruction %q, got %q", i, expected[i], req.SystemInstruction)
+		}
+	}
+	// confirming the instruction leaves the history alone
+	if model.GetHistoryLength() != 4 {
+		t.Fatalf("expected 4 history items, got %d", model.GetHistoryLength())
+	}
+
+	jsonData, err := model.GetChatHistory()
+	if err != nil {
+		t.Fatalf("GetChatHistory failed: %v", err)
+	}
+	reloaded, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	history, err := reloaded.LoadChatHistory(jsonData)
+	if err != nil {
+		t.Fatalf("LoadChatHistory failed: %v", err)
+	}
+	if history[1].SystemInstruction != "be kind" || history[3].SystemInstruction != "be brief" {
+		t.Errorf("unexpected recorded instructions %+v", history)
+	}
+	if _, err := reloaded.ChatMessage(context.Background(), "more", func(string) {}); err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	if last := provider.requests[len(provider.requests)-1]; last.SystemInstruction != "be brief" {
+		t.Errorf("expected the reloaded chat to continue with the last instruction, got %q", last.SystemInstruction)
+	}
+}
+
+// scriptedProvider answers every request with the same responses
+type scriptedProvider struct {
+	fakeProvider
+	responses []*Response
+}
+
+func (s *scriptedProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		for _, resp := range s.responses {
+			if !yield(resp, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestChatMessageFinishReasons(t *testing.T) {
+	provider := &scriptedProvider{responses: []*Response{
+		{Usage: &Usage{InputTokens: 10}},
+		{Parts: []Part{{Text: "Hello"}, {Text: " world"}}},
+		{FinishReason: FinishMaxTokens},
+	}}
+	model, _ := NewModel(context.Background(), provider, "")
+
+	// chunks with only the usage or the finish reason are no error
+	result, err := model.ChatMessage(context.Background(), "hi", func(string) {})
+	if err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	if result.Response != "Hello world" || result.FinishReason != FinishMaxTokens {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if usage := model.GetContextUsage().String(); !strings.HasSuffix(usage, "cut off at the maximum output tokens") {
+		t.Errorf("expected the finish reason in the usage, got %q", usage)
+	}
+
+	// a blocked answer is an error and is not added to the history
+	provider.responses = []*Response{{Parts: []Part{{Text: "Well"}}}, {FinishReason: FinishSafety}}
+	result, err = model.ChatMessage(context.Background(), "and now?", func(string) {})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != ErrorSafety || result.Response != "Well" {
+		t.Errorf("expected a safety error with the partial answer, got %+v, %v", result, err)
+	}
+	if model.GetHistoryLength() != 2 {
+		t.Errorf("expected only the first turn in the history, got %d messages", model.GetHistoryLength())
+	}
+}
+
+func TestGeminiResponseParts(t *testing.T) {
+	resp := fromGenaiResponse(&genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{
+			FinishReason: genai.FinishReasonMaxTokens,
+			Content: &genai.Content{Parts: []*genai.Part{
+				{Text: "Let me compute it."},
+				{ExecutableCode: &genai.ExecutableCode{Language: genai.LanguagePython, Code: "print(6*7)\n"}},
+				{CodeExecutionResult: &genai.CodeExecutionResult{Outcome: genai.OutcomeOK, Output: "42\n"}},
+				{InlineData: &genai.Blob{MIMEType: "image/png", Data: []byte("png")}},
+			}},
+		}},
+	})
+	expected := "Let me compute it.\n```python\nprint(6*7)\n```\n" +
+		"\nOutput (outcome_ok):\n```\n42\n```\n\n[image/png data of 3 bytes]\n"
+	if text := buildString(resp.Parts); text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+	if resp.FinishReason != FinishMaxTokens {
+		t.Errorf("unexpected finish reason %q", resp.FinishReason)
+	}
+
+	resp = fromGenaiResponse(&genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonProhibitedContent}},
+	})
+	if len(resp.Parts) != 0 || resp.FinishReason != FinishSafety {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
@@ -0,0 +1,86 @@
+package genaimodel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GenerationConfig holds the sampling parameters of the requests.
+// Nil and zero values leave the default of the backend in place.
+type GenerationConfig struct {
+	Temperature     *float32 `json:"temperature,omitempty"`
+	TopP            *float32 `json:"topP,omitempty"`
+	TopK            *int     `json:"topK,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	Seed            *int     `json:"seed,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+	// ThinkingBudget is the number of tokens a thinking model can
+	// use to reason before it answers, 0 disables the thinking
+	// and -1 lets the model decide
+	ThinkingBudget *int `json:"thinkingBudget,omitempty"`
+}
+
+// thinking is true when the model is asked to think and to return its thoughts
+func (gc GenerationConfig) thinking() bool {
+	return gc.ThinkingBudget != nil && *gc.ThinkingBudget != 0
+}
+
+// IsZero is true when no parameter is set
+func (gc GenerationConfig) IsZero() bool {
+	return gc.Temperature == nil && gc.TopP == nil && gc.TopK == nil &&
+		gc.MaxOutputTokens == 0 && gc.Seed == nil && len(gc.StopSequences) == 0 &&
+		gc.ThinkingBudget == nil
+}
+
+// String lists the parameters that are set, like "temperature 0.2, seed 42"
+func (gc GenerationConfig) String() string {
+	var params []string
+	if gc.Temperature != nil {
+		params = append(params, fmt.Sprintf("temperature %g", *gc.Temperature))
+	}
+	if gc.TopP != nil {
+		params = append(params, fmt.Sprintf("top-p %g", *gc.TopP))
+	}
+	if gc.TopK != nil {
+		params = append(params, fmt.Sprintf("top-k %d", *gc.TopK))
+	}
+	if gc.MaxOutputTokens != 0 {
+		params = append(params, fmt.Sprintf("max %d tokens", gc.MaxOutputTokens))
+	}
+	if gc.Seed != nil {
+		params = append(params, fmt.Sprintf("seed %d", *gc.Seed))
+	}
+	if len(gc.StopSequences) != 0 {
+		params = append(params, fmt.Sprintf("stop %q", gc.StopSequences))
+	}
+	if gc.ThinkingBudget != nil {
+		params = append(params, fmt.Sprintf("thinking budget %d", *gc.ThinkingBudget))
+	}
+	if len(params) == 0 {
+		return "default parameters"
+	}
+
+	return strings.Join(params, ", ")
+}
+
+// Validate checks the parameters are within the ranges
+// that the backends accept
+func (gc GenerationConfig) Validate() error {
+	if gc.Temperature != nil && (*gc.Temperature < 0 || *gc.Temperature > 2) {
+		return fmt.Errorf("temperature %g is not between 0 and 2", *gc.Temperature)
+	}
+	if gc.TopP != nil && (*gc.TopP < 0 || *gc.TopP > 1) {
+		return fmt.Errorf("top-p %g is not between 0 and 1", *gc.TopP)
+	}
+	if gc.TopK != nil && *gc.TopK < 1 {
+		return fmt.Errorf("top-k %d is not positive", *gc.TopK)
+	}
+	if gc.MaxOutputTokens < 0 {
+		return fmt.Errorf("max output tokens %d is negative", gc.MaxOutputTokens)
+	}
+	if gc.ThinkingBudget != nil && *gc.ThinkingBudget < -1 {
+		return fmt.Errorf("thinking budget %d is not -1 or more", *gc.ThinkingBudget)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package genaimodel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGenerationIsSendWithChatMessage(t *testing.T) {
+	provider := &fakeProvider{chunks: []string{"ok"}}
+	model, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	seed := 42
+	model.SetGeneration(GenerationConfig{Seed: &seed, MaxOutputTokens: 100})
+
+	if _, err := model.ChatMessage(context.Background(), "hi", func(string) {}); err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	generation := provider.requests[0].Generation
+	if generation.Seed == nil || *generation.Seed != 42 || generation.MaxOutputTokens != 100 {
+		t.Errorf("unexpected generation %s", generation)
+	}
+}
+
+func TestGenerationValidate(t *testing.T) {
+	temperature, topP, topK := float32(2.5), float32(0.9), 0
+	tests := []struct {
+		config  GenerationConfig
+		wantErr bool
+	}{
+		{GenerationConfig{}, false},
+		{GenerationConfig{TopP: &topP}, false},
+		{GenerationConfig{Temperature: &temperature}, true},
+		{GenerationConfig{TopK: &topK}, true},
+		{GenerationConfig{MaxOutputTokens: -1}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error %v", tt.config, err)
+		}
+	}
+}
+
+func TestOllamaSendsOptions(t *testing.T) {
+	var received ollamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		_, _ = fmt.Fprintln(w, `{"message":{"role":"assistant","content":"ok"},"done":true}`)
+	}))
+	defer server.Close()
+
+	temperature := float32(0.1)
+	provider := NewOllamaProvider(OllamaConfig{BaseURL: server.URL})
+	_, err := collectText(provider.Stream(context.Background(), Request{
+		Message:    NewTextMessage("hi", RoleUser),
+		Generation: GenerationConfig{Temperature: &temperature, MaxOutputTokens: 50},
+	}))
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if received.Options == nil || *received.Options.Temperature != 0.1 || received.Options.NumPredict != 50 {
+		t.Errorf("unexpected options %+v", received.Options)
+	}
+}
+
+// thinkingProvider answers with a thought before the answer
+type thinkingProvider struct {
+	fakeProvider
+}
+
+func (tp *thinkingProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	tp.requests = append(tp.requests, req)
+	return func(yield func(*Response, error) bool) {
+		if !yield(&Response{Parts: []Part{{Text: "let me think", Thought: true}}}, nil) {
+			return
+		}
+		yield(&Response{
+			Parts: []Part{{Text: "the answer"}},
+			Usage: &Usage{OutputTokens: 2, ThoughtTokens: 30},
+		}, nil)
+	}
+}
+
+func TestChatMessageKeepsThoughtsApart(t *testing.T) {
+	provider := &thinkingProvider{}
+	model, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	result, err := model.ChatMessage(context.Background(), "hi", func(string) {})
+	if err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	if result.Response != "the answer" || result.Thoughts != "let me think" || result.ChunkCount != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if usage := model.GetContextUsage(); usage.ThoughtTokens != 30 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+
+	// the thoughts are not send again with the next question
+	if _, err := model.ChatMessage(context.Background(), "more", func(string) {}); err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	for _, m := range provider.requests[1].History {
+		if m.Text() == "let me think" || m.Parts[0].Thought {
+			t.Errorf("thoughts in the history %+v", provider.requests[1].History)
+		}
+	}
+}
+
+func TestGeminiThinkingConfig(t *testing.T) {
+	budget := -1
+	config := toGenaiConfig(Request{Generation: GenerationConfig{ThinkingBudget: &budget}})
+	if config == nil || config.ThinkingConfig == nil || !config.ThinkingConfig.IncludeThoughts ||
+		*config.ThinkingConfig.ThinkingBudget != -1 {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	budget = 0
+	config = toGenaiConfig(Request{Generation: GenerationConfig{ThinkingBudget: &budget}})
+	if config.ThinkingConfig.IncludeThoughts {
+		t.Error("a zero budget should not include thoughts")
+	}
+}
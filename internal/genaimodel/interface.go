@@ -31,6 +31,7 @@ type ChatCreateServiceAPI interface {
 type ModelServiceAPI interface {
 	GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error]
 	List(ctx context.Context, cfg *genai.ListModelsConfig) (genai.Page[genai.Model], error)
+	CountTokens(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error)
 }
 
 // FileServiceAPI abstracts *genai.Files
@@ -86,6 +87,10 @@ type modelServiceWrapper struct {
 	genModel *genai.Models
 }
 
+func (w *modelServiceWrapper) CountTokens(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error) {
+	return w.genModel.CountTokens(ctx, model, contents, config)
+}
+
 func (w *modelServiceWrapper) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
 	return w.genModel.GenerateContentStream(ctx, model, contents, config)
 }
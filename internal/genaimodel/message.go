@@ -0,0 +1,174 @@
+package genaimodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Role is the producer of a Message in the conversation
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleModel Role = "model"
+)
+
+// FileData refers to a file that was uploaded to a provider
+// and can be referenced by its URI in later requests
+type FileData struct {
+	FileURI  string `json:"fileUri,omitempty"`
+	MIMEType string `json:"mimeType,omitempty"`
+	// DisplayName is the name of the attached file,
+	// it is not send to the provider
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// InlineData is an attached file that is send along with the
+// message itself, the data is base64 encoded in the json
+type InlineData struct {
+	MIMEType    string `json:"mimeType,omitempty"`
+	Data        []byte `json:"data,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// Part is a single piece of content in a Message. The json
+// field names follow the layout of the saved chat history
+// files so that earlier stored chats can still be loaded.
+type Part struct {
+	Text     string    `json:"text,omitempty"`
+	FileData *FileData `json:"fileData,omitempty"`
+	// InlineData is an attached file that is small enough to send as it is
+	InlineData *InlineData `json:"inlineData,omitempty"`
+	// Thought is true for the (summarized) reasoning of a
+	// thinking model, it is not part of the answer
+	Thought bool `json:"thought,omitempty"`
+	// FunctionCall is set when the model asks to run a tool
+	FunctionCall *FunctionCall `json:"functionCall,omitempty"`
+	// FunctionResponse is the result of the tool that is send back
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+	// ThoughtSignature comes with the function calls of
+	// thinking Gemini models and is send back as it is
+	ThoughtSignature []byte `json:"thoughtSignature,omitempty"`
+}
+
+// FunctionCall is the request of the model to run a tool
+type FunctionCall struct {
+	// ID is set by the backends that match the
+	// response to the call by id instead of by name
+	ID   string         `json:"id,omitempty"`
+	Name string         `json:"name,omitempty"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// FunctionResponse is the result of a tool, the output is in the
+// "output" key, a failure is reported in the "error" key
+type FunctionResponse struct {
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name,omitempty"`
+	Response map[string]any `json:"response,omitempty"`
+}
+
+// Message is a provider neutral turn in the conversation
+type Message struct {
+	Parts []Part `json:"parts,omitempty"`
+	Role  Role   `json:"role,omitempty"`
+	// Pinned messages are never trimmed from the history
+	// that is send to the model
+	Pinned bool `json:"pinned,omitempty"`
+	// Compacted messages are replaced by a Summary message
+	// in the requests, but are kept for the transcript
+	Compacted bool `json:"compacted,omitempty"`
+	// Summary is true for the model generated summary of the
+	// compacted messages and for the acknowledgement of the
+	// summary, they are not part of the transcript
+	Summary bool `json:"summary,omitempty"`
+	// SystemInstruction records the instruction that was active
+	// when the model gave this answer, it is not send as part of
+	// the history
+	SystemInstruction string `json:"systemInstruction,omitempty"`
+}
+
+// NewTextMessage creates a message with a single text part
+func NewTextMessage(text string, role Role) Message {
+	return Message{
+		Parts: []Part{{Text: text}},
+		Role:  role,
+	}
+}
+
+// text returns the output of the tool, or the
+// json of the response when it is not a plain output
+func (r FunctionResponse) text() string {
+	if output, ok := r.Response["output"].(string); ok && len(r.Response) == 1 {
+		return output
+	}
+	data, err := json.Marshal(r.Response)
+	if err != nil {
+		return fmt.Sprint(r.Response)
+	}
+
+	return string(data)
+}
+
+// marshalArgs encodes the arguments of a function call as a json object
+func marshalArgs(args map[string]any) string {
+	if args == nil {
+		return "{}"
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "{}"
+	}
+
+	return string(data)
+}
+
+// newModelMessage creates the answer of the model from the streamed parts,
+// thoughts are left out and consecutive text parts are joined
+func newModelMessage(parts []Part) Message {
+	message := Message{Role: RoleModel}
+	for _, p := range parts {
+		if p.Thought {
+			continue
+		}
+		last := len(message.Parts) - 1
+		if p.isText() && last >= 0 && message.Parts[last].isText() {
+			message.Parts[last].Text += p.Text
+			continue
+		}
+		message.Parts = append(message.Parts, p)
+	}
+
+	return message
+}
+
+// isText is true for a part that only contains text
+func (p Part) isText() bool {
+	return p.FileData == nil && p.InlineData == nil && p.FunctionCall == nil && p.FunctionResponse == nil && !p.Thought
+}
+
+// Text returns all text parts of the message concatenated
+func (m Message) Text() string {
+	var sb strings.Builder
+	for _, p := range m.Parts {
+		sb.WriteString(p.Text)
+	}
+
+	return sb.String()
+}
+
+// Attachments returns the names of the files that are attached to the message
+func (m Message) Attachments() []string {
+	var names []string
+	for _, p := range m.Parts {
+		switch {
+		case p.InlineData != nil:
+			names = append(names, p.InlineData.DisplayName)
+		case p.FileData != nil && p.FileData.DisplayName != "":
+			names = append(names, p.FileData.DisplayName)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,44 @@
+package genaimodel
+
+import (
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// Chat histories that were stored before the provider
+// neutral Message existed contain marshalled genai.Content,
+// these should still load
+func TestMessageLoadsStoredGenaiHistory(t *testing.T) {
+	stored := []*genai.Content{
+		genai.NewContentFromText("hello", genai.RoleUser),
+		genai.NewContentFromParts([]*genai.Part{
+			genai.NewPartFromURI("https://files/abc", "text/plain"),
+			genai.NewPartFromText("review this"),
+		}, genai.RoleUser),
+		genai.NewContentFromText("hi there", genai.RoleModel),
+	}
+	jsonData, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatalf("marshal genai history: %v", err)
+	}
+
+	var messages []Message
+	if err := json.Unmarshal(jsonData, &messages); err != nil {
+		t.Fatalf("unmarshal history: %v", err)
+	}
+
+	if len(messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(messages))
+	}
+	if messages[0].Role != RoleUser || messages[0].Text() != "hello" {
+		t.Errorf("unexpected first message %+v", messages[0])
+	}
+	if messages[1].Parts[0].FileData == nil || messages[1].Parts[0].FileData.FileURI != "https://files/abc" {
+		t.Errorf("file data not loaded: %+v", messages[1].Parts[0])
+	}
+	if messages[2].Role != RoleModel || messages[2].Text() != "hi there" {
+		t.Errorf("unexpected last message %+v", messages[2])
+	}
+}
@@ -145,6 +145,21 @@ func (m *MockModelServiceAPI) EXPECT() *MockModelServiceAPIMockRecorder {
 	return m.recorder
 }
 
+// CountTokens mocks base method.
+func (m *MockModelServiceAPI) CountTokens(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountTokens", ctx, model, contents, config)
+	ret0, _ := ret[0].(*genai.CountTokensResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountTokens indicates an expected call of CountTokens.
+func (mr *MockModelServiceAPIMockRecorder) CountTokens(ctx, model, contents, config any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountTokens", reflect.TypeOf((*MockModelServiceAPI)(nil).CountTokens), ctx, model, contents, config)
+}
+
 // GenerateContentStream mocks base method.
 func (m *MockModelServiceAPI) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
 	m.ctrl.T.Helper()
@@ -0,0 +1,430 @@
+package genaimodel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultOllamaBaseURL = "http://localhost:11434"
+	defaultOllamaModel   = "llama3.2"
+)
+
+// OllamaConfig configures the backend for a local Ollama daemon
+type OllamaConfig struct {
+	// BaseURL defaults to http://localhost:11434
+	BaseURL string
+	// Model is the default model to use, defaults to llama3.2
+	Model      string
+	HTTPClient *http.Client
+}
+
+// PullStatus is a progress update while a model is pulled
+type PullStatus struct {
+	Status    string
+	Digest    string
+	Total     int64
+	Completed int64
+}
+
+// String returns the status with the download percentage when known
+func (ps PullStatus) String() string {
+	if ps.Total > 0 {
+		return fmt.Sprintf("%s %d%%", ps.Status, ps.Completed*100/ps.Total)
+	}
+
+	return ps.Status
+}
+
+// ModelPuller is implemented by providers that can download
+// a model to the local machine
+type ModelPuller interface {
+	PullModel(ctx context.Context, name string, onStatus func(PullStatus)) error
+}
+
+type ollamaProvider struct {
+	baseURL    string
+	model      string
+	httpClient *http.Client
+}
+
+// NewOllamaProvider returns the Provider for the Ollama /api endpoints
+func NewOllamaProvider(cfg OllamaConfig) Provider {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	model := cfg.Model
+	if model == "" {
+		model = defaultOllamaModel
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &ollamaProvider{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		model:      model,
+		httpClient: httpClient,
+	}
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	// Images are the attached images, base64 encoded in the json
+	Images [][]byte `json:"images,omitempty"`
+	// ToolName tells which tool the result of a "tool" message is from
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+// ollamaToolCall is a function call, the daemon sends the
+// arguments as an object and does not stream them in pieces
+type ollamaToolCall struct {
+	Function struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+	Tools    []openAITool    `json:"tools,omitempty"`
+	// Format is the JSON schema of a structured answer
+	Format *Schema `json:"format,omitempty"`
+	// Think switches the thinking of reasoning models on or off,
+	// the daemon has no budget for it
+	Think *bool `json:"think,omitempty"`
+}
+
+// ollamaOptions are the model parameters of a request
+type ollamaOptions struct {
+	Temperature *float32 `json:"temperature,omitempty"`
+	TopP        *float32 `json:"top_p,omitempty"`
+	TopK        *int     `json:"top_k,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type ollamaChatChunk struct {
+	Message    ollamaMessage `json:"message"`
+	Done       bool          `json:"done"`
+	DoneReason string        `json:"done_reason"`
+	Error      string        `json:"error"`
+}
+
+type ollamaModelList struct {
+	Models []struct {
+		Name    string `json:"name"`
+		Size    int64  `json:"size"`
+		Details struct {
+			Format            string `json:"format"`
+			Family            string `json:"family"`
+			ParameterSize     string `json:"parameter_size"`
+			QuantizationLevel string `json:"quantization_level"`
+		} `json:"details"`
+	} `json:"models"`
+}
+
+type ollamaPullRequest struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+}
+
+type ollamaPullChunk struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+func (o *ollamaProvider) Name() string {
+	return "ollama"
+}
+
+func (o *ollamaProvider) DefaultModel() string {
+	return o.model
+}
+
+// Stream posts the conversation to /api/chat, the daemon
+// answers with one json document per line
+func (o *ollamaProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		chatRequest := ollamaChatRequest{
+			Model:    req.Model,
+			Messages: toOllamaMessages(req),
+			Stream:   true,
+			Options:  toOllamaOptions(req.Generation),
+			Tools:    toOpenAITools(req.Tools),
+			Format:   req.ResponseSchema,
+		}
+		if req.Generation.ThinkingBudget != nil {
+			think := req.Generation.thinking()
+			chatRequest.Think = &think
+		}
+		body, err := json.Marshal(chatRequest)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		httpResp, err := o.do(ctx, http.MethodPost, "/api/chat", body)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer func() {
+			_ = httpResp.Body.Close()
+		}()
+
+		for line, err := range readLines(httpResp.Body) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			var chunk ollamaChatChunk
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				yield(nil, fmt.Errorf("decoding chat chunk: %w", err))
+				return
+			}
+			if chunk.Error != "" {
+				yield(nil, errors.New(chunk.Error))
+				return
+			}
+			if chunk.Message.Thinking != "" {
+				if !yield(&Response{Parts: []Part{{Text: chunk.Message.Thinking, Thought: true}}}, nil) {
+					return
+				}
+			}
+			if chunk.Message.Content != "" {
+				if !yield(&Response{Parts: []Part{{Text: chunk.Message.Content}}}, nil) {
+					return
+				}
+			}
+			if len(chunk.Message.ToolCalls) != 0 {
+				var parts []Part
+				for _, call := range chunk.Message.ToolCalls {
+					parts = append(parts, Part{FunctionCall: &FunctionCall{
+						Name: call.Function.Name,
+						Args: call.Function.Arguments,
+					}})
+				}
+				if !yield(&Response{Parts: parts}, nil) {
+					return
+				}
+			}
+			if chunk.Done {
+				if chunk.DoneReason != "" {
+					yield(&Response{FinishReason: fromOpenAIFinishReason(chunk.DoneReason)}, nil)
+				}
+				return
+			}
+		}
+	}
+}
+
+// UploadFile inlines the file contents as text, the
+// daemon runs locally and has no file storage
+func (o *ollamaProvider) UploadFile(ctx context.Context, r io.Reader, mimeType string) (Part, error) {
+	return inlineFile(r)
+}
+
+// ListModels returns the models that are installed locally
+func (o *ollamaProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	httpResp, err := o.do(ctx, http.MethodGet, "/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = httpResp.Body.Close()
+	}()
+
+	var list ollamaModelList
+	if err := json.NewDecoder(httpResp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var modelInfos []ModelInfo
+	for _, model := range list.Models {
+		modelInfos = append(modelInfos, ModelInfo{
+			Name:          model.Name,
+			DisplayName:   model.Name,
+			Size:          model.Size,
+			Family:        model.Details.Family,
+			ParameterSize: model.Details.ParameterSize,
+			Quantization:  model.Details.QuantizationLevel,
+		})
+	}
+
+	return modelInfos, nil
+}
+
+// PullModel downloads the model, onStatus is called
+// for every progress update of the daemon
+func (o *ollamaProvider) PullModel(ctx context.Context, name string, onStatus func(PullStatus)) error {
+	body, err := json.Marshal(ollamaPullRequest{Model: name, Stream: true})
+	if err != nil {
+		return err
+	}
+
+	httpResp, err := o.do(ctx, http.MethodPost, "/api/pull", body)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = httpResp.Body.Close()
+	}()
+
+	for line, err := range readLines(httpResp.Body) {
+		if err != nil {
+			return err
+		}
+		var chunk ollamaPullChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("decoding pull status: %w", err)
+		}
+		if chunk.Error != "" {
+			return errors.New(chunk.Error)
+		}
+		onStatus(PullStatus{
+			Status:    chunk.Status,
+			Digest:    chunk.Digest,
+			Total:     chunk.Total,
+			Completed: chunk.Completed,
+		})
+	}
+
+	return nil
+}
+
+// do sends the request and returns the response when the
+// daemon answered with 200 OK, otherwise the error is returned
+func (o *ollamaProvider) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, o.baseURL+path, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	httpResp, err := o.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		defer func() {
+			_ = httpResp.Body.Close()
+		}()
+		respBody, _ := io.ReadAll(io.LimitReader(httpResp.Body, 64*1024))
+		var chunk ollamaChatChunk
+		if err := json.Unmarshal(respBody, &chunk); err == nil && chunk.Error != "" {
+			return nil, newHTTPError(httpResp, chunk.Error)
+		}
+		return nil, newHTTPError(httpResp, strings.TrimSpace(string(respBody)))
+	}
+
+	return httpResp, nil
+}
+
+// toOllamaOptions leaves the options out when no parameter is set,
+// the model then uses the parameters of its Modelfile
+func toOllamaOptions(gc GenerationConfig) *ollamaOptions {
+	if gc.IsZero() {
+		return nil
+	}
+
+	return &ollamaOptions{
+		Temperature: gc.Temperature,
+		TopP:        gc.TopP,
+		TopK:        gc.TopK,
+		NumPredict:  gc.MaxOutputTokens,
+		Seed:        gc.Seed,
+		Stop:        gc.StopSequences,
+	}
+}
+
+// readLines yields the non empty lines of a newline
+// delimited json stream
+func readLines(r io.Reader) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if !yield(line, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+func toOllamaMessages(req Request) []ollamaMessage {
+	var messages []ollamaMessage
+	if req.SystemInstruction != "" {
+		messages = append(messages, ollamaMessage{Role: "system", Content: req.SystemInstruction})
+	}
+	for _, m := range append(append([]Message{}, req.History...), req.Message) {
+		role := "user"
+		if m.Role == RoleModel {
+			role = "assistant"
+		}
+		message := ollamaMessage{Role: role, Content: m.Text()}
+		results := false
+		var attached strings.Builder
+		for _, p := range m.Parts {
+			switch {
+			case p.InlineData != nil && strings.HasPrefix(p.InlineData.MIMEType, "image/"):
+				message.Images = append(message.Images, p.InlineData.Data)
+				fmt.Fprintf(&attached, "%s image %d\n\n", attachmentLabel(p.InlineData.DisplayName), len(message.Images))
+			case p.InlineData != nil:
+				attached.WriteString(p.InlineData.text())
+			case p.FunctionCall != nil:
+				var call ollamaToolCall
+				call.Function.Name = p.FunctionCall.Name
+				call.Function.Arguments = p.FunctionCall.Args
+				message.ToolCalls = append(message.ToolCalls, call)
+			case p.FunctionResponse != nil:
+				// each result is a message of its own
+				results = true
+				messages = append(messages, ollamaMessage{
+					Role:     "tool",
+					Content:  p.FunctionResponse.text(),
+					ToolName: p.FunctionResponse.Name,
+				})
+			}
+		}
+		message.Content = attached.String() + message.Content
+		if !results || message.Content != "" {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages
+}
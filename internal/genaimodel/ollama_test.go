@@ -0,0 +1,123 @@
+package genaimodel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOllamaStreamAndListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chat":
+			var req ollamaChatRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decoding request: %v", err)
+			}
+			if req.Messages[0].Role != "system" || req.Model != "llama3.2" {
+				t.Errorf("unexpected request %+v", req)
+			}
+			_, _ = fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Hel"},"done":false}`)
+			_, _ = fmt.Fprintln(w, `{"message":{"role":"assistant","content":"lo"},"done":false}`)
+			_, _ = fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop"}`)
+		case "/api/tags":
+			_, _ = fmt.Fprint(w, `{"models":[{"name":"llama3.2:latest","size":2019393189,
+				"details":{"family":"llama","parameter_size":"3.2B","quantization_level":"Q4_K_M"}}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(OllamaConfig{BaseURL: server.URL, Model: "llama3.2"})
+	text, err := collectText(provider.Stream(context.Background(), Request{
+		Model:             "llama3.2",
+		SystemInstruction: "be kind",
+		Message:           NewTextMessage("hi", RoleUser),
+	}))
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if text != "Hello" {
+		t.Errorf("unexpected text %q", text)
+	}
+
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 1 || models[0].Details() != "llama, 3.2B, Q4_K_M, 2.0 GB" {
+		t.Errorf("unexpected models %+v", models)
+	}
+}
+
+func TestOllamaPullModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+		_, _ = fmt.Fprintln(w, `{"status":"downloading","digest":"sha256:abc","total":200,"completed":50}`)
+		_, _ = fmt.Fprintln(w, `{"status":"success"}`)
+	}))
+	defer server.Close()
+
+	model, err := NewModel(context.Background(), NewOllamaProvider(OllamaConfig{BaseURL: server.URL}), "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+
+	var statuses []string
+	err = model.PullModel(context.Background(), "llama3.2", func(s string) { statuses = append(statuses, s) })
+	if err != nil {
+		t.Fatalf("PullModel failed: %v", err)
+	}
+	expected := []string{"pulling manifest", "downloading 25%", "success"}
+	if fmt.Sprint(statuses) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, statuses)
+	}
+}
+
+func TestOllamaThinking(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		if req.Think == nil || !*req.Think {
+			t.Errorf("expected think to be set, got %+v", req)
+		}
+		_, _ = fmt.Fprintln(w, `{"message":{"role":"assistant","content":"","thinking":"hmm"},"done":false}`)
+		_, _ = fmt.Fprintln(w, `{"message":{"role":"assistant","content":"42"},"done":true,"done_reason":"stop"}`)
+	}))
+	defer server.Close()
+
+	budget := -1
+	provider := NewOllamaProvider(OllamaConfig{BaseURL: server.URL, Model: "qwen3"})
+	var thoughts, answer string
+	for resp, err := range provider.Stream(context.Background(), Request{
+		Model:      "qwen3",
+		Message:    NewTextMessage("hi", RoleUser),
+		Generation: GenerationConfig{ThinkingBudget: &budget},
+	}) {
+		if err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		for _, part := range resp.Parts {
+			if part.Thought {
+				thoughts += part.Text
+			} else {
+				answer += part.Text
+			}
+		}
+	}
+	if thoughts != "hmm" || answer != "42" {
+		t.Errorf("unexpected thoughts %q and answer %q", thoughts, answer)
+	}
+}
+
+func TestOllamaDefaultModel(t *testing.T) {
+	if model := NewOllamaProvider(OllamaConfig{}).DefaultModel(); model != defaultOllamaModel {
+		t.Errorf("expected the default model %s, got %q", defaultOllamaModel, model)
+	}
+}
@@ -0,0 +1,481 @@
+package genaimodel
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+)
+
+const defaultOpenAIBaseURL = "http://localhost:8080/v1"
+
+// OpenAIConfig configures a backend that speaks the OpenAI
+// chat completions protocol, like llama.cpp, vLLM or LM Studio
+type OpenAIConfig struct {
+	// BaseURL is the url up to and including the version,
+	// for example http://localhost:8080/v1
+	BaseURL string
+	// APIKey is optional, local servers usually do not need one
+	APIKey string
+	// Model is the default model to use, the servers have no
+	// model in common so there is no default
+	Model      string
+	HTTPClient *http.Client
+}
+
+type openAIProvider struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+// NewOpenAIProvider returns the Provider for an OpenAI compatible server
+func NewOpenAIProvider(cfg OpenAIConfig) Provider {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &openAIProvider{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     cfg.APIKey,
+		model:      cfg.Model,
+		httpClient: httpClient,
+	}
+}
+
+type openAIMessage struct {
+	Role string `json:"role"`
+	// Content is the text of the message, or the content
+	// parts when files are attached to the message
+	Content    any              `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// openAIContentPart is a content part, the type tells which field is set
+type openAIContentPart struct {
+	Type     string       `json:"type"`
+	Text     string       `json:"text,omitempty"`
+	ImageURL *openAIImage `json:"image_url,omitempty"`
+	File     *openAIFile  `json:"file,omitempty"`
+}
+
+type openAIImage struct {
+	URL string `json:"url"`
+}
+
+type openAIFile struct {
+	Filename string `json:"filename"`
+	FileData string `json:"file_data"`
+}
+
+// openAITool declares a function, Ollama uses the same layout
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+type openAIFunction struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Parameters  *Schema `json:"parameters,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name string `json:"name,omitempty"`
+		// Arguments is the json encoded object with the
+		// arguments, it is streamed in pieces
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIChatRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Stream      bool            `json:"stream"`
+	Temperature *float32        `json:"temperature,omitempty"`
+	TopP        *float32        `json:"top_p,omitempty"`
+	// TopK is not part of the OpenAI api, llama.cpp and vLLM support it
+	TopK      *int         `json:"top_k,omitempty"`
+	MaxTokens int          `json:"max_tokens,omitempty"`
+	Seed      *int         `json:"seed,omitempty"`
+	Stop      []string     `json:"stop,omitempty"`
+	Tools     []openAITool `json:"tools,omitempty"`
+	// ResponseFormat asks for an answer that matches a JSON schema
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type openAIResponseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Name   string  `json:"name"`
+		Schema *Schema `json:"schema"`
+	} `json:"json_schema"`
+}
+
+type openAIChatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+			// ReasoningContent carries the thinking of reasoning
+			// models on llama.cpp, vLLM and DeepSeek
+			ReasoningContent string `json:"reasoning_content"`
+			// ToolCalls are streamed in pieces, the index
+			// tells which call the piece belongs to
+			ToolCalls []struct {
+				Index int `json:"index"`
+				openAIToolCall
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+type openAIModelList struct {
+	Data []struct {
+		ID      string `json:"id"`
+		OwnedBy string `json:"owned_by"`
+	} `json:"data"`
+}
+
+type openAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+func (o *openAIProvider) Name() string {
+	return "openai"
+}
+
+func (o *openAIProvider) DefaultModel() string {
+	return o.model
+}
+
+// Stream posts the conversation to /chat/completions and
+// reads the server-sent events of the streamed response
+func (o *openAIProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		body, err := json.Marshal(openAIChatRequest{
+			Model:          req.Model,
+			Messages:       toOpenAIMessages(req),
+			Stream:         true,
+			Temperature:    req.Generation.Temperature,
+			TopP:           req.Generation.TopP,
+			TopK:           req.Generation.TopK,
+			MaxTokens:      req.Generation.MaxOutputTokens,
+			Seed:           req.Generation.Seed,
+			Stop:           req.Generation.StopSequences,
+			Tools:          toOpenAITools(req.Tools),
+			ResponseFormat: toOpenAIResponseFormat(req.ResponseSchema),
+		})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		httpResp, err := o.do(ctx, http.MethodPost, "/chat/completions", body)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer func() {
+			_ = httpResp.Body.Close()
+		}()
+
+		// the function calls are yielded once all pieces are received
+		var toolCalls []openAIToolCall
+		yieldToolCalls := func() bool {
+			if len(toolCalls) == 0 {
+				return true
+			}
+			parts, err := fromOpenAIToolCalls(toolCalls)
+			if err != nil {
+				yield(nil, err)
+				return false
+			}
+			toolCalls = nil
+			return yield(&Response{Parts: parts}, nil)
+		}
+
+		for event, err := range readSSE(httpResp.Body) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if event.Data == "[DONE]" {
+				yieldToolCalls()
+				return
+			}
+			var chunk openAIChatChunk
+			if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+				yield(nil, fmt.Errorf("decoding chat completion chunk: %w", err))
+				return
+			}
+			if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason == "content_filter" {
+				yield(nil, &APIError{Kind: ErrorSafety, Message: "the answer was stopped by the content filter"})
+				return
+			}
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+			if reason := chunk.Choices[0].FinishReason; reason != "" {
+				if !yield(&Response{FinishReason: fromOpenAIFinishReason(reason)}, nil) {
+					return
+				}
+			}
+			delta := chunk.Choices[0].Delta
+			for _, call := range delta.ToolCalls {
+				for len(toolCalls) <= call.Index {
+					toolCalls = append(toolCalls, openAIToolCall{})
+				}
+				if call.ID != "" {
+					toolCalls[call.Index].ID = call.ID
+				}
+				toolCalls[call.Index].Function.Name += call.Function.Name
+				toolCalls[call.Index].Function.Arguments += call.Function.Arguments
+			}
+			var parts []Part
+			if delta.ReasoningContent != "" {
+				parts = append(parts, Part{Text: delta.ReasoningContent, Thought: true})
+			}
+			if delta.Content != "" {
+				parts = append(parts, Part{Text: delta.Content})
+			}
+			if len(parts) == 0 {
+				// role announcements and the final chunk carry no text
+				continue
+			}
+			if !yield(&Response{Parts: parts}, nil) {
+				return
+			}
+		}
+		yieldToolCalls()
+	}
+}
+
+// UploadFile inlines the file contents as text, the chat
+// completions protocol has no file storage
+func (o *openAIProvider) UploadFile(ctx context.Context, r io.Reader, mimeType string) (Part, error) {
+	return inlineFile(r)
+}
+
+func (o *openAIProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	httpResp, err := o.do(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = httpResp.Body.Close()
+	}()
+
+	var list openAIModelList
+	if err := json.NewDecoder(httpResp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var modelInfos []ModelInfo
+	for _, model := range list.Data {
+		modelInfos = append(modelInfos, ModelInfo{
+			Name:        model.ID,
+			DisplayName: model.ID,
+			Description: model.OwnedBy,
+		})
+	}
+
+	return modelInfos, nil
+}
+
+// do sends the request and returns the response when the
+// server answered with 200 OK, otherwise the error is returned
+func (o *openAIProvider) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, o.baseURL+path, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if o.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	httpResp, err := o.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		defer func() {
+			_ = httpResp.Body.Close()
+		}()
+		return nil, openAIError(httpResp)
+	}
+
+	return httpResp, nil
+}
+
+func openAIError(httpResp *http.Response) error {
+	respBody, _ := io.ReadAll(io.LimitReader(httpResp.Body, 64*1024))
+	var errResp openAIErrorResponse
+	if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error.Message != "" {
+		return newHTTPError(httpResp, errResp.Error.Message)
+	}
+
+	return newHTTPError(httpResp, strings.TrimSpace(string(respBody)))
+}
+
+// toOpenAIContent returns the text of the message, or the content parts
+// with the images and pdf files when files are attached to the message
+func toOpenAIContent(m Message) any {
+	if len(m.Attachments()) == 0 {
+		return m.Text()
+	}
+	var parts []openAIContentPart
+	for _, p := range m.Parts {
+		switch {
+		case p.InlineData != nil && strings.HasPrefix(p.InlineData.MIMEType, "image/"):
+			parts = append(parts,
+				openAIContentPart{Type: "text", Text: attachmentLabel(p.InlineData.DisplayName)},
+				openAIContentPart{Type: "image_url", ImageURL: &openAIImage{URL: dataURL(p.InlineData)}})
+		case p.InlineData != nil && p.InlineData.MIMEType == "application/pdf":
+			parts = append(parts, openAIContentPart{Type: "file", File: &openAIFile{
+				Filename: p.InlineData.DisplayName,
+				FileData: dataURL(p.InlineData),
+			}})
+		case p.InlineData != nil:
+			parts = append(parts, openAIContentPart{Type: "text", Text: p.InlineData.text()})
+		case p.isText() && p.Text != "":
+			parts = append(parts, openAIContentPart{Type: "text", Text: p.Text})
+		}
+	}
+
+	return parts
+}
+
+// dataURL encodes the data of the attachment in a data url
+func dataURL(d *InlineData) string {
+	return "data:" + d.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(d.Data)
+}
+
+// toOpenAIMessages puts the system instruction, the history
+// and the new message in the chat completions message list
+func toOpenAIMessages(req Request) []openAIMessage {
+	var messages []openAIMessage
+	if req.SystemInstruction != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: req.SystemInstruction})
+	}
+	for _, m := range append(append([]Message{}, req.History...), req.Message) {
+		role := "user"
+		if m.Role == RoleModel {
+			role = "assistant"
+		}
+		message := openAIMessage{Role: role, Content: toOpenAIContent(m)}
+		results := false
+		for _, p := range m.Parts {
+			switch {
+			case p.FunctionCall != nil:
+				call := openAIToolCall{ID: p.FunctionCall.ID, Type: "function"}
+				call.Function.Name = p.FunctionCall.Name
+				call.Function.Arguments = marshalArgs(p.FunctionCall.Args)
+				message.ToolCalls = append(message.ToolCalls, call)
+			case p.FunctionResponse != nil:
+				// each result is a message of its own
+				results = true
+				messages = append(messages, openAIMessage{
+					Role:       "tool",
+					Content:    p.FunctionResponse.text(),
+					ToolCallID: p.FunctionResponse.ID,
+				})
+			}
+		}
+		if !results || message.Content != "" {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages
+}
+
+// fromOpenAIFinishReason maps the finish reason of a choice,
+// which is also used by Ollama as the done reason
+func fromOpenAIFinishReason(reason string) FinishReason {
+	switch reason {
+	case "stop", "tool_calls", "function_call":
+		return FinishStop
+	case "length":
+		return FinishMaxTokens
+	case "content_filter":
+		return FinishSafety
+	}
+
+	return FinishOther
+}
+
+// toOpenAIResponseFormat returns the json_schema response
+// format, nil for a free text answer
+func toOpenAIResponseFormat(schema *Schema) *openAIResponseFormat {
+	if schema == nil {
+		return nil
+	}
+	format := &openAIResponseFormat{Type: "json_schema"}
+	format.JSONSchema.Name = "response"
+	format.JSONSchema.Schema = schema
+
+	return format
+}
+
+func toOpenAITools(declarations []ToolDeclaration) []openAITool {
+	var tools []openAITool
+	for _, declaration := range declarations {
+		tools = append(tools, openAITool{
+			Type: "function",
+			Function: openAIFunction{
+				Name:        declaration.Name,
+				Description: declaration.Description,
+				Parameters:  declaration.Parameters,
+			},
+		})
+	}
+
+	return tools
+}
+
+// fromOpenAIToolCalls decodes the arguments of the streamed calls, a
+// call without id gets one so that its result can refer to it
+func fromOpenAIToolCalls(toolCalls []openAIToolCall) ([]Part, error) {
+	var parts []Part
+	for i, call := range toolCalls {
+		var args map[string]any
+		if strings.TrimSpace(call.Function.Arguments) != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+				return nil, fmt.Errorf("decoding the arguments of %s: %w", call.Function.Name, err)
+			}
+		}
+		id := call.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i)
+		}
+		parts = append(parts, Part{FunctionCall: &FunctionCall{ID: id, Name: call.Function.Name, Args: args}})
+	}
+
+	return parts, nil
+}
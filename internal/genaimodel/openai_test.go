@@ -0,0 +1,143 @@
+package genaimodel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIChatMessageStreams(t *testing.T) {
+	var received openAIChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("unexpected authorization header %q", got)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n")
+		_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\" world\"},\"finish_reason\":\"stop\"}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider(OpenAIConfig{
+		BaseURL: server.URL + "/v1",
+		APIKey:  "secret",
+		Model:   "local-model",
+	})
+	model, err := NewModel(context.Background(), provider, "be kind")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+
+	var chunks []string
+	result, err := model.ChatMessage(context.Background(), "hi", func(s string) { chunks = append(chunks, s) })
+	if err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+
+	if result.Response != "Hello world" || result.ChunkCount != 2 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if received.Model != "local-model" || !received.Stream {
+		t.Errorf("unexpected request %+v", received)
+	}
+	last := received.Messages[len(received.Messages)-1]
+	if last.Role != "user" || last.Content != "hi" {
+		t.Errorf("unexpected last message %+v", last)
+	}
+}
+
+func TestOpenAIErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, `{"error":{"message":"model not found","type":"invalid_request_error"}}`)
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL})
+	_, err := collectText(provider.Stream(context.Background(), Request{Message: NewTextMessage("hi", RoleUser)}))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if err.Error() != "404 Not Found: model not found" {
+		t.Errorf("unexpected error %q", err)
+	}
+}
+
+func TestOpenAIListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"data":[{"id":"llama-3","owned_by":"llamacpp"},{"id":"qwen"}]}`)
+	}))
+	defer server.Close()
+
+	models, err := NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL}).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 2 || models[0].Name != "llama-3" || models[1].Name != "qwen" {
+		t.Errorf("unexpected models %+v", models)
+	}
+}
+
+func TestOpenAIToolCalls(t *testing.T) {
+	var requests []openAIChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var received openAIChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		requests = append(requests, received)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if len(requests) == 1 {
+			// the arguments of the call arrive in pieces
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_9\",\"type\":\"function\",\"function\":{\"name\":\"echo\",\"arguments\":\"\"}}]}}]}\n\n")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"text\\\":\"}}]}}]}\n\n")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"pong\\\"}\"}}]},\"finish_reason\":\"tool_calls\"}]}\n\n")
+		} else {
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"done\"},\"finish_reason\":\"stop\"}]}\n\n")
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	model, err := NewModel(context.Background(), NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL}), "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	registry, _ := NewToolRegistry(echoTool)
+	model.SetTools(registry)
+
+	result, err := model.ChatMessage(context.Background(), "ping", func(string) {})
+	if err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	if result.Response != "done" || len(requests) != 2 {
+		t.Fatalf("unexpected result %+v after %d requests", result, len(requests))
+	}
+	if len(requests[0].Tools) != 1 || requests[0].Tools[0].Function.Name != "echo" {
+		t.Errorf("unexpected tools %+v", requests[0].Tools)
+	}
+	messages := requests[1].Messages
+	if len(messages) != 3 {
+		t.Fatalf("unexpected messages %+v", messages)
+	}
+	call := messages[1].ToolCalls
+	if messages[1].Role != "assistant" || len(call) != 1 || call[0].ID != "call_9" ||
+		call[0].Function.Arguments != `{"text":"pong"}` {
+		t.Errorf("unexpected assistant message %+v", messages[1])
+	}
+	if messages[2].Role != "tool" || messages[2].ToolCallID != "call_9" || messages[2].Content != "pong" {
+		t.Errorf("unexpected tool message %+v", messages[2])
+	}
+}
@@ -0,0 +1,157 @@
+package genaimodel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+)
+
+// Request is a provider neutral request to generate
+// a response from a model
+type Request struct {
+	Model             string
+	SystemInstruction string
+	// History contains the earlier turns of the conversation
+	History []Message
+	// Message is the new turn that is send to the model
+	Message Message
+	// Generation holds the sampling parameters
+	Generation GenerationConfig
+	// Tools are the functions the model can call
+	Tools []ToolDeclaration
+	// ResponseSchema asks for an answer in JSON that
+	// matches the schema, nil for a free text answer
+	ResponseSchema *Schema
+}
+
+// Response is a (streamed) chunk of a model response
+type Response struct {
+	Parts []Part
+	// Usage is set on the chunks that report the token usage
+	Usage *Usage
+	// FinishReason is set on the chunk that ends the answer,
+	// a chunk can carry only the usage or the finish reason
+	FinishReason FinishReason
+}
+
+// FinishReason tells why the model stopped answering
+type FinishReason string
+
+const (
+	// FinishStop is a complete answer, or a stop sequence was reached
+	FinishStop FinishReason = "stop"
+	// FinishMaxTokens is an answer cut off at the maximum output tokens
+	FinishMaxTokens FinishReason = "max_tokens"
+	// FinishSafety is an answer stopped by the safety filters
+	FinishSafety FinishReason = "safety"
+	// FinishRecitation is an answer stopped because it
+	// recited copyrighted material
+	FinishRecitation FinishReason = "recitation"
+	// FinishOther is any other reason the backend gave
+	FinishOther FinishReason = "other"
+)
+
+// Notice describes a finish reason that is worth telling the
+// user, it is empty for a complete answer
+func (fr FinishReason) Notice() string {
+	switch fr {
+	case FinishMaxTokens:
+		return "the answer was cut off at the maximum output tokens"
+	case FinishSafety:
+		return "the answer was stopped by the safety filters"
+	case FinishRecitation:
+		return "the answer was stopped because it recited copyrighted material"
+	case FinishOther:
+		return "the answer was stopped by the backend"
+	}
+
+	return ""
+}
+
+// finishError returns the error of an answer that was blocked,
+// an answer that is cut off or complete is no error
+func finishError(fr FinishReason) error {
+	if fr == FinishSafety || fr == FinishRecitation {
+		return &APIError{Kind: ErrorSafety, Message: fr.Notice()}
+	}
+
+	return nil
+}
+
+// Usage is the token usage of a response as reported by the provider
+type Usage struct {
+	InputTokens   int
+	OutputTokens  int
+	ThoughtTokens int
+}
+
+// ModelInfo describes a model that is available at a provider
+type ModelInfo struct {
+	Name        string
+	DisplayName string
+	Description string
+	// details that local backends like Ollama expose
+	Size          int64
+	Family        string
+	ParameterSize string
+	Quantization  string
+}
+
+// Details returns the known details of the model
+// separated by a comma, like "llama, 8.0B, Q4_0, 4.7 GB"
+func (mi ModelInfo) Details() string {
+	var details []string
+	for _, d := range []string{mi.Family, mi.ParameterSize, mi.Quantization} {
+		if d != "" {
+			details = append(details, d)
+		}
+	}
+	if mi.Size > 0 {
+		details = append(details, fmt.Sprintf("%.1f GB", float64(mi.Size)/1e9))
+	}
+
+	return strings.Join(details, ", ")
+}
+
+// Provider is implemented by each backend (vendor) that
+// can run the chat. theModel only talks to a Provider so
+// that the Action interface is not tied to a single vendor.
+type Provider interface {
+	// Name returns a short name of the backend, like "gemini"
+	Name() string
+	// DefaultModel is the model that is used when none is chosen
+	DefaultModel() string
+	// Stream sends the request and yields the response in chunks
+	Stream(ctx context.Context, req Request) iter.Seq2[*Response, error]
+	// UploadFile makes the file contents available to the model and
+	// returns the part that refers to it in a Message
+	UploadFile(ctx context.Context, r io.Reader, mimeType string) (Part, error)
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+}
+
+// collectText consumes the stream and returns all text
+// that was received
+func collectText(stream iter.Seq2[*Response, error]) (string, error) {
+	var allParts []Part
+	for resp, err := range stream {
+		if err != nil {
+			return buildString(allParts), err
+		}
+		allParts = append(allParts, resp.Parts...)
+	}
+
+	return buildString(allParts), nil
+}
+
+// inlineFile reads the file contents into a text part
+// for providers that have no file storage
+func inlineFile(r io.Reader) (Part, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return Part{}, err
+	}
+
+	return Part{Text: string(contents)}, nil
+}
@@ -0,0 +1,41 @@
+package genaimodel
+
+import (
+	"context"
+	"io"
+	"iter"
+)
+
+// fakeProvider records the requests and answers
+// every request with the same chunks
+type fakeProvider struct {
+	requests []Request
+	chunks   []string
+}
+
+func (f *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (f *fakeProvider) DefaultModel() string {
+	return "fake-model"
+}
+
+func (f *fakeProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	f.requests = append(f.requests, req)
+	return func(yield func(*Response, error) bool) {
+		for _, c := range f.chunks {
+			if !yield(&Response{Parts: []Part{{Text: c}}}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (f *fakeProvider) UploadFile(ctx context.Context, r io.Reader, mimeType string) (Part, error) {
+	return inlineFile(r)
+}
+
+func (f *fakeProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return []ModelInfo{{Name: "fake-model"}}, nil
+}
@@ -0,0 +1,128 @@
+package genaimodel
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultMaxRetries   = 3
+	defaultInitialDelay = time.Second
+	defaultMaxDelay     = 30 * time.Second
+)
+
+// RetryPolicy configures how often a failing request is
+// send again. Zero values fall back to the defaults.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first
+	// attempt, defaults to 3, a negative value disables retries
+	MaxRetries int
+	// InitialDelay is the wait before the first retry, it
+	// doubles for every next retry, defaults to 1s
+	InitialDelay time.Duration
+	// MaxDelay caps the wait between retries, defaults to 30s
+	MaxDelay time.Duration
+	// RequestTimeout limits each attempt, zero means no timeout
+	RequestTimeout time.Duration
+}
+
+func (rp RetryPolicy) maxRetries() int {
+	if rp.MaxRetries == 0 {
+		return defaultMaxRetries
+	}
+
+	return max(rp.MaxRetries, 0)
+}
+
+// backoff returns the wait before the given retry: an exponential
+// delay with jitter, or the delay the server asked for when longer
+func (rp RetryPolicy) backoff(retry int, retryAfter time.Duration) time.Duration {
+	initialDelay := rp.InitialDelay
+	if initialDelay <= 0 {
+		initialDelay = defaultInitialDelay
+	}
+	maxDelay := rp.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxDelay
+	}
+
+	delay := initialDelay << min(retry, 16)
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+	// jitter between half and the full delay spreads the retries of
+	// multiple clients that were rate limited at the same moment
+	delay = delay/2 + rand.N(delay/2+1)
+
+	return max(delay, retryAfter)
+}
+
+// stream sends the request to the provider and retries on
+// transient errors. A request is only retried as long as no part of
+// the response was received, otherwise the answer would be repeated.
+// The errors are classified as *APIError, a cancelled ctx is returned
+// unchanged.
+func (m *theModel) stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		for retry := 0; ; retry++ {
+			attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+			if m.retryPolicy.RequestTimeout > 0 {
+				attemptCtx, cancel = context.WithTimeout(ctx, m.retryPolicy.RequestTimeout)
+			}
+
+			received := false
+			var streamErr error
+			for resp, err := range m.provider.Stream(attemptCtx, req) {
+				if err != nil {
+					streamErr = err
+					break
+				}
+				// a chunk with only the usage or the finish reason
+				// adds nothing to the answer that a retry repeats
+				if resp != nil && len(resp.Parts) > 0 {
+					received = true
+				}
+				if resp != nil && resp.Usage != nil && resp.Usage.ThoughtTokens > 0 {
+					m.contextUsage.ThoughtTokens = resp.Usage.ThoughtTokens
+				}
+				if resp != nil && resp.FinishReason != "" {
+					m.contextUsage.FinishReason = resp.FinishReason
+				}
+				if !yield(resp, nil) {
+					cancel()
+					return
+				}
+			}
+			cancel()
+
+			if streamErr == nil {
+				return
+			}
+			if ctx.Err() != nil {
+				yield(nil, ctx.Err())
+				return
+			}
+
+			err := classifyError(streamErr)
+			var apiErr *APIError
+			if received || retry >= m.retryPolicy.maxRetries() ||
+				!errors.As(err, &apiErr) || !apiErr.Retryable() {
+				yield(nil, err)
+				return
+			}
+
+			delay := m.retryPolicy.backoff(retry, apiErr.RetryAfter)
+			log.Printf("Retry %d of %d in %s after: %v", retry+1, m.retryPolicy.maxRetries(), delay, err)
+			select {
+			case <-ctx.Done():
+				yield(nil, ctx.Err())
+				return
+			case <-time.After(delay):
+			}
+		}
+	}
+}
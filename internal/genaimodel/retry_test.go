@@ -0,0 +1,129 @@
+package genaimodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingProvider fails the first requests with the
+// given errors before it answers like the fakeProvider
+type failingProvider struct {
+	fakeProvider
+	errs []error
+	// usageFirst sends a chunk with only the usage before the error
+	usageFirst bool
+}
+
+func (f *failingProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	if len(f.errs) == 0 {
+		return f.fakeProvider.Stream(ctx, req)
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return func(yield func(*Response, error) bool) {
+		if f.usageFirst && !yield(&Response{Usage: &Usage{}}, nil) {
+			return
+		}
+		yield(nil, err)
+	}
+}
+
+func TestChatMessageRetriesTransientErrors(t *testing.T) {
+	provider := &failingProvider{
+		fakeProvider: fakeProvider{chunks: []string{"hello"}},
+		errs: []error{
+			&APIError{Kind: ErrorUnavailable, StatusCode: 503, Message: "503 Service Unavailable"},
+			&APIError{Kind: ErrorQuota, StatusCode: 429, Message: "429 Too Many Requests"},
+		},
+	}
+	model, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	model.SetRetryPolicy(RetryPolicy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+	result, err := model.ChatMessage(context.Background(), "hi", func(string) {})
+	if err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	if result.Response != "hello" || len(provider.requests) != 1 {
+		t.Errorf("unexpected result %+v after %d successful requests", result, len(provider.requests))
+	}
+}
+
+func TestChatMessageRetriesAfterAUsageChunk(t *testing.T) {
+	provider := &failingProvider{
+		fakeProvider: fakeProvider{chunks: []string{"hello"}},
+		errs:         []error{&APIError{Kind: ErrorUnavailable, StatusCode: 503, Message: "503 Service Unavailable"}},
+		usageFirst:   true,
+	}
+	model, _ := NewModel(context.Background(), provider, "")
+	model.SetRetryPolicy(RetryPolicy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+	result, err := model.ChatMessage(context.Background(), "hi", func(string) {})
+	if err != nil || result.Response != "hello" {
+		t.Errorf("expected the retry to answer, got %+v, %v", result, err)
+	}
+}
+
+func TestChatMessageDoesNotRetryAuthErrors(t *testing.T) {
+	provider := &failingProvider{
+		errs: []error{&APIError{Kind: ErrorAuth, StatusCode: 401, Message: "401 Unauthorized"}},
+	}
+	model, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+
+	_, err = model.ChatMessage(context.Background(), "hi", func(string) {})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != ErrorAuth {
+		t.Fatalf("expected an auth error, got %v", err)
+	}
+	if apiErr.Advice() == "" {
+		t.Error("expected an advice for the auth error")
+	}
+	if len(provider.errs) != 0 || len(provider.requests) != 0 {
+		t.Errorf("expected a single attempt")
+	}
+}
+
+func TestHTTPErrorClassification(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = fmt.Fprint(w, `{"error":{"message":"slow down","type":"rate_limit"}}`)
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL})
+	_, err := collectText(provider.Stream(context.Background(), Request{Message: NewTextMessage("hi", RoleUser)}))
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an *APIError, got %v", err)
+	}
+	if apiErr.Kind != ErrorQuota || apiErr.RetryAfter != 2*time.Second || !apiErr.Retryable() {
+		t.Errorf("unexpected classification %+v", apiErr)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: time.Second, MaxDelay: 4 * time.Second}
+	for retry, maxExpected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		delay := policy.backoff(retry, 0)
+		if delay < maxExpected/2 || delay > maxExpected {
+			t.Errorf("retry %d: delay %s not within [%s, %s]", retry, delay, maxExpected/2, maxExpected)
+		}
+	}
+	// the delay the server asks for wins
+	if delay := policy.backoff(0, time.Minute); delay != time.Minute {
+		t.Errorf("expected the retry after delay, got %s", delay)
+	}
+}
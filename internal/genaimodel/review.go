@@ -0,0 +1,155 @@
+package genaimodel
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// Severity tells how important a finding of a review is
+type Severity string
+
+const (
+	SeverityCritical Severity = "critical"
+	SeverityMajor    Severity = "major"
+	SeverityMinor    Severity = "minor"
+	SeverityInfo     Severity = "info"
+)
+
+// Severities lists the severities from the most to the least important
+var Severities = []Severity{SeverityCritical, SeverityMajor, SeverityMinor, SeverityInfo}
+
+// reviewCategories are the categories the model chooses from
+var reviewCategories = []string{"bug", "security", "performance", "maintainability", "style", "documentation", "test"}
+
+// Finding is an issue that the review found in the diff
+type Finding struct {
+	File string `json:"file"`
+	// StartLine and EndLine are the lines in the new version of the file
+	StartLine int      `json:"startLine"`
+	EndLine   int      `json:"endLine"`
+	Severity  Severity `json:"severity"`
+	Category  string   `json:"category"`
+	Message   string   `json:"message"`
+	// Suggestion is the code that fixes the issue, when the model has one
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// Review is the structured result of a review
+type Review struct {
+	Summary  string    `json:"summary"`
+	Findings []Finding `json:"findings"`
+}
+
+// reviewSchema is the response schema of a structured review
+var reviewSchema = &Schema{
+	Type: "object",
+	Properties: map[string]*Schema{
+		"summary": {Type: "string", Description: "one or two sentences about the change"},
+		"findings": {
+			Type: "array",
+			Items: &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"file":       {Type: "string", Description: "path of the file as in the diff"},
+					"startLine":  {Type: "integer", Description: "first line of the issue in the new version of the file"},
+					"endLine":    {Type: "integer", Description: "last line of the issue in the new version of the file"},
+					"severity":   {Type: "string", Enum: severityNames()},
+					"category":   {Type: "string", Enum: reviewCategories},
+					"message":    {Type: "string", Description: "what is wrong and why"},
+					"suggestion": {Type: "string", Description: "the code that fixes the issue, empty when there is none"},
+				},
+				Required: []string{"file", "startLine", "endLine", "severity", "category", "message"},
+			},
+		},
+	},
+	Required: []string{"summary", "findings"},
+}
+
+// structuredReviewPrompt asks for the findings, the layout
+// of the answer is enforced by the response schema
+const structuredReviewPrompt = `Review the git diff in the file {fileUri}. Report every issue as a
+finding with the file, the lines in the new version of the file, the severity, the category,
+a short explanation and, when it helps, the code that fixes it. Report no findings when the
+change is fine. Summarize the change in one or two sentences.`
+
+func severityNames() []string {
+	names := make([]string, len(Severities))
+	for i, severity := range Severities {
+		names[i] = string(severity)
+	}
+
+	return names
+}
+
+// rank orders the severities, the most important first
+func (s Severity) rank() int {
+	if i := slices.Index(Severities, s); i >= 0 {
+		return i
+	}
+
+	return len(Severities)
+}
+
+// ParseReview decodes the JSON answer of a structured review. A code
+// fence around the JSON is ignored, an unknown severity becomes info.
+// The findings are sorted by file and line, so that the findings of
+// two runs can be compared.
+func ParseReview(text string) (Review, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		// like ```json ... ```
+		_, text, _ = strings.Cut(text, "\n")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+
+	var review Review
+	if err := json.Unmarshal([]byte(text), &review); err != nil {
+		return Review{}, fmt.Errorf("the review is not valid JSON: %w", err)
+	}
+	for i := range review.Findings {
+		finding := &review.Findings[i]
+		finding.Severity = Severity(strings.ToLower(string(finding.Severity)))
+		if finding.Severity.rank() == len(Severities) {
+			finding.Severity = SeverityInfo
+		}
+		if finding.EndLine < finding.StartLine {
+			finding.EndLine = finding.StartLine
+		}
+	}
+	sortFindings(review.Findings)
+
+	return review, nil
+}
+
+// sortFindings sorts the findings by file, line and severity
+func sortFindings(findings []Finding) {
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return cmp.Or(
+			strings.Compare(a.File, b.File),
+			cmp.Compare(a.StartLine, b.StartLine),
+			cmp.Compare(a.Severity.rank(), b.Severity.rank()),
+		)
+	})
+}
+
+// StructuredReview reviews the source like ReviewFile,
+// but the answer is JSON with the findings, which is parsed into a
+// Review. The JSON answer is added to the chat history.
+func (m *theModel) StructuredReview(ctx context.Context, source ReviewSource, onChunk func(string)) (Review, error) {
+	answer, err := m.review(ctx, source, structuredReviewPrompt, reviewSchema, onChunk)
+	if err != nil {
+		return Review{}, err
+	}
+	review, err := ParseReview(answer)
+	if err != nil {
+		log.Printf("Unparsable review: %s", answer)
+		return Review{}, err
+	}
+
+	return review, nil
+}
@@ -0,0 +1,92 @@
+package genaimodel
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseReview(t *testing.T) {
+	review, err := ParseReview("```json\n" + `{"summary":"Adds a cache.","findings":[
+		{"file":"b.go","startLine":3,"endLine":1,"severity":"Major","category":"bug","message":"nil map"},
+		{"file":"a.go","startLine":9,"endLine":9,"severity":"urgent","category":"style","message":"naming"},
+		{"file":"a.go","startLine":2,"endLine":4,"severity":"critical","category":"security","message":"injection","suggestion":"quote(x)"}
+	]}` + "\n```")
+	if err != nil {
+		t.Fatalf("ParseReview failed: %v", err)
+	}
+	expected := []Finding{
+		{File: "a.go", StartLine: 2, EndLine: 4, Severity: SeverityCritical, Category: "security", Message: "injection", Suggestion: "quote(x)"},
+		{File: "a.go", StartLine: 9, EndLine: 9, Severity: SeverityInfo, Category: "style", Message: "naming"},
+		{File: "b.go", StartLine: 3, EndLine: 3, Severity: SeverityMajor, Category: "bug", Message: "nil map"},
+	}
+	if review.Summary != "Adds a cache." || len(review.Findings) != len(expected) {
+		t.Fatalf("unexpected review %+v", review)
+	}
+	for i, finding := range review.Findings {
+		if finding != expected[i] {
+			t.Errorf("finding %d: expected %+v, got %+v", i, expected[i], finding)
+		}
+	}
+
+	if _, err := ParseReview("Looks good to me!"); err == nil {
+		t.Error("expected an error for an answer that is not JSON")
+	}
+}
+
+func TestStructuredReview(t *testing.T) {
+	provider := &fakeProvider{chunks: []string{`{"summary":"Fine.",`, `"findings":[]}`}}
+	model, _ := NewModel(context.Background(), provider, "review")
+	registry, _ := NewToolRegistry(echoTool)
+	model.SetTools(registry)
+
+	source := ReviewSource{Name: "gitdiff.txt", Contents: []byte("+func main() {}\n")}
+	review, err := model.StructuredReview(context.Background(), source, func(string) {})
+	if err != nil {
+		t.Fatalf("StructuredReview failed: %v", err)
+	}
+	if review.Summary != "Fine." || len(review.Findings) != 0 {
+		t.Errorf("unexpected review %+v", review)
+	}
+	req := provider.requests[0]
+	if req.ResponseSchema != reviewSchema || len(req.Tools) != 0 {
+		t.Errorf("expected the review schema without tools, got %+v", req)
+	}
+	if model.GetHistoryLength() != 2 {
+		t.Errorf("expected the review in the history, got %d messages", model.GetHistoryLength())
+	}
+}
+
+func TestResponseSchemaPerBackend(t *testing.T) {
+	req := Request{Message: NewTextMessage("review", RoleUser), ResponseSchema: reviewSchema}
+
+	config := toGenaiConfig(req)
+	if config == nil || config.ResponseMIMEType != "application/json" ||
+		config.ResponseSchema == nil || config.ResponseSchema.Type != "OBJECT" {
+		t.Errorf("unexpected gemini config %+v", config)
+	}
+
+	format, _ := json.Marshal(toOpenAIResponseFormat(req.ResponseSchema))
+	if !strings.Contains(string(format), `"type":"json_schema","json_schema":{"name":"response","schema":{"type":"object"`) {
+		t.Errorf("unexpected openai response format %s", format)
+	}
+
+	if system := anthropicSystem(req); !strings.HasPrefix(system, "Answer only with a JSON object") ||
+		!strings.Contains(system, `"findings"`) {
+		t.Errorf("unexpected anthropic system prompt %q", system)
+	}
+}
+
+func TestReviewEmptySource(t *testing.T) {
+	provider := &fakeProvider{}
+	model, _ := NewModel(context.Background(), provider, "review")
+
+	_, err := model.ReviewFile(context.Background(), ReviewSource{Name: "git diff --staged"}, func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "git diff --staged is empty") {
+		t.Errorf("expected an error for an empty source, got %v", err)
+	}
+	if len(provider.requests) != 0 {
+		t.Errorf("expected no request, got %d", len(provider.requests))
+	}
+}
@@ -0,0 +1,61 @@
+package genaimodel
+
+import (
+	"bufio"
+	"io"
+	"iter"
+	"strings"
+)
+
+// sseEvent is a single server-sent event
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// readSSE reads the server-sent events from the stream. Multiple
+// "data:" lines of one event are joined with a newline, events are
+// separated by an empty line.
+func readSSE(r io.Reader) iter.Seq2[sseEvent, error] {
+	return func(yield func(sseEvent, error) bool) {
+		scanner := bufio.NewScanner(r)
+		// a single event can contain a large json document
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+		var event sseEvent
+		var data []string
+		flush := func() bool {
+			if len(data) == 0 {
+				event = sseEvent{}
+				return true
+			}
+			event.Data = strings.Join(data, "\n")
+			ok := yield(event, nil)
+			event = sseEvent{}
+			data = nil
+			return ok
+		}
+
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if !flush() {
+					return
+				}
+			case strings.HasPrefix(line, ":"):
+				// comment, used as keep-alive
+			case strings.HasPrefix(line, "event:"):
+				event.Event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(sseEvent{}, err)
+			return
+		}
+		// the last event does not have to be followed by an empty line
+		flush()
+	}
+}
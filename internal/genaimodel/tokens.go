@@ -0,0 +1,228 @@
+package genaimodel
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+const (
+	// charsPerToken is the rule of thumb for english text and code
+	charsPerToken = 4
+	// messageOverheadTokens covers the role and separators of a message
+	messageOverheadTokens = 4
+	// fileTokenEstimate is used for uploaded files, their size is unknown
+	fileTokenEstimate = 2000
+	// countMarginPercent is kept free of the budget when the tokens are
+	// counted after the estimate, so the count rarely finds too many
+	countMarginPercent = 10
+)
+
+// TokenCounter is implemented by providers that can count
+// the tokens of a request exactly
+type TokenCounter interface {
+	CountTokens(ctx context.Context, req Request) (int, error)
+}
+
+// TokenBudget is the maximum number of tokens of the context
+// that is send to the model. Zero means no limit.
+type TokenBudget struct {
+	Default int
+	// Models overrides the Default budget per model name
+	Models map[string]int
+}
+
+// ForModel returns the budget for the model
+func (tb TokenBudget) ForModel(model string) int {
+	if budget, ok := tb.Models[model]; ok {
+		return budget
+	}
+
+	return tb.Default
+}
+
+// ContextUsage describes the context of the last request
+type ContextUsage struct {
+	Tokens int
+	Budget int
+	// Dropped is the number of history messages that were
+	// left out of the request to stay within the budget
+	Dropped int
+	// Estimated is true when the tokens are not counted by the provider
+	Estimated bool
+	// ThoughtTokens is the number of tokens the model used to
+	// think about the answer, when the provider reports it
+	ThoughtTokens int
+	// FinishReason tells why the model stopped the last answer
+	FinishReason FinishReason
+	// Continuations is the number of times the answer was
+	// continued after it was cut off at the maximum output tokens
+	Continuations int
+}
+
+// String returns the usage for the progress view
+func (cu ContextUsage) String() string {
+	approx := ""
+	if cu.Estimated {
+		approx = "~"
+	}
+	usage := fmt.Sprintf("Context: %s%d", approx, cu.Tokens)
+	if cu.Budget > 0 {
+		usage = fmt.Sprintf("%s/%d", usage, cu.Budget)
+	}
+	usage = usage + " tokens"
+	if cu.Dropped > 0 {
+		usage = fmt.Sprintf("%s (%d trimmed)", usage, cu.Dropped)
+	}
+	if cu.ThoughtTokens > 0 {
+		usage = fmt.Sprintf("%s / Thinking: %d tokens", usage, cu.ThoughtTokens)
+	}
+	if cu.Continuations > 0 {
+		usage = fmt.Sprintf("%s / Continuations: %d", usage, cu.Continuations)
+	}
+	if notice := cu.FinishReason.Notice(); notice != "" {
+		usage = fmt.Sprintf("%s / Note: %s", usage, notice)
+	}
+
+	return usage
+}
+
+// estimateTokens estimates the tokens of a text locally
+func estimateTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+func estimateMessageTokens(m Message) int {
+	tokens := messageOverheadTokens
+	for _, p := range m.Parts {
+		tokens += estimateTokens(p.Text)
+		switch {
+		case p.FileData != nil:
+			tokens += fileTokenEstimate
+		case p.InlineData != nil && p.InlineData.isText():
+			tokens += estimateTokens(string(p.InlineData.Data))
+		case p.InlineData != nil:
+			tokens += fileTokenEstimate
+		}
+	}
+
+	return tokens
+}
+
+func estimateRequestTokens(req Request) int {
+	tokens := estimateTokens(req.SystemInstruction) + estimateMessageTokens(req.Message)
+	for _, m := range req.History {
+		tokens += estimateMessageTokens(m)
+	}
+
+	return tokens
+}
+
+// historyTurn is a user message with the model messages that
+// follow it, trimming drops whole turns to keep the roles in order
+type historyTurn struct {
+	messages []Message
+	pinned   bool
+	// summary is the turn with the summary of the compacted messages
+	summary bool
+}
+
+func groupTurns(history []Message) []historyTurn {
+	var turns []historyTurn
+	for _, m := range history {
+		if m.Role == RoleUser || len(turns) == 0 {
+			turns = append(turns, historyTurn{})
+		}
+		last := &turns[len(turns)-1]
+		last.messages = append(last.messages, m)
+		last.pinned = last.pinned || m.Pinned
+		last.summary = last.summary || m.Summary
+	}
+
+	return turns
+}
+
+func flattenTurns(turns []historyTurn) []Message {
+	var history []Message
+	for _, t := range turns {
+		history = append(history, t.messages...)
+	}
+
+	return history
+}
+
+// dropOldestTurn removes the oldest turn that is not pinned, the
+// summary is kept as it replaces all the compacted turns.
+// Returns the number of messages that were dropped, zero when
+// nothing could be dropped.
+func dropOldestTurn(turns *[]historyTurn) int {
+	for i := 0; i < len(*turns); i++ {
+		if (*turns)[i].pinned || (*turns)[i].summary {
+			continue
+		}
+		dropped := len((*turns)[i].messages)
+		*turns = append((*turns)[:i], (*turns)[i+1:]...)
+		return dropped
+	}
+
+	return 0
+}
+
+// fitRequest trims the oldest turns of the history in the request
+// until the request fits the token budget of the model. The system
+// instruction, pinned turns, the summary and the new message are kept.
+// The full chat history itself is not changed. When the provider can
+// count the tokens, the turns are dropped against the estimate with a
+// margin and the result is counted once, a count over the budget drops
+// more turns against the estimate corrected by the count.
+func (m *theModel) fitRequest(ctx context.Context, req Request) Request {
+	budget := m.tokenBudget.ForModel(req.Model)
+	turns := groupTurns(req.History)
+	usage := ContextUsage{Budget: budget, Estimated: true}
+
+	tokens := estimateRequestTokens(req)
+	if budget > 0 {
+		counter, counting := m.provider.(TokenCounter)
+		limit := budget
+		if counting {
+			limit = budget * (100 - countMarginPercent) / 100
+		}
+		for tokens > limit {
+			dropped := dropOldestTurn(&turns)
+			if dropped == 0 {
+				break
+			}
+			usage.Dropped += dropped
+			req.History = flattenTurns(turns)
+			tokens = estimateRequestTokens(req)
+		}
+
+		// the estimate is only a rule of thumb, verify it with
+		// a single count of the provider
+		if counting {
+			estimated := tokens
+			counted, err := counter.CountTokens(ctx, req)
+			if err != nil {
+				log.Printf("Error counting tokens, using estimate: %v", err)
+			} else {
+				tokens = counted
+				usage.Estimated = false
+				for tokens > budget && estimated > 0 {
+					dropped := dropOldestTurn(&turns)
+					if dropped == 0 {
+						break
+					}
+					usage.Dropped += dropped
+					usage.Estimated = true
+					req.History = flattenTurns(turns)
+					tokens = estimateRequestTokens(req) * counted / estimated
+				}
+			}
+		}
+	}
+
+	usage.Tokens = tokens
+	m.contextUsage = usage
+
+	return req
+}
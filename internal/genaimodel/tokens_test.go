@@ -0,0 +1,99 @@
+package genaimodel
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFitRequestTrimsOldestTurns(t *testing.T) {
+	provider := &fakeProvider{chunks: []string{"ok"}}
+	model, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+
+	// every turn of about 100 tokens
+	long := strings.Repeat("x", 400)
+	for _, q := range []string{"first", "second", "third"} {
+		if _, err := model.ChatMessage(context.Background(), q+long, func(string) {}); err != nil {
+			t.Fatalf("ChatMessage failed: %v", err)
+		}
+		if q == "first" {
+			if !model.PinLastTurn() {
+				t.Fatal("expected the first turn to be pinned")
+			}
+		}
+	}
+
+	model.SetTokenBudget(TokenBudget{Default: 1000, Models: map[string]int{"fake-model": 300}})
+	if _, err := model.ChatMessage(context.Background(), "fourth"+long, func(string) {}); err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+
+	last := provider.requests[len(provider.requests)-1]
+	var texts []string
+	for _, m := range last.History {
+		text := m.Text()
+		texts = append(texts, text[:min(len(text), 5)])
+	}
+	// the pinned first turn remains, the new message is not part of the history
+	joined := strings.Join(texts, ",")
+	if joined != "first,ok" || !strings.HasPrefix(last.Message.Text(), "fourth") {
+		t.Errorf("unexpected history in request: %s", joined)
+	}
+
+	usage := model.GetContextUsage()
+	if usage.Dropped != 4 || usage.Budget != 300 || !usage.Estimated {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	if model.GetHistoryLength() != 8 {
+		t.Errorf("the chat history itself should not be trimmed, has %d messages", model.GetHistoryLength())
+	}
+}
+
+func TestContextUsageString(t *testing.T) {
+	usage := ContextUsage{Tokens: 1200, Budget: 8000, Dropped: 2, Estimated: true}
+	if usage.String() != "Context: ~1200/8000 tokens (2 trimmed)" {
+		t.Errorf("unexpected usage string %q", usage.String())
+	}
+
+	usage.ThoughtTokens = 350
+	if usage.String() != "Context: ~1200/8000 tokens (2 trimmed) / Thinking: 350 tokens" {
+		t.Errorf("unexpected usage string %q", usage.String())
+	}
+}
+
+// countingProvider counts twice the estimated tokens
+type countingProvider struct {
+	fakeProvider
+	counts int
+}
+
+func (c *countingProvider) CountTokens(ctx context.Context, req Request) (int, error) {
+	c.counts++
+	return 2 * estimateRequestTokens(req), nil
+}
+
+func TestFitRequestCountsOnce(t *testing.T) {
+	provider := &countingProvider{fakeProvider: fakeProvider{chunks: []string{"ok"}}}
+	model, _ := NewModel(context.Background(), provider, "")
+	long := strings.Repeat("x", 400)
+	for range 6 {
+		if _, err := model.ChatMessage(context.Background(), long, func(string) {}); err != nil {
+			t.Fatalf("ChatMessage failed: %v", err)
+		}
+	}
+
+	model.SetTokenBudget(TokenBudget{Default: 500})
+	if _, err := model.ChatMessage(context.Background(), long, func(string) {}); err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	// the turns are dropped against the estimate, corrected by a single count
+	if provider.counts != 1 {
+		t.Errorf("expected a single count, got %d", provider.counts)
+	}
+	if usage := model.GetContextUsage(); usage.Dropped == 0 || usage.Tokens > 500 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
@@ -0,0 +1,266 @@
+package genaimodel
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"log"
+	"slices"
+	"sync"
+)
+
+// maxToolRounds limits the number of times the model can call
+// tools before it has to answer, a model that keeps calling
+// tools would otherwise never finish
+const maxToolRounds = 10
+
+// Schema is the JSON schema of the parameters of a tool or of a
+// structured answer, it marshals to the layout that the backends expect
+type Schema struct {
+	// Type is a JSON schema type like "object", "string" or "integer"
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+}
+
+// ToolDeclaration describes a tool to the model
+type ToolDeclaration struct {
+	Name        string
+	Description string
+	// Parameters is the schema of an object with the
+	// arguments, nil for a tool without arguments
+	Parameters *Schema
+}
+
+// Tool is a Go function that the model can call
+type Tool struct {
+	ToolDeclaration
+	// Run executes the tool with the arguments the model gave,
+	// the output or the error is send back to the model
+	Run func(ctx context.Context, args map[string]any) (string, error)
+	// ReadOnly tools run without asking, all other tools
+	// write files or run commands and need the approval of the user
+	ReadOnly bool
+	// Preview optionally shows what the tool is going to
+	// do, like the diff of a file write, to decide on the approval
+	Preview func(ctx context.Context, args map[string]any) (string, error)
+}
+
+// Approval is the decision of the user on a tool call
+type Approval int
+
+const (
+	ApprovalDeny Approval = iota
+	ApprovalApprove
+	// ApprovalAlways approves this and the next calls of
+	// the tool for the rest of the session
+	ApprovalAlways
+)
+
+// ApprovalRequest is shown to the user before a tool with side effects runs
+type ApprovalRequest struct {
+	Call FunctionCall
+	// Preview of what the tool is going to do, empty when the
+	// tool has no preview, or the error of the preview
+	Preview string
+}
+
+// Approver asks the user whether the tool call can run, it blocks
+// until the user decided and denies when the ctx is cancelled
+type Approver func(ctx context.Context, request ApprovalRequest) Approval
+
+// ToolRegistry holds the tools that are offered to the model,
+// the zero value is an empty registry
+type ToolRegistry struct {
+	tools []Tool
+
+	allowedMutex sync.Mutex
+	allowed      map[string]bool // tools that are always allowed this session
+}
+
+// NewToolRegistry returns a registry with the tools
+func NewToolRegistry(tools ...Tool) (*ToolRegistry, error) {
+	registry := &ToolRegistry{}
+	if err := registry.Register(tools...); err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// Register adds the tools, the names must be unique
+func (r *ToolRegistry) Register(tools ...Tool) error {
+	for _, tool := range tools {
+		if tool.Name == "" || tool.Run == nil {
+			return fmt.Errorf("tool %q needs a name and a Run func", tool.Name)
+		}
+		if _, ok := r.lookup(tool.Name); ok {
+			return fmt.Errorf("tool %q is registered twice", tool.Name)
+		}
+		r.tools = append(r.tools, tool)
+	}
+
+	return nil
+}
+
+// Declarations returns the declarations of the registered tools
+func (r *ToolRegistry) Declarations() []ToolDeclaration {
+	if r == nil {
+		return nil
+	}
+	declarations := make([]ToolDeclaration, 0, len(r.tools))
+	for _, tool := range r.tools {
+		declarations = append(declarations, tool.ToolDeclaration)
+	}
+
+	return declarations
+}
+
+func (r *ToolRegistry) lookup(name string) (Tool, bool) {
+	for _, tool := range r.tools {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+
+	return Tool{}, false
+}
+
+// Call runs the tool of the function call, an unknown tool or
+// a failing tool results in an error for the model to read. A tool
+// that is not read-only only runs when approve approves it, the model
+// is told when the user denied the call.
+func (r *ToolRegistry) Call(ctx context.Context, call FunctionCall, approve Approver) FunctionResponse {
+	response := FunctionResponse{ID: call.ID, Name: call.Name}
+	tool, ok := r.lookup(call.Name)
+	if !ok {
+		response.Response = map[string]any{"error": fmt.Sprintf("there is no tool %q", call.Name)}
+		return response
+	}
+	if !tool.ReadOnly && !r.approved(ctx, tool, call, approve) {
+		log.Printf("The call of tool %s was denied", call.Name)
+		response.Response = map[string]any{"error": "the user denied this call of the tool, do not retry it"}
+		return response
+	}
+
+	output, err := tool.Run(ctx, call.Args)
+	if err != nil {
+		response.Response = map[string]any{"error": err.Error()}
+		return response
+	}
+	response.Response = map[string]any{"output": output}
+
+	return response
+}
+
+// approved asks the approval of the call, unless the
+// user already allowed the tool for the rest of the session
+func (r *ToolRegistry) approved(ctx context.Context, tool Tool, call FunctionCall, approve Approver) bool {
+	r.allowedMutex.Lock()
+	allowed := r.allowed[tool.Name]
+	r.allowedMutex.Unlock()
+	if allowed {
+		return true
+	}
+	if approve == nil {
+		return false
+	}
+
+	request := ApprovalRequest{Call: call}
+	if tool.Preview != nil {
+		preview, err := tool.Preview(ctx, call.Args)
+		if err != nil {
+			preview = fmt.Sprintf("no preview: %v", err)
+		}
+		request.Preview = preview
+	}
+	switch approve(ctx, request) {
+	case ApprovalAlways:
+		r.allowedMutex.Lock()
+		defer r.allowedMutex.Unlock()
+		if r.allowed == nil {
+			r.allowed = map[string]bool{}
+		}
+		r.allowed[tool.Name] = true
+		return true
+	case ApprovalApprove:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *theModel) SetTools(tools *ToolRegistry) {
+	m.tools = tools
+}
+
+func (m *theModel) SetToolApprover(approve Approver) {
+	m.approve = approve
+}
+
+// generate streams the answer to the request. When tools are set,
+// the function calls of the model are run and the results are send
+// back until the model answers without calling a tool. Only the text
+// and the thoughts are yielded, the function calls and their results
+// are not added to the chat history.
+func (m *theModel) generate(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	req.Tools = m.tools.Declarations()
+	if len(req.Tools) == 0 {
+		return m.stream(ctx, req)
+	}
+
+	return func(yield func(*Response, error) bool) {
+		for round := 0; ; round++ {
+			var modelParts []Part
+			for resp, err := range m.stream(ctx, req) {
+				if err != nil {
+					yield(nil, err)
+					return
+				}
+				var parts []Part
+				for _, part := range resp.Parts {
+					if !part.Thought {
+						modelParts = append(modelParts, part)
+					}
+					if part.FunctionCall == nil {
+						parts = append(parts, part)
+					}
+				}
+				if len(parts) == 0 {
+					continue
+				}
+				if !yield(&Response{Parts: parts, Usage: resp.Usage}, nil) {
+					return
+				}
+			}
+
+			var results []Part
+			for _, part := range modelParts {
+				if part.FunctionCall == nil {
+					continue
+				}
+				log.Printf("Calling tool %s with %v", part.FunctionCall.Name, part.FunctionCall.Args)
+				response := m.tools.Call(ctx, *part.FunctionCall, m.approve)
+				results = append(results, Part{FunctionResponse: &response})
+			}
+			if len(results) == 0 {
+				return
+			}
+			if ctx.Err() != nil {
+				yield(nil, ctx.Err())
+				return
+			}
+			if round+1 >= maxToolRounds {
+				yield(nil, fmt.Errorf("the model still calls tools after %d rounds", maxToolRounds))
+				return
+			}
+
+			// the next round continues with the function calls and their results
+			req.History = append(slices.Clone(req.History), req.Message, newModelMessage(modelParts))
+			req.Message = Message{Parts: results, Role: RoleUser}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package genaimodel
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"testing"
+)
+
+// echoTool returns its "text" argument
+var echoTool = Tool{
+	ReadOnly: true,
+	ToolDeclaration: ToolDeclaration{
+		Name: "echo",
+		Parameters: &Schema{
+			Type:       "object",
+			Properties: map[string]*Schema{"text": {Type: "string"}},
+		},
+	},
+	Run: func(ctx context.Context, args map[string]any) (string, error) {
+		text, _ := args["text"].(string)
+		if text == "" {
+			return "", errors.New("text is empty")
+		}
+		return text, nil
+	},
+}
+
+func TestToolRegistry(t *testing.T) {
+	registry, err := NewToolRegistry(echoTool)
+	if err != nil {
+		t.Fatalf("NewToolRegistry failed: %v", err)
+	}
+	if err := registry.Register(echoTool); err == nil {
+		t.Error("expected an error for a tool that is registered twice")
+	}
+	if declarations := registry.Declarations(); len(declarations) != 1 || declarations[0].Name != "echo" {
+		t.Errorf("unexpected declarations %+v", declarations)
+	}
+
+	tests := []struct {
+		call     FunctionCall
+		expected map[string]any
+	}{
+		{FunctionCall{ID: "1", Name: "echo", Args: map[string]any{"text": "hi"}}, map[string]any{"output": "hi"}},
+		{FunctionCall{ID: "2", Name: "echo"}, map[string]any{"error": "text is empty"}},
+		{FunctionCall{ID: "3", Name: "rm"}, map[string]any{"error": `there is no tool "rm"`}},
+	}
+	for _, tt := range tests {
+		response := registry.Call(context.Background(), tt.call, nil)
+		if response.ID != tt.call.ID || response.Name != tt.call.Name ||
+			response.Response["output"] != tt.expected["output"] || response.Response["error"] != tt.expected["error"] {
+			t.Errorf("call %+v: unexpected response %+v", tt.call, response)
+		}
+	}
+}
+
+// toolCallingProvider calls the echo tool, and answers
+// with the result once it is send back
+type toolCallingProvider struct {
+	fakeProvider
+}
+
+func (tp *toolCallingProvider) Stream(ctx context.Context, req Request) iter.Seq2[*Response, error] {
+	tp.requests = append(tp.requests, req)
+	return func(yield func(*Response, error) bool) {
+		for _, p := range req.Message.Parts {
+			if p.FunctionResponse != nil {
+				yield(&Response{Parts: []Part{{Text: "the tool said " + p.FunctionResponse.text()}}}, nil)
+				return
+			}
+		}
+		yield(&Response{Parts: []Part{
+			{Text: "let me check"},
+			{FunctionCall: &FunctionCall{ID: "call_1", Name: "echo", Args: map[string]any{"text": "pong"}}},
+		}}, nil)
+	}
+}
+
+func TestChatMessageRunsTools(t *testing.T) {
+	provider := &toolCallingProvider{}
+	model, err := NewModel(context.Background(), provider, "")
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	registry, _ := NewToolRegistry(echoTool)
+	model.SetTools(registry)
+
+	result, err := model.ChatMessage(context.Background(), "ping", func(string) {})
+	if err != nil {
+		t.Fatalf("ChatMessage failed: %v", err)
+	}
+	if result.Response != "let me checkthe tool said pong" {
+		t.Errorf("unexpected response %q", result.Response)
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(provider.requests))
+	}
+	first, second := provider.requests[0], provider.requests[1]
+	if len(first.Tools) != 1 || first.Tools[0].Name != "echo" {
+		t.Errorf("the tools are not declared: %+v", first.Tools)
+	}
+	// the second request continues with the call and its result
+	if len(second.History) != 2 || second.History[0].Text() != "ping" ||
+		second.History[1].Parts[1].FunctionCall.Name != "echo" {
+		t.Errorf("unexpected history %+v", second.History)
+	}
+	response := second.Message.Parts[0].FunctionResponse
+	if response == nil || response.ID != "call_1" || response.Response["output"] != "pong" {
+		t.Errorf("unexpected message %+v", second.Message)
+	}
+
+	// only the question and the answer are recorded
+	if model.GetHistoryLength() != 2 {
+		t.Errorf("expected the question and the answer in the history, got %d messages", model.GetHistoryLength())
+	}
+}
+
+func TestNewModelMessage(t *testing.T) {
+	call := &FunctionCall{Name: "echo"}
+	message := newModelMessage([]Part{
+		{Text: "thinking", Thought: true},
+		{Text: "Hel"},
+		{Text: "lo"},
+		{FunctionCall: call},
+	})
+	if message.Role != RoleModel || len(message.Parts) != 2 ||
+		message.Parts[0].Text != "Hello" || message.Parts[1].FunctionCall != call {
+		t.Errorf("unexpected message %+v", message)
+	}
+}
+
+func TestToolApproval(t *testing.T) {
+	writes := 0
+	writeTool := Tool{
+		ToolDeclaration: ToolDeclaration{Name: "write"},
+		Run: func(ctx context.Context, args map[string]any) (string, error) {
+			writes++
+			return "written", nil
+		},
+		Preview: func(ctx context.Context, args map[string]any) (string, error) {
+			return "+new line", nil
+		},
+	}
+	registry, _ := NewToolRegistry(writeTool)
+	call := FunctionCall{Name: "write"}
+
+	// without an approver the tool does not run
+	if response := registry.Call(context.Background(), call, nil); response.Response["error"] == nil {
+		t.Errorf("expected the call to be denied, got %+v", response)
+	}
+
+	var requests []ApprovalRequest
+	approver := func(decisions ...Approval) Approver {
+		return func(ctx context.Context, request ApprovalRequest) Approval {
+			requests = append(requests, request)
+			decision := decisions[0]
+			decisions = decisions[1:]
+			return decision
+		}
+	}
+	approve := approver(ApprovalDeny, ApprovalApprove, ApprovalAlways)
+	for _, expected := range []string{"", "written", "written", "written"} {
+		response := registry.Call(context.Background(), call, approve)
+		if output, _ := response.Response["output"].(string); output != expected {
+			t.Errorf("expected output %q, got %+v", expected, response)
+		}
+	}
+	// after "always" the user is not asked again
+	if len(requests) != 3 || requests[0].Preview != "+new line" || writes != 3 {
+		t.Errorf("unexpected approval requests %+v after %d writes", requests, writes)
+	}
+}
@@ -0,0 +1,286 @@
+// Package mcp is a client for Model Context Protocol servers that run
+// as a child process and speak JSON-RPC over stdin and stdout. The tools
+// of the servers are offered to the model through the genaimodel tools.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	protocolVersion = "2025-06-18"
+	clientName      = "ai-chat"
+	clientVersion   = "0.1.0"
+	// closeTimeout is the time a server gets to exit after its
+	// stdin is closed, before it is killed
+	closeTimeout = 2 * time.Second
+)
+
+// ServerConfig is the command that starts an MCP server
+type ServerConfig struct {
+	// Name identifies the server, it prefixes the names of its tools
+	Name    string
+	Command string
+	Args    []string
+	// Env is added to the environment of the server
+	Env map[string]string
+}
+
+// RPCError is the error object of a JSON-RPC response
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// message is a JSON-RPC request, notification or response,
+// the fields that are set tell which one it is
+type message struct {
+	JSONRPC string `json:"jsonrpc"`
+	// ID is a number for the requests of the client,
+	// the server may use strings for its own requests
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params any             `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *RPCError       `json:"error,omitempty"`
+}
+
+// Client is the connection to one MCP server
+type Client struct {
+	name    string
+	encoder *json.Encoder
+	closer  io.Closer
+	cmd     *exec.Cmd // nil when the client was created with NewClient
+
+	mutex   sync.Mutex // guards the fields below and the writes of the encoder
+	nextID  int64
+	pending map[int64]chan message
+	err     error // set when the connection is lost
+	done    chan struct{}
+}
+
+// Start launches the server and performs the initialize handshake
+func Start(ctx context.Context, server ServerConfig) (*Client, error) {
+	cmd := exec.Command(server.Command, server.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range server.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	// the server logs to stderr
+	cmd.Stderr = log.Writer()
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting mcp server %s: %w", server.Name, err)
+	}
+
+	client := NewClient(server.Name, stdout, stdin)
+	client.cmd = cmd
+	if err := client.Initialize(ctx); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("initializing mcp server %s: %w", server.Name, err)
+	}
+
+	return client, nil
+}
+
+// NewClient creates the client on top of the output and the input of
+// a server, Initialize has to be called before the tools are used
+func NewClient(name string, r io.Reader, w io.WriteCloser) *Client {
+	c := &Client{
+		name:    name,
+		encoder: json.NewEncoder(w),
+		closer:  w,
+		pending: map[int64]chan message{},
+		done:    make(chan struct{}),
+	}
+	go c.read(r)
+
+	return c
+}
+
+// Name returns the name of the server
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Initialize performs the handshake: the initialize request
+// followed by the initialized notification
+func (c *Client) Initialize(ctx context.Context) error {
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": clientName, "version": clientVersion},
+	}, &result)
+	if err != nil {
+		return err
+	}
+	log.Printf("MCP server %s is %s %s, protocol %s", c.name,
+		result.ServerInfo.Name, result.ServerInfo.Version, result.ProtocolVersion)
+
+	return c.send(message{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+// call sends a request and decodes the result of the response into result
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	responseChan := make(chan message, 1)
+	c.pending[id] = responseChan
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		delete(c.pending, id)
+		c.mutex.Unlock()
+	}()
+
+	rawID := json.RawMessage(strconv.FormatInt(id, 10))
+	if err := c.send(message{JSONRPC: "2.0", ID: rawID, Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		// tell the server it can stop working on the request
+		_ = c.send(message{JSONRPC: "2.0", Method: "notifications/cancelled",
+			Params: map[string]any{"requestId": id}})
+		return ctx.Err()
+	case <-c.done:
+		return c.connectionError()
+	case response := <-responseChan:
+		if response.Error != nil {
+			return fmt.Errorf("%s: %w", method, response.Error)
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(response.Result, result)
+	}
+}
+
+func (c *Client) send(msg message) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.encoder.Encode(msg); err != nil {
+		return fmt.Errorf("writing to mcp server %s: %w", c.name, err)
+	}
+
+	return nil
+}
+
+// read dispatches the messages of the server until its output closes
+func (c *Client) read(r io.Reader) {
+	decoder := json.NewDecoder(r)
+	for {
+		var msg message
+		if err := decoder.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = fmt.Errorf("mcp server %s exited", c.name)
+			}
+			c.mutex.Lock()
+			if c.err == nil {
+				c.err = err
+			}
+			c.mutex.Unlock()
+			close(c.done)
+			return
+		}
+
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			c.answer(msg)
+		case msg.Method != "":
+			// notifications like log messages or list changes
+			log.Printf("MCP server %s: %s", c.name, msg.Method)
+		case msg.ID != nil:
+			var id int64
+			if err := json.Unmarshal(msg.ID, &id); err != nil {
+				log.Printf("MCP server %s: response with unknown id %s", c.name, msg.ID)
+				continue
+			}
+			c.mutex.Lock()
+			responseChan, ok := c.pending[id]
+			c.mutex.Unlock()
+			if ok {
+				responseChan <- msg
+			}
+		}
+	}
+}
+
+// answer responds to the requests of the server, the client has no
+// capabilities so only ping is supported
+func (c *Client) answer(request message) {
+	response := message{JSONRPC: "2.0", ID: request.ID}
+	if request.Method == "ping" {
+		response.Result = json.RawMessage("{}")
+	} else {
+		response.Error = &RPCError{Code: -32601, Message: "method not found: " + request.Method}
+	}
+	if err := c.send(response); err != nil {
+		log.Print(err)
+	}
+}
+
+func (c *Client) connectionError() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.err
+}
+
+// Close closes the input of the server and waits for it to exit
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	if c.err == nil {
+		c.err = fmt.Errorf("mcp server %s is closed", c.name)
+	}
+	c.mutex.Unlock()
+	err := c.closer.Close()
+	if c.cmd == nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- c.cmd.Wait() }()
+	select {
+	case <-exited:
+	case <-time.After(closeTimeout):
+		_ = c.cmd.Process.Kill()
+		<-exited
+	}
+
+	return err
+}
@@ -0,0 +1,191 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubServerEnv makes the test binary run the stub server, so Start can be
+// tested with a real child process
+const stubServerEnv = "AI_CHAT_MCP_STUB_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(stubServerEnv) != "" {
+		serveStub(os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// serveStub is a minimal MCP server with an echo tool on the first
+// page of the tools, a failing tool on the second page and a ping
+// of the client before it answers a tool call
+func serveStub(r io.Reader, w io.Writer) {
+	decoder := json.NewDecoder(r)
+	encoder := json.NewEncoder(w)
+	reply := func(id json.RawMessage, result any) {
+		raw, _ := json.Marshal(result)
+		_ = encoder.Encode(message{JSONRPC: "2.0", ID: id, Result: raw})
+	}
+	for {
+		var request struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				Cursor    string         `json:"cursor"`
+				Name      string         `json:"name"`
+				Arguments map[string]any `json:"arguments"`
+			} `json:"params"`
+		}
+		if err := decoder.Decode(&request); err != nil {
+			return
+		}
+		switch request.Method {
+		case "initialize":
+			reply(request.ID, map[string]any{
+				"protocolVersion": protocolVersion,
+				"serverInfo":      map[string]any{"name": "stub", "version": "1.0"},
+			})
+		case "tools/list":
+			if request.Params.Cursor == "" {
+				reply(request.ID, map[string]any{
+					"tools": []any{map[string]any{
+						"name":        "echo",
+						"description": "echoes the text",
+						"inputSchema": map[string]any{
+							"type":       "object",
+							"properties": map[string]any{"text": map[string]any{"type": []any{"string", "null"}}},
+							"required":   []any{"text"},
+						},
+						"annotations": map[string]any{"readOnlyHint": true},
+					}},
+					"nextCursor": "2",
+				})
+			} else {
+				reply(request.ID, map[string]any{
+					"tools": []any{map[string]any{"name": "fail/now", "inputSchema": map[string]any{"type": "object"}}},
+				})
+			}
+		case "tools/call":
+			_ = encoder.Encode(message{JSONRPC: "2.0", ID: json.RawMessage(`"ping-1"`), Method: "ping"})
+			var pong message
+			if err := decoder.Decode(&pong); err != nil || string(pong.ID) != `"ping-1"` {
+				return
+			}
+			if request.Params.Name == "echo" {
+				reply(request.ID, map[string]any{
+					"content": []any{map[string]any{"type": "text", "text": request.Params.Arguments["text"]}},
+				})
+			} else {
+				reply(request.ID, map[string]any{
+					"content": []any{map[string]any{"type": "text", "text": "it failed"}},
+					"isError": true,
+				})
+			}
+		default:
+			if request.ID != nil {
+				_ = encoder.Encode(message{JSONRPC: "2.0", ID: request.ID,
+					Error: &RPCError{Code: -32601, Message: "method not found"}})
+			}
+		}
+	}
+}
+
+func newStubClient(t *testing.T) *Client {
+	t.Helper()
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	go func() {
+		serveStub(serverReader, serverWriter)
+		_ = serverWriter.Close()
+	}()
+	client := NewClient("stub server", clientReader, clientWriter)
+	t.Cleanup(func() { _ = client.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	return client
+}
+
+func TestClientTools(t *testing.T) {
+	client := newStubClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tools, err := client.Tools(ctx)
+	if err != nil {
+		t.Fatalf("Tools failed: %v", err)
+	}
+	if len(tools) != 2 {
+		t.Fatalf("expected the tools of both pages, got %d", len(tools))
+	}
+	echo, fail := tools[0], tools[1]
+	if echo.Name != "stub_server_echo" || fail.Name != "stub_server_fail_now" {
+		t.Errorf("unexpected names %q and %q", echo.Name, fail.Name)
+	}
+	if !echo.ReadOnly || fail.ReadOnly {
+		t.Error("only the tool with the read-only hint is read-only")
+	}
+	if text := echo.Parameters.Properties["text"]; text == nil || text.Type != "string" {
+		t.Errorf("unexpected schema %+v", echo.Parameters)
+	}
+
+	output, err := echo.Run(ctx, map[string]any{"text": "hello"})
+	if err != nil || output != "hello" {
+		t.Errorf("unexpected echo %q, %v", output, err)
+	}
+	if _, err := fail.Run(ctx, nil); err == nil || err.Error() != "it failed" {
+		t.Errorf("expected the error of the tool, got %v", err)
+	}
+	if err := client.call(ctx, "resources/list", nil, nil); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+}
+
+func TestFunctionName(t *testing.T) {
+	if name := functionName("docs server", "docs.search"); name != "docs_server_docs_search" {
+		t.Errorf("unexpected name %q", name)
+	}
+	long := strings.Repeat("x", 70)
+	first, second := functionName("server", long+"_first"), functionName("server", long+"_second")
+	if len(first) != maxNameLength || len(second) != maxNameLength || first == second {
+		t.Errorf("expected two unique names of %d characters, got %q and %q", maxNameLength, first, second)
+	}
+}
+
+func TestStartServer(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := Start(ctx, ServerConfig{
+		Name:    "stub",
+		Command: executable,
+		Env:     map[string]string{stubServerEnv: "1"},
+	})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	infos, err := client.ListTools(ctx)
+	if err != nil || len(infos) != 2 {
+		t.Errorf("unexpected tools %v, %v", infos, err)
+	}
+	if err := client.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if _, err := client.ListTools(ctx); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("expected an error after Close, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+)
+
+// invalidNameChars are not allowed in the function names of the backends
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// maxNameLength is the longest function name the backends accept
+const maxNameLength = 64
+
+// ToolInfo is a tool as listed by the server
+type ToolInfo struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+	Annotations struct {
+		// ReadOnlyHint is set by the server for tools
+		// that do not change anything
+		ReadOnlyHint bool `json:"readOnlyHint"`
+	} `json:"annotations"`
+}
+
+// content is an item of the result of a tool call
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// ListTools returns all tools of the server, following the pages of the list
+func (c *Client) ListTools(ctx context.Context) ([]ToolInfo, error) {
+	var tools []ToolInfo
+	cursor := ""
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var result struct {
+			Tools      []ToolInfo `json:"tools"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool runs the tool on the server and returns the text of the
+// result, a result that the server marks as error is returned as error
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (string, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	var result struct {
+		Content []content `json:"content"`
+		IsError bool      `json:"isError"`
+	}
+	if err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &result); err != nil {
+		return "", err
+	}
+
+	var texts []string
+	for _, item := range result.Content {
+		if item.Type == "text" {
+			texts = append(texts, item.Text)
+		} else {
+			texts = append(texts, fmt.Sprintf("[%s content]", item.Type))
+		}
+	}
+	text := strings.Join(texts, "\n")
+	if result.IsError {
+		return "", errors.New(text)
+	}
+
+	return text, nil
+}
+
+// Tools returns the tools of the server for the tool registry. The names
+// are prefixed with the name of the server to keep them unique, tools
+// the server does not mark as read-only need the approval of the user.
+func (c *Client) Tools(ctx context.Context) ([]genaimodel.Tool, error) {
+	infos, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := make([]genaimodel.Tool, 0, len(infos))
+	for _, info := range infos {
+		toolName := info.Name
+		tools = append(tools, genaimodel.Tool{
+			ToolDeclaration: genaimodel.ToolDeclaration{
+				Name:        functionName(c.name, info.Name),
+				Description: info.Description,
+				Parameters:  toSchema(info.InputSchema),
+			},
+			Run: func(ctx context.Context, args map[string]any) (string, error) {
+				return c.CallTool(ctx, toolName, args)
+			},
+			ReadOnly: info.Annotations.ReadOnlyHint,
+		})
+	}
+
+	return tools, nil
+}
+
+// functionName joins the server and the tool name, the backends accept
+// at most 64 letters, digits, underscores and dashes. A longer name is
+// cut and ends with a hash of the whole name to keep it unique.
+func functionName(server, tool string) string {
+	name := invalidNameChars.ReplaceAllString(server+"_"+tool, "_")
+	if len(name) > maxNameLength {
+		hash := fnv.New32a()
+		hash.Write([]byte(server + "\x00" + tool))
+		suffix := fmt.Sprintf("_%08x", hash.Sum32())
+		name = name[:maxNameLength-len(suffix)] + suffix
+	}
+
+	return name
+}
+
+// toSchema converts the JSON schema of the server into the subset
+// the backends understand, other keywords are left out
+func toSchema(v any) *genaimodel.Schema {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) == 0 {
+		return nil
+	}
+
+	schema := &genaimodel.Schema{}
+	switch t := m["type"].(type) {
+	case string:
+		schema.Type = t
+	case []any:
+		// like ["string", "null"], the first type that is not null
+		for _, item := range t {
+			if s, ok := item.(string); ok && s != "null" {
+				schema.Type = s
+				break
+			}
+		}
+	}
+	if schema.Type == "" {
+		schema.Type = "object"
+	}
+	schema.Description, _ = m["description"].(string)
+	if properties, ok := m["properties"].(map[string]any); ok {
+		schema.Properties = map[string]*genaimodel.Schema{}
+		for name, property := range properties {
+			if propertySchema := toSchema(property); propertySchema != nil {
+				schema.Properties[name] = propertySchema
+			}
+		}
+	}
+	schema.Required = toStrings(m["required"])
+	schema.Enum = toStrings(m["enum"])
+	schema.Items = toSchema(m["items"])
+
+	return schema
+}
+
+func toStrings(v any) []string {
+	items, _ := v.([]any)
+	var strs []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+
+	return strs
+}
@@ -1,10 +1,34 @@
 package prompts
 
+import "strings"
+
 type Prompt struct {
 	Name   string
 	Prompt string
 }
 
+// Find returns the prompt with the name, the case
+// and the spaces around the name do not matter
+func Find(name string) (Prompt, bool) {
+	for _, prompt := range PromptList {
+		if strings.EqualFold(strings.TrimSpace(prompt.Name), strings.TrimSpace(name)) {
+			return prompt, true
+		}
+	}
+
+	return Prompt{}, false
+}
+
+// Names lists the names of the prompts
+func Names() []string {
+	names := make([]string, len(PromptList))
+	for i, prompt := range PromptList {
+		names[i] = strings.TrimSpace(prompt.Name)
+	}
+
+	return names
+}
+
 var PromptList = []Prompt{
 	{Name: "Tasks prompt",
 		Prompt: `You are an expert developer and git super user. You do code reviews based on the git diff output between two commits.
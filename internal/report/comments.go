@@ -0,0 +1,98 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MelleKoning/ai-chat/internal/diff"
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+)
+
+// The sides of a diff that a comment is on
+const (
+	SideLeft  = "LEFT"  // the old version, for a deleted file
+	SideRight = "RIGHT" // the new version
+)
+
+// Comment is an inline review comment in the shape that code hosts like
+// GitHub accept, a comment on more than one line has a StartLine
+type Comment struct {
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	Side      string `json:"side"`
+	StartLine int    `json:"start_line,omitempty"`
+	StartSide string `json:"start_side,omitempty"`
+	Body      string `json:"body"`
+}
+
+// Comments places the findings on the lines of the diff. The lines of a
+// finding that are not in a hunk are left out, a code host only accepts
+// comments on the lines it shows. The findings that are not on a line of
+// the diff at all, like a finding on the whole file, are returned apart.
+func Comments(review genaimodel.Review, files []diff.File) ([]Comment, []genaimodel.Finding) {
+	comments := []Comment{}
+	var skipped []genaimodel.Finding
+	for _, finding := range review.Findings {
+		comment, ok := placeComment(finding, files)
+		if !ok {
+			skipped = append(skipped, finding)
+			continue
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, skipped
+}
+
+// placeComment finds the first and the last line of the finding that are
+// in the diff, the findings are on the new version unless the file is deleted
+func placeComment(finding genaimodel.Finding, files []diff.File) (Comment, bool) {
+	file, ok := diff.FindFile(files, finding.File)
+	if !ok || finding.StartLine <= 0 {
+		return Comment{}, false
+	}
+	side, find := SideRight, file.FindNewLine
+	if file.NewPath == "" {
+		side, find = SideLeft, file.FindOldLine
+	}
+
+	first, last := finding.StartLine, max(finding.EndLine, finding.StartLine)
+	firstHunk, ok := find(first)
+	for !ok && first < last {
+		first++
+		firstHunk, ok = find(first)
+	}
+	if !ok {
+		return Comment{}, false
+	}
+	end, lastHunk := first, firstHunk
+	for line := last; line > first; line-- {
+		if hunk, ok := find(line); ok {
+			end, lastHunk = line, hunk
+			break
+		}
+	}
+	last = end
+
+	comment := Comment{Path: file.Path(), Line: last, Side: side, Body: commentBody(finding)}
+	switch {
+	case first == last:
+	case firstHunk != lastHunk:
+		// a comment can not span hunks, the end of the finding is the most specific
+		comment.Body += fmt.Sprintf("\n\n_%s of %s_", lines(finding), file.Path())
+	default:
+		comment.StartLine, comment.StartSide = first, side
+	}
+
+	return comment, true
+}
+
+// commentBody is the finding in markdown, like in Markdown
+func commentBody(finding genaimodel.Finding) string {
+	body := fmt.Sprintf("**%s** %s: %s", strings.ToUpper(string(finding.Severity)), finding.Category, finding.Message)
+	if finding.Suggestion != "" {
+		body += "\n\n```\n" + strings.TrimSuffix(finding.Suggestion, "\n") + "\n```"
+	}
+
+	return body
+}
@@ -0,0 +1,74 @@
+package report
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MelleKoning/ai-chat/internal/diff"
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+)
+
+const cacheDiff = `diff --git a/cache.go b/cache.go
+--- a/cache.go
++++ b/cache.go
+@@ -1,3 +1,4 @@
+ package cache
+ 
++var entries = map[string]string{}
+ func Get() {}
+@@ -20,2 +21,3 @@ func Put() {
+ 	x := 1
++	entries["a"] = "b"
+ }
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package old
+-func Old() {}
+`
+
+func TestComments(t *testing.T) {
+	files, err := diff.Parse(strings.NewReader(cacheDiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	finding := func(file string, start, end int) genaimodel.Finding {
+		return genaimodel.Finding{File: file, StartLine: start, EndLine: end,
+			Severity: genaimodel.SeverityMajor, Category: "bug", Message: "race"}
+	}
+	review := genaimodel.Review{Findings: []genaimodel.Finding{
+		finding("cache.go", 2, 3),
+		// the lines before the hunk are left out
+		finding("b/cache.go", 10, 22),
+		finding("cache.go", 3, 22),
+		finding("old.go", 2, 2),
+		finding("cache.go", 10, 12),
+		finding("missing.go", 1, 1),
+		finding("cache.go", 0, 0),
+	}}
+
+	comments, skipped := Comments(review, files)
+	expected := []Comment{
+		{Path: "cache.go", StartLine: 2, StartSide: SideRight, Line: 3, Side: SideRight},
+		{Path: "cache.go", StartLine: 21, StartSide: SideRight, Line: 22, Side: SideRight},
+		{Path: "cache.go", Line: 22, Side: SideRight},
+		{Path: "old.go", Line: 2, Side: SideLeft},
+	}
+	var positions []Comment
+	for _, comment := range comments {
+		comment.Body = ""
+		positions = append(positions, comment)
+	}
+	if !slices.Equal(positions, expected) {
+		t.Errorf("expected comments %+v, got %+v", expected, positions)
+	}
+	if comments[0].Body != "**MAJOR** bug: race" || !strings.Contains(comments[2].Body, "lines 3-22 of cache.go") {
+		t.Errorf("unexpected bodies %q and %q", comments[0].Body, comments[2].Body)
+	}
+	if len(skipped) != 3 {
+		t.Errorf("expected 3 findings without a line in the diff, got %+v", skipped)
+	}
+}
@@ -0,0 +1,163 @@
+// Package report writes the findings of a structured review as
+// markdown, as JSON or as SARIF, and turns the most important
+// finding into the exit code of a headless review.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/MelleKoning/ai-chat/internal/diff"
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+)
+
+// Format is the layout of a report
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatJSON     Format = "json"
+	FormatSARIF    Format = "sarif"
+	// FormatComments are the inline review comments of Comments
+	FormatComments Format = "comments"
+)
+
+// Formats lists the formats that Write supports
+var Formats = []Format{FormatMarkdown, FormatJSON, FormatSARIF, FormatComments}
+
+// The exit codes of a headless review, a review with findings exits
+// with the code of the most important severity
+const (
+	ExitOK       = 0
+	ExitFailed   = 1 // the review could not run
+	ExitUsage    = 2 // the flags are invalid
+	ExitInfo     = 3
+	ExitMinor    = 4
+	ExitMajor    = 5
+	ExitCritical = 6
+)
+
+var exitCodes = map[genaimodel.Severity]int{
+	genaimodel.SeverityCritical: ExitCritical,
+	genaimodel.SeverityMajor:    ExitMajor,
+	genaimodel.SeverityMinor:    ExitMinor,
+	genaimodel.SeverityInfo:     ExitInfo,
+}
+
+// ParseFormat checks the name of a format
+func ParseFormat(name string) (Format, error) {
+	format := Format(strings.ToLower(name))
+	if !slices.Contains(Formats, format) {
+		return "", fmt.Errorf("unknown format %q, use markdown, json, sarif or comments", name)
+	}
+
+	return format, nil
+}
+
+// Write writes the review in the format, the files of the
+// diff place the findings of FormatComments on their lines
+func Write(w io.Writer, format Format, review genaimodel.Review, files []diff.File) error {
+	switch format {
+	case FormatMarkdown:
+		_, err := io.WriteString(w, Markdown(review))
+		return err
+	case FormatJSON:
+		return writeJSON(w, review)
+	case FormatSARIF:
+		return writeJSON(w, sarif(review))
+	case FormatComments:
+		comments, _ := Comments(review, files)
+		return writeJSON(w, comments)
+	}
+
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
+
+// ExitCode returns the exit code of the most important finding that is
+// at least as important as failOn, ExitOK when there is none
+func ExitCode(review genaimodel.Review, failOn genaimodel.Severity) int {
+	threshold := slices.Index(genaimodel.Severities, failOn)
+	for i, severity := range genaimodel.Severities {
+		if i > threshold {
+			break
+		}
+		for _, finding := range review.Findings {
+			if finding.Severity == severity {
+				return exitCodes[severity]
+			}
+		}
+	}
+
+	return ExitOK
+}
+
+// Markdown renders the findings as a list grouped by file,
+// the findings are already sorted by file and line
+func Markdown(review genaimodel.Review) string {
+	var sb strings.Builder
+	sb.WriteString("## Review\n\n")
+	if review.Summary != "" {
+		sb.WriteString(review.Summary + "\n\n")
+	}
+	if len(review.Findings) == 0 {
+		sb.WriteString("No findings.\n")
+		return sb.String()
+	}
+	sb.WriteString(Counts(review.Findings) + "\n")
+
+	for i, finding := range review.Findings {
+		if i == 0 || finding.File != review.Findings[i-1].File {
+			fmt.Fprintf(&sb, "\n### %s\n\n", finding.File)
+		}
+		fmt.Fprintf(&sb, "- **%s** %s, %s: %s\n",
+			strings.ToUpper(string(finding.Severity)), finding.Category, lines(finding), finding.Message)
+		if finding.Suggestion != "" {
+			sb.WriteString("\n  ```\n")
+			for _, line := range strings.Split(strings.TrimSuffix(finding.Suggestion, "\n"), "\n") {
+				sb.WriteString("  " + line + "\n")
+			}
+			sb.WriteString("  ```\n\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// lines describes the lines of the finding, like "line 3" or "lines 3-5"
+func lines(finding genaimodel.Finding) string {
+	if finding.EndLine > finding.StartLine {
+		return fmt.Sprintf("lines %d-%d", finding.StartLine, finding.EndLine)
+	}
+
+	return fmt.Sprintf("line %d", finding.StartLine)
+}
+
+// Counts summarizes the findings by severity, like "3 findings: 1 critical, 2 minor"
+func Counts(findings []genaimodel.Finding) string {
+	counts := map[genaimodel.Severity]int{}
+	for _, finding := range findings {
+		counts[finding.Severity]++
+	}
+	var parts []string
+	for _, severity := range genaimodel.Severities {
+		if counts[severity] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[severity], severity))
+		}
+	}
+	noun := "findings"
+	if len(findings) == 1 {
+		noun = "finding"
+	}
+
+	return fmt.Sprintf("%d %s: %s", len(findings), noun, strings.Join(parts, ", "))
+}
@@ -0,0 +1,120 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+)
+
+var review = genaimodel.Review{
+	Summary: "Adds a cache.",
+	Findings: []genaimodel.Finding{
+		{File: "cache.go", StartLine: 3, EndLine: 5, Severity: genaimodel.SeverityMajor, Category: "bug",
+			Message: "the map is not locked", Suggestion: "mu.Lock()\ndefer mu.Unlock()\n"},
+		{File: "cache.go", StartLine: 9, EndLine: 9, Severity: genaimodel.SeverityMinor, Category: "style",
+			Message: "the name is too short"},
+		{File: "go.mod", Severity: genaimodel.SeverityInfo, Category: "bug", Message: "a new dependency"},
+	},
+}
+
+func TestMarkdown(t *testing.T) {
+	markdown := Markdown(review)
+	for _, expected := range []string{
+		"Adds a cache.\n\n3 findings: 1 major, 1 minor, 1 info\n",
+		"### cache.go\n\n- **MAJOR** bug, lines 3-5: the map is not locked\n\n  ```\n  mu.Lock()\n  defer mu.Unlock()\n  ```\n",
+		"- **MINOR** style, line 9: the name is too short\n",
+		"### go.mod\n",
+	} {
+		if !strings.Contains(markdown, expected) {
+			t.Errorf("expected %q in the markdown:\n%s", expected, markdown)
+		}
+	}
+
+	if markdown := Markdown(genaimodel.Review{Summary: "Fine."}); !strings.HasSuffix(markdown, "No findings.\n") {
+		t.Errorf("unexpected markdown without findings:\n%s", markdown)
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatSARIF, review, nil); err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleIndex int    `json:"ruleIndex"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region *struct {
+							StartLine int `json:"startLine"`
+							EndLine   int `json:"endLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("invalid SARIF: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) != 3 {
+		t.Fatalf("unexpected SARIF:\n%s", buf.String())
+	}
+	run := log.Runs[0]
+	if rules := run.Tool.Driver.Rules; len(rules) != 2 || rules[0].ID != "bug" || rules[1].ID != "style" {
+		t.Errorf("expected a rule per category, got %+v", rules)
+	}
+	first, last := run.Results[0], run.Results[2]
+	if first.Level != "error" || first.Locations[0].PhysicalLocation.Region.EndLine != 5 {
+		t.Errorf("unexpected result %+v", first)
+	}
+	// the finding about the whole file has no region
+	if last.Level != "note" || last.RuleIndex != 0 || last.Locations[0].PhysicalLocation.Region != nil ||
+		last.Locations[0].PhysicalLocation.ArtifactLocation.URI != "go.mod" {
+		t.Errorf("unexpected result %+v", last)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		failOn   genaimodel.Severity
+		expected int
+	}{
+		{genaimodel.SeverityInfo, ExitMajor},
+		{genaimodel.SeverityMajor, ExitMajor},
+		{genaimodel.SeverityCritical, ExitOK},
+	}
+	for _, test := range tests {
+		if code := ExitCode(review, test.failOn); code != test.expected {
+			t.Errorf("ExitCode with fail on %s should be %d, got %d", test.failOn, test.expected, code)
+		}
+	}
+	if code := ExitCode(genaimodel.Review{}, genaimodel.SeverityInfo); code != ExitOK {
+		t.Errorf("expected ExitOK without findings, got %d", code)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if format, err := ParseFormat("SARIF"); err != nil || format != FormatSARIF {
+		t.Errorf("unexpected format %q: %v", format, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
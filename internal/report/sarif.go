@@ -0,0 +1,137 @@
+package report
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+)
+
+// The SARIF 2.1.0 objects that a review needs, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolName     = "ai-chat"
+	toolURI      = "https://github.com/MelleKoning/ai-chat"
+	// srcRoot is the base of the paths in the diff, the viewer
+	// resolves it to the root of the repository
+	srcRoot = "%SRCROOT%"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text     string `json:"text"`
+	Markdown string `json:"markdown,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	RuleIndex  int               `json:"ruleIndex"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// sarifLevels maps the severities to the levels of SARIF
+var sarifLevels = map[genaimodel.Severity]string{
+	genaimodel.SeverityCritical: "error",
+	genaimodel.SeverityMajor:    "error",
+	genaimodel.SeverityMinor:    "warning",
+	genaimodel.SeverityInfo:     "note",
+}
+
+// sarif converts the review into a SARIF log with a single run, the
+// category of a finding is its rule and the severity is kept as a property
+func sarif(review genaimodel.Review) sarifLog {
+	var rules []sarifRule
+	results := []sarifResult{}
+	for _, finding := range review.Findings {
+		index := slices.IndexFunc(rules, func(rule sarifRule) bool { return rule.ID == finding.Category })
+		if index < 0 {
+			index = len(rules)
+			rules = append(rules, sarifRule{ID: finding.Category, ShortDescription: sarifMessage{Text: finding.Category}})
+		}
+		location := sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: finding.File, URIBaseID: srcRoot},
+		}
+		// SARIF lines start at 1, a finding about the whole file has no region
+		if finding.StartLine > 0 {
+			location.Region = &sarifRegion{StartLine: finding.StartLine, EndLine: max(finding.EndLine, finding.StartLine)}
+		}
+		results = append(results, sarifResult{
+			RuleID:     finding.Category,
+			RuleIndex:  index,
+			Level:      sarifLevels[finding.Severity],
+			Message:    sarifMessage{Text: finding.Message, Markdown: sarifMarkdown(finding)},
+			Locations:  []sarifLocation{{PhysicalLocation: location}},
+			Properties: map[string]string{"severity": string(finding.Severity)},
+		})
+	}
+	if rules == nil {
+		rules = []sarifRule{}
+	}
+
+	return sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: toolName, InformationURI: toolURI, Rules: rules}},
+			Results: results,
+		}},
+	}
+}
+
+// sarifMarkdown adds the suggestion to the message
+func sarifMarkdown(finding genaimodel.Finding) string {
+	if finding.Suggestion == "" {
+		return ""
+	}
+
+	return finding.Message + "\n\n```\n" + strings.TrimSuffix(finding.Suggestion, "\n") + "\n```"
+}
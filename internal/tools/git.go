@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	defaultLogCount = 20
+	maxLogCount     = 200
+)
+
+func (r *repository) gitDiff(ctx context.Context, args map[string]any) (string, error) {
+	gitArgs := []string{"diff", "--no-color", "--no-ext-diff"}
+	revision, err := revisionArg(args)
+	if err != nil {
+		return "", err
+	}
+	if revision != "" {
+		gitArgs = append(gitArgs, revision)
+	}
+	gitArgs, err = r.withPath(gitArgs, args)
+	if err != nil {
+		return "", err
+	}
+	output, err := r.git(ctx, gitArgs...)
+	if err != nil {
+		return "", err
+	}
+	if output == "" {
+		return "no changes", nil
+	}
+
+	return truncate(output), nil
+}
+
+func (r *repository) gitLog(ctx context.Context, args map[string]any) (string, error) {
+	count, err := intArg(args, "max_count", defaultLogCount)
+	if err != nil {
+		return "", err
+	}
+	count = min(max(count, 1), maxLogCount)
+	gitArgs := []string{"log", "--no-color", fmt.Sprintf("--max-count=%d", count),
+		"--date=short", "--format=%h %ad %an: %s"}
+	revision, err := revisionArg(args)
+	if err != nil {
+		return "", err
+	}
+	if revision != "" {
+		gitArgs = append(gitArgs, revision)
+	}
+	gitArgs, err = r.withPath(gitArgs, args)
+	if err != nil {
+		return "", err
+	}
+	output, err := r.git(ctx, gitArgs...)
+	if err != nil {
+		return "", err
+	}
+
+	return truncate(output), nil
+}
+
+// revisionArg returns the revision argument, it may not look like
+// an option as options like --output make git write files
+func revisionArg(args map[string]any) (string, error) {
+	revision, err := stringArg(args, "revision", "")
+	if err != nil {
+		return "", err
+	}
+	revision = strings.TrimSpace(revision)
+	if strings.HasPrefix(revision, "-") || strings.ContainsAny(revision, " \t\n") {
+		return "", fmt.Errorf("revision %q is not a revision or a revision range", revision)
+	}
+
+	return revision, nil
+}
+
+// withPath ends the git arguments with the path argument, if any,
+// after a "--" so that git does not take it for a revision
+func (r *repository) withPath(gitArgs []string, args map[string]any) ([]string, error) {
+	if _, ok := args["path"]; !ok {
+		return append(gitArgs, "--"), nil
+	}
+	p, err := pathArg(args, "path", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(gitArgs, "--", p), nil
+}
+
+// git runs git in the repository and returns its output
+func (r *repository) git(ctx context.Context, args ...string) (string, error) {
+	output, err := Git(ctx, r.dir, args...)
+
+	return string(output), err
+}
+
+// Git runs git in the directory and returns its output,
+// a failure returns the error output of git
+func Git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,321 @@
+// Package tools contains the built-in tools that the model can call to
+// look around in the repository under review. The Builtin tools only read,
+// the Writable tools change files and need the approval of the user. No
+// tool can reach files outside of the directory it is created for.
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+)
+
+const (
+	// maxOutput limits the output of a tool that is send to the model
+	maxOutput = 32 * 1024
+	// maxMatches limits the number of lines grep returns
+	maxMatches = 100
+	// maxFileSize skips large files like generated code or data
+	maxFileSize = 1024 * 1024
+)
+
+// skipDirs are not searched by grep
+var skipDirs = map[string]bool{".git": true, "vendor": true, "node_modules": true}
+
+// Builtin returns the read-only tools for the repository in dir:
+// read_file, list_directory, grep, git_diff and git_log
+func Builtin(dir string) ([]genaimodel.Tool, error) {
+	repo, err := openRepository(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return []genaimodel.Tool{
+		{
+			ToolDeclaration: genaimodel.ToolDeclaration{
+				Name:        "read_file",
+				Description: "Read a file of the repository, the lines are prefixed with their line number.",
+				Parameters: &genaimodel.Schema{
+					Type: "object",
+					Properties: map[string]*genaimodel.Schema{
+						"path":       {Type: "string", Description: "path of the file relative to the repository root"},
+						"start_line": {Type: "integer", Description: "first line to read, defaults to 1"},
+						"end_line":   {Type: "integer", Description: "last line to read, defaults to the end of the file"},
+					},
+					Required: []string{"path"},
+				},
+			},
+			Run:      repo.readFile,
+			ReadOnly: true,
+		},
+		{
+			ToolDeclaration: genaimodel.ToolDeclaration{
+				Name:        "list_directory",
+				Description: "List the files and directories in a directory of the repository, directories end with a slash.",
+				Parameters: &genaimodel.Schema{
+					Type: "object",
+					Properties: map[string]*genaimodel.Schema{
+						"path": {Type: "string", Description: "path of the directory, defaults to the repository root"},
+					},
+				},
+			},
+			Run:      repo.listDirectory,
+			ReadOnly: true,
+		},
+		{
+			ToolDeclaration: genaimodel.ToolDeclaration{
+				Name:        "grep",
+				Description: "Search the files of the repository for a regular expression, returns the matching lines as path:line: text.",
+				Parameters: &genaimodel.Schema{
+					Type: "object",
+					Properties: map[string]*genaimodel.Schema{
+						"pattern": {Type: "string", Description: "regular expression in Go (RE2) syntax"},
+						"path":    {Type: "string", Description: "file or directory to search, defaults to the repository root"},
+					},
+					Required: []string{"pattern"},
+				},
+			},
+			Run:      repo.grep,
+			ReadOnly: true,
+		},
+		{
+			ToolDeclaration: genaimodel.ToolDeclaration{
+				Name:        "git_diff",
+				Description: "Show the git diff of the working tree, or of a revision range like main...HEAD.",
+				Parameters: &genaimodel.Schema{
+					Type: "object",
+					Properties: map[string]*genaimodel.Schema{
+						"revision": {Type: "string", Description: "revision or revision range, defaults to the uncommitted changes"},
+						"path":     {Type: "string", Description: "limit the diff to this file or directory"},
+					},
+				},
+			},
+			Run:      repo.gitDiff,
+			ReadOnly: true,
+		},
+		{
+			ToolDeclaration: genaimodel.ToolDeclaration{
+				Name:        "git_log",
+				Description: "Show the git log with the short hash, date, author and subject of each commit.",
+				Parameters: &genaimodel.Schema{
+					Type: "object",
+					Properties: map[string]*genaimodel.Schema{
+						"revision":  {Type: "string", Description: "revision or revision range, defaults to HEAD"},
+						"path":      {Type: "string", Description: "only commits that touch this file or directory"},
+						"max_count": {Type: "integer", Description: "number of commits, defaults to 20"},
+					},
+				},
+			},
+			Run:      repo.gitLog,
+			ReadOnly: true,
+		},
+	}, nil
+}
+
+// repository gives the tools access to the files under dir,
+// root and fsys refuse paths that leave the directory
+type repository struct {
+	dir  string
+	root *os.Root
+	fsys fs.FS
+}
+
+func openRepository(dir string) (*repository, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repository{dir: dir, root: root, fsys: root.FS()}, nil
+}
+
+func (r *repository) readFile(ctx context.Context, args map[string]any) (string, error) {
+	name, err := pathArg(args, "path", "")
+	if err != nil {
+		return "", err
+	}
+	startLine, err := intArg(args, "start_line", 1)
+	if err != nil {
+		return "", err
+	}
+	endLine, err := intArg(args, "end_line", 0)
+	if err != nil {
+		return "", err
+	}
+	info, err := fs.Stat(r.fsys, name)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > maxFileSize {
+		return "", fmt.Errorf("%s is larger than %d bytes, use grep to find the lines", name, maxFileSize)
+	}
+	contents, err := fs.ReadFile(r.fsys, name)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	scanner.Buffer(nil, maxFileSize)
+	for line := 1; scanner.Scan(); line++ {
+		if line < startLine {
+			continue
+		}
+		if endLine > 0 && line > endLine {
+			break
+		}
+		fmt.Fprintf(&sb, "%d: %s\n", line, scanner.Text())
+	}
+
+	return truncate(sb.String()), scanner.Err()
+}
+
+func (r *repository) listDirectory(ctx context.Context, args map[string]any) (string, error) {
+	name, err := pathArg(args, "path", ".")
+	if err != nil {
+		return "", err
+	}
+	entries, err := fs.ReadDir(r.fsys, name)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, entry := range entries {
+		sb.WriteString(entry.Name())
+		if entry.IsDir() {
+			sb.WriteString("/")
+		}
+		sb.WriteString("\n")
+	}
+
+	return truncate(sb.String()), nil
+}
+
+func (r *repository) grep(ctx context.Context, args map[string]any) (string, error) {
+	pattern, err := stringArg(args, "pattern", "")
+	if err != nil {
+		return "", err
+	}
+	if pattern == "" {
+		return "", fmt.Errorf("pattern is required")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	name, err := pathArg(args, "path", ".")
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	matches := 0
+	err = fs.WalkDir(r.fsys, name, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.IsDir() {
+			if p != name && skipDirs[entry.Name()] {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if info, err := entry.Info(); err != nil || !info.Mode().IsRegular() || info.Size() > maxFileSize {
+			return nil
+		}
+		contents, err := fs.ReadFile(r.fsys, p)
+		if err != nil || bytes.IndexByte(contents, 0) >= 0 {
+			// unreadable and binary files are skipped
+			return nil
+		}
+		for i, line := range strings.Split(string(contents), "\n") {
+			if !re.MatchString(line) {
+				continue
+			}
+			if matches == maxMatches {
+				fmt.Fprintf(&sb, "[more than %d matches, narrow the pattern or the path]\n", maxMatches)
+				return fs.SkipAll
+			}
+			matches++
+			fmt.Fprintf(&sb, "%s:%d: %s\n", p, i+1, line)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if matches == 0 {
+		return "no matches", nil
+	}
+
+	return truncate(sb.String()), nil
+}
+
+// truncate cuts the output at maxOutput bytes
+func truncate(output string) string {
+	if len(output) <= maxOutput {
+		return output
+	}
+
+	return output[:maxOutput] + fmt.Sprintf("\n[truncated, %d of %d bytes shown]\n", maxOutput, len(output))
+}
+
+// stringArg returns the string argument, or def when it is not given
+func stringArg(args map[string]any, name string, def string) (string, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string, got %v", name, v)
+	}
+
+	return s, nil
+}
+
+// intArg returns the integer argument, or def when it is not given.
+// Numbers in json arguments are decoded as float64.
+func intArg(args map[string]any, name string, def int) (int, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return def, nil
+	case float64:
+		return int(v), nil
+	case int:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("%s must be a number, got %v", name, v)
+	}
+}
+
+// pathArg returns the path argument as a path relative to the
+// repository root, a path that leaves the repository is an error
+func pathArg(args map[string]any, name string, def string) (string, error) {
+	p, err := stringArg(args, name, def)
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", fmt.Errorf("%s is required", name)
+	}
+	p = path.Clean(filepath.ToSlash(p))
+	if !fs.ValidPath(p) {
+		return "", fmt.Errorf("%s %q is not a path inside the repository", name, p)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,199 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+)
+
+// newTestRepository creates a directory with a few files
+// and returns the built-in tools for it by name
+func newTestRepository(t *testing.T) (string, map[string]genaimodel.Tool) {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go":          "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n",
+		"docs/README.md":   "# hello docs\n",
+		"vendor/lib/x.go":  "package lib // hello from vendor\n",
+		"internal/a/a.go":  "package a\n",
+		"internal/a/b.bin": "hello\x00binary",
+	}
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	builtin, err := Builtin(dir)
+	if err != nil {
+		t.Fatalf("Builtin failed: %v", err)
+	}
+	tools := map[string]genaimodel.Tool{}
+	for _, tool := range builtin {
+		tools[tool.Name] = tool
+	}
+
+	return dir, tools
+}
+
+func TestReadOnlyFileTools(t *testing.T) {
+	_, tools := newTestRepository(t)
+	tests := []struct {
+		tool     string
+		args     map[string]any
+		expected string
+	}{
+		{"read_file", map[string]any{"path": "main.go", "start_line": 3.0, "end_line": 4.0},
+			"3: func main() {\n4: \tprintln(\"hello\")\n"},
+		{"list_directory", map[string]any{}, "docs/\ninternal/\nmain.go\nvendor/\n"},
+		{"list_directory", map[string]any{"path": "internal/a"}, "a.go\nb.bin\n"},
+		{"grep", map[string]any{"pattern": "hel+o"}, "docs/README.md:1: # hello docs\nmain.go:4: \tprintln(\"hello\")\n"},
+		{"grep", map[string]any{"pattern": "nothing like this"}, "no matches"},
+	}
+	for _, tt := range tests {
+		output, err := tools[tt.tool].Run(context.Background(), tt.args)
+		if err != nil {
+			t.Errorf("%s %v failed: %v", tt.tool, tt.args, err)
+			continue
+		}
+		if output != tt.expected {
+			t.Errorf("%s %v: expected %q, got %q", tt.tool, tt.args, tt.expected, output)
+		}
+	}
+}
+
+func TestReadFileTooLarge(t *testing.T) {
+	dir, tools := newTestRepository(t)
+	large := strings.Repeat("0123456789abcdef\n", maxFileSize/16)
+	if err := os.WriteFile(filepath.Join(dir, "large.txt"), []byte(large), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if output, err := tools["read_file"].Run(context.Background(), map[string]any{"path": "large.txt", "end_line": 1.0}); err == nil {
+		t.Errorf("expected an error for a file larger than %d bytes, got %q", maxFileSize, output)
+	}
+}
+
+func TestToolsStayInsideTheRepository(t *testing.T) {
+	dir, tools := newTestRepository(t)
+	outside := filepath.Join(filepath.Dir(dir), "outside.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range []map[string]any{
+		{"path": "../outside.txt"},
+		{"path": outside},
+		{"path": "link.txt"},
+		{},
+	} {
+		if output, err := tools["read_file"].Run(context.Background(), args); err == nil {
+			t.Errorf("read_file %v: expected an error, got %q", args, output)
+		}
+	}
+	if _, err := tools["git_diff"].Run(context.Background(), map[string]any{"revision": "--output=/tmp/x"}); err == nil {
+		t.Error("expected an error for a revision that is an option")
+	}
+}
+
+func TestGitTools(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, tools := newTestRepository(t)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "main.go"},
+		{"-c", "user.name=Tester", "-c", "user.email=tester@example.com", "commit", "-q", "-m", "Add main"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := tools["git_log"].Run(context.Background(), map[string]any{"max_count": 5.0})
+	if err != nil || !strings.HasSuffix(log, " Tester: Add main\n") {
+		t.Errorf("unexpected log %q, %v", log, err)
+	}
+	diff, err := tools["git_diff"].Run(context.Background(), map[string]any{"path": "main.go"})
+	if err != nil || !strings.Contains(diff, "-func main() {") {
+		t.Errorf("unexpected diff %q, %v", diff, err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, _ := newTestRepository(t)
+	writable, err := Writable(dir)
+	if err != nil {
+		t.Fatalf("Writable failed: %v", err)
+	}
+	writeFile := writable[0]
+	if writeFile.ReadOnly {
+		t.Error("write_file must need an approval")
+	}
+
+	args := map[string]any{
+		"path":    "main.go",
+		"content": "package main\n\nfunc main() {\n\tprintln(\"bye\")\n}\n",
+	}
+	preview, err := writeFile.Preview(context.Background(), args)
+	expected := "--- main.go\n+++ main.go\n...\n" +
+		" \n func main() {\n-\tprintln(\"hello\")\n+\tprintln(\"bye\")\n }\n"
+	if err != nil || preview != expected {
+		t.Errorf("unexpected preview %q, %v", preview, err)
+	}
+	if _, err := writeFile.Run(context.Background(), args); err != nil {
+		t.Fatalf("write_file failed: %v", err)
+	}
+	contents, _ := os.ReadFile(filepath.Join(dir, "main.go"))
+	if string(contents) != args["content"] {
+		t.Errorf("unexpected contents %q", contents)
+	}
+
+	// new files and directories are created, but not outside the repository
+	if _, err := writeFile.Run(context.Background(), map[string]any{"path": "new/dir/x.txt", "content": "x"}); err != nil {
+		t.Errorf("write_file of a new file failed: %v", err)
+	}
+	if _, err := writeFile.Run(context.Background(), map[string]any{"path": "../x.txt", "content": "x"}); err == nil {
+		t.Error("expected an error for a file outside the repository")
+	}
+}
+
+func TestLineDiffOfALargeFile(t *testing.T) {
+	var old, changed strings.Builder
+	for i := range 10000 {
+		fmt.Fprintf(&old, "line %d\n", i)
+		if i == 5000 {
+			changed.WriteString("changed\n")
+		} else {
+			fmt.Fprintf(&changed, "line %d\n", i)
+		}
+	}
+	expected := "...\n line 4998\n line 4999\n-line 5000\n+changed\n line 5001\n line 5002\n"
+	if diff := lineDiff(old.String(), changed.String()); diff != expected {
+		t.Errorf("unexpected diff %q", diff)
+	}
+
+	// a change too large for the table is summarized
+	if diff := lineDiff(old.String(), strings.ToUpper(old.String())); diff != "replaces 10000 lines with 10000 lines\n" {
+		t.Errorf("unexpected summary %q", diff)
+	}
+}
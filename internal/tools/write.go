@@ -0,0 +1,221 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+)
+
+const (
+	// diffContext is the number of unchanged lines around a change
+	diffContext = 2
+	// maxDiffCells limits the table of the line diff to about 2 MB,
+	// larger changes are summarized instead
+	maxDiffCells = 250_000
+)
+
+// Writable returns the tools that change the repository in dir,
+// they are not read-only so each call needs the approval of the user
+func Writable(dir string) ([]genaimodel.Tool, error) {
+	repo, err := openRepository(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return []genaimodel.Tool{
+		{
+			ToolDeclaration: genaimodel.ToolDeclaration{
+				Name:        "write_file",
+				Description: "Create or overwrite a file of the repository with the given content. The user has to approve every write.",
+				Parameters: &genaimodel.Schema{
+					Type: "object",
+					Properties: map[string]*genaimodel.Schema{
+						"path":    {Type: "string", Description: "path of the file relative to the repository root"},
+						"content": {Type: "string", Description: "the complete new content of the file"},
+					},
+					Required: []string{"path", "content"},
+				},
+			},
+			Run:     repo.writeFile,
+			Preview: repo.previewWrite,
+		},
+	}, nil
+}
+
+func (r *repository) writeFile(ctx context.Context, args map[string]any) (string, error) {
+	name, err := pathArg(args, "path", "")
+	if err != nil {
+		return "", err
+	}
+	content, err := stringArg(args, "content", "")
+	if err != nil {
+		return "", err
+	}
+	if err := r.mkdirAll(path.Dir(name)); err != nil {
+		return "", err
+	}
+	f, err := r.root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("wrote %d bytes to %s", len(content), name), nil
+}
+
+// mkdirAll creates the missing parent directories of a file
+func (r *repository) mkdirAll(dir string) error {
+	if dir == "." {
+		return nil
+	}
+	if err := r.mkdirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+	if err := r.root.Mkdir(dir, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	return nil
+}
+
+// previewWrite shows the diff of the write, a new file shows all lines as added
+func (r *repository) previewWrite(ctx context.Context, args map[string]any) (string, error) {
+	name, err := pathArg(args, "path", "")
+	if err != nil {
+		return "", err
+	}
+	content, err := stringArg(args, "content", "")
+	if err != nil {
+		return "", err
+	}
+	old, err := fs.ReadFile(r.fsys, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	header := fmt.Sprintf("--- %s\n+++ %s\n", name, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		header = fmt.Sprintf("new file %s\n", name)
+	}
+
+	return header + lineDiff(string(old), content), nil
+}
+
+// lineDiff returns the changed lines prefixed with - and +, with a few
+// unchanged lines around them. It uses the longest common subsequence
+// of the lines between the unchanged start and end of the file.
+func lineDiff(oldText, newText string) string {
+	a, b := splitLines(oldText), splitLines(newText)
+	// the unchanged lines at the start and the end are not in the table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	changedA, changedB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(changedA)*len(changedB) > maxDiffCells {
+		return fmt.Sprintf("replaces %d lines with %d lines\n", len(changedA), len(changedB))
+	}
+
+	var lines []string
+	for _, line := range a[:prefix] {
+		lines = append(lines, " "+line)
+	}
+	lines = append(lines, editLines(changedA, changedB)...)
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, " "+line)
+	}
+
+	// keep the changes with their context
+	var sb strings.Builder
+	skipped := false
+	for n, line := range lines {
+		if !nearChange(lines, n) {
+			skipped = true
+			continue
+		}
+		if skipped {
+			sb.WriteString("...\n")
+			skipped = false
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	if sb.Len() == 0 {
+		return "no changes\n"
+	}
+
+	return sb.String()
+}
+
+// editLines turns a into b with the longest common subsequence,
+// the lines are prefixed with a space, - or +
+func editLines(a, b []string) []string {
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			// removed lines come before the added lines
+			lines = append(lines, "-"+a[i])
+			i++
+		default:
+			lines = append(lines, "+"+b[j])
+			j++
+		}
+	}
+
+	return lines
+}
+
+// nearChange is true when a changed line is within diffContext lines of line n
+func nearChange(lines []string, n int) bool {
+	for i := max(n-diffContext, 0); i <= min(n+diffContext, len(lines)-1); i++ {
+		if !strings.HasPrefix(lines[i], " ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,123 @@
+package tviewview
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// maxPathCompletions limits the entries of the autocomplete list
+const maxPathCompletions = 20
+
+// AttachFile shows a modal to attach files, like screenshots, pdf files
+// or logs, to the next chat message
+func (tv *tviewApp) AttachFile() {
+	closeModal := func() {
+		tv.app.SetInputCapture(tv.inputCapture) // undo the override of the ESC key
+		tv.app.SetRoot(tv.flex, true)           // Close the modal
+		tv.app.SetFocus(tv.commandArea)
+	}
+
+	form := tview.NewForm()
+	form.SetBorder(true)
+	setTitle := func(status string) {
+		title := "Attach files (ESC to exit)"
+		if names := tv.aimodel.Attachments(); len(names) > 0 {
+			title = fmt.Sprintf("Attached: %s (ESC to exit)", strings.Join(names, ", "))
+		}
+		if status != "" {
+			title = status
+		}
+		form.SetTitle(tview.Escape(title))
+	}
+	setTitle("")
+
+	form.AddInputField("File", "", 60, nil, nil)
+	pathField := form.GetFormItemByLabel("File").(*tview.InputField)
+	pathField.SetAutocompleteFunc(completePath)
+
+	form.AddButton("Attach", func() {
+		path := strings.TrimSpace(pathField.GetText())
+		if path == "" {
+			setTitle("Type the path of the file to attach")
+			return
+		}
+		setTitle("Attaching " + filepath.Base(path) + "...")
+		go func() { // larger files are uploaded
+			err := tv.aimodel.AddAttachment(context.Background(), path)
+			tv.app.QueueUpdateDraw(func() {
+				if err != nil {
+					log.Printf("Error attaching %s: %v", path, err)
+					setTitle(fmt.Sprintf("Error: %v", err))
+					return
+				}
+				pathField.SetText("")
+				setTitle("")
+				tv.updateCommandTitle()
+			})
+		}()
+	}).
+		AddButton("Clear", func() {
+			tv.aimodel.ClearAttachments()
+			setTitle("")
+			tv.updateCommandTitle()
+		}).
+		AddButton("Done", closeModal)
+
+	tv.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			closeModal()
+			return nil
+		}
+		return event
+	})
+
+	tv.app.SetRoot(form, true)
+}
+
+// completePath lists the files and directories that start with the
+// typed path, directories end with a slash to continue typing
+func completePath(currentText string) []string {
+	if currentText == "" {
+		return nil
+	}
+	matches, err := filepath.Glob(currentText + "*")
+	if err != nil {
+		return nil
+	}
+	if len(matches) > maxPathCompletions {
+		matches = matches[:maxPathCompletions]
+	}
+	for i, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			matches[i] = match + string(filepath.Separator)
+		}
+	}
+
+	return matches
+}
+
+// updateCommandTitle lists the attached files above the prompt
+func (tv *tviewApp) updateCommandTitle() {
+	title := "Enter command: "
+	if names := tv.aimodel.Attachments(); len(names) > 0 {
+		title = fmt.Sprintf("Enter command (attached: %s): ", strings.Join(names, ", "))
+	}
+	tv.commandArea.SetTitle(tview.Escape(title))
+}
+
+// withAttachments adds the names of the attached files to the command
+// that is shown in the outputView
+func withAttachments(command string, names []string) string {
+	if len(names) == 0 {
+		return command
+	}
+
+	return fmt.Sprintf("%s\n\nAttached: %s", command, strings.Join(names, ", "))
+}
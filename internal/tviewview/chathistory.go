@@ -1,6 +1,7 @@
 package tviewview
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -82,16 +83,21 @@ func (tv *tviewApp) loadChatHistory(filename string) {
 
 	// Update the outputView with the loaded chat history
 	for _, content := range contentList {
+		// summaries are only send to the model, the
+		// compacted messages make up the transcript
+		if content.Summary {
+			continue
+		}
 		// Format the output based on the content's role (user or model)
-		if content.Role == "user" {
+		if content.Role == genaimodel.RoleUser {
 			tv.app.QueueUpdate(func() {
-				tv.progress.appendUserCommandToOutput(content.Parts[0].Text)
+				tv.progress.appendUserCommandToOutput(withAttachments(content.Text(), content.Attachments()))
 			})
 
 		} else {
 			tv.app.QueueUpdate(func() {
 				tv.progress.handleFinalModelResult(genaimodel.ChatResult{
-					Response:   content.Parts[0].Text,
+					Response:   content.Text(),
 					ChunkCount: 1,
 				}, nil)
 			})
@@ -99,6 +105,8 @@ func (tv *tviewApp) loadChatHistory(filename string) {
 	}
 
 	tv.app.QueueUpdateDraw(func() {
+		// the stored chat can have changed the active model
+		tv.titleView.SetText(tv.title(""))
 		tv.app.SetRoot(tv.flex, true)
 	})
 }
@@ -164,7 +172,7 @@ func (tv *tviewApp) createChatHistorySelectionModal(selectedFileChan chan string
 	fileList.SetBorder(true).SetTitle("Select Chat History File (ESC to exit)")
 	// Create a function to close the modal and reset the UI
 	closeModal := func() {
-		tv.app.SetInputCapture(nil)                     // undo the override of the TAB and ESC key
+		tv.app.SetInputCapture(tv.inputCapture)         // undo the override of the TAB and ESC key
 		tv.pages.RemovePage(fileSelectionModalPageName) // Remove the modal from pages
 		tv.pages.RemovePage(confirmationPageName)       // Remove confirmation page if it exist
 		tv.app.SetRoot(tv.flex, true)                   // Restore original layout
@@ -296,7 +304,7 @@ func (tv *tviewApp) SelectChatHistoryFile() {
 // In your tviewApp:
 func (tv *tviewApp) GenerateChatHistoryFilename() (string, error) {
 	var summary string
-	summary, err := tv.aimodel.GenerateChatSummary()
+	summary, err := tv.aimodel.GenerateChatSummary(context.Background())
 	if err != nil {
 		log.Printf("Error generating chat summary: %v", err)
 
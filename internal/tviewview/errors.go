@@ -0,0 +1,41 @@
+package tviewview
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+	"github.com/rivo/tview"
+)
+
+// retryHint tells how to resend the request after an error
+const retryHint = `Choose "Retry" in the options to send it again.`
+
+// errorText renders a failed request for the outputView: the
+// error, what the user can do about it and how to retry
+func errorText(err error) string {
+	var sb strings.Builder
+	sb.WriteString("\n[red]")
+	sb.WriteString(tview.Escape(err.Error()))
+	sb.WriteString("[-]\n")
+
+	var apiErr *genaimodel.APIError
+	if errors.As(err, &apiErr) && apiErr.Advice() != "" {
+		sb.WriteString(tview.Escape(apiErr.Advice()))
+		sb.WriteString("\n")
+	}
+	sb.WriteString(tview.Escape(retryHint))
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// errorSummary is the short description of the error for the progressView
+func errorSummary(err error) string {
+	var apiErr *genaimodel.APIError
+	if errors.As(err, &apiErr) {
+		return "[red]Failed: " + apiErr.Kind.String() + "[-]"
+	}
+
+	return "[red]Failed[-]"
+}
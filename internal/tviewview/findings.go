@@ -0,0 +1,279 @@
+package tviewview
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/MelleKoning/ai-chat/internal/diff"
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const findingsHelp = "e: open in $EDITOR  r: resolved  i: ignored  o: open again  TAB: details  ESC: close"
+
+// ShowFindings shows the findings of the last review grouped by file and
+// severity. The selected finding is shown with its hunk and suggestion, a
+// key opens the editor at the line and the findings can be marked resolved
+// or ignored, the marks are stored with the chat history.
+func (tv *tviewApp) ShowFindings() {
+	findings := tv.aimodel.Findings()
+	if len(findings) == 0 {
+		tv.progressView.SetText("No findings, run a structured or chunked review first")
+		return
+	}
+	closeModal := func() {
+		tv.app.SetInputCapture(tv.inputCapture) // undo the override of the ESC key
+		tv.app.SetRoot(tv.flex, true)           // Close the modal
+	}
+
+	details := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true).
+		SetWrap(true)
+	details.SetBorder(true).SetTitle("Finding")
+	help := tview.NewTextView().SetText(findingsHelp)
+
+	root := tview.NewTreeNode("Findings").SetSelectable(false)
+	tree := tview.NewTreeView().SetRoot(root).SetTopLevel(1)
+	tree.SetBorder(true).SetTitle("Findings (ESC to exit)")
+	// the nodes of the findings refer to the index in findings
+	nodes := map[int]*tview.TreeNode{}
+	for _, file := range findingFiles(findings) {
+		fileNode := tview.NewTreeNode(tview.Escape(file)).SetColor(tcell.ColorYellow).SetSelectable(false)
+		root.AddChild(fileNode)
+		for _, severity := range genaimodel.Severities {
+			var indexes []int
+			for i, finding := range findings {
+				if finding.File == file && finding.Severity == severity {
+					indexes = append(indexes, i)
+				}
+			}
+			if len(indexes) == 0 {
+				continue
+			}
+			severityNode := tview.NewTreeNode(fmt.Sprintf("%s (%d)", severity, len(indexes))).SetSelectable(false)
+			fileNode.AddChild(severityNode)
+			for _, i := range indexes {
+				node := tview.NewTreeNode(findingTitle(findings[i])).SetReference(i)
+				severityNode.AddChild(node)
+				nodes[i] = node
+			}
+		}
+	}
+
+	selected := func() (int, bool) {
+		node := tree.GetCurrentNode()
+		if node == nil || node.GetReference() == nil {
+			return 0, false
+		}
+		return node.GetReference().(int), true
+	}
+	showDetails := func() {
+		if i, ok := selected(); ok {
+			details.SetText(tv.findingText(findings[i])).ScrollToBeginning()
+		}
+	}
+	setStatus := func(status genaimodel.FindingStatus) {
+		i, ok := selected()
+		if !ok {
+			return
+		}
+		if err := tv.aimodel.SetFindingStatus(i, status); err != nil {
+			log.Printf("Error marking the finding: %v", err)
+			help.SetText(tview.Escape(err.Error()))
+			return
+		}
+		findings[i].Status = status
+		nodes[i].SetText(findingTitle(findings[i]))
+		showDetails()
+	}
+	tree.SetChangedFunc(func(*tview.TreeNode) { showDetails() })
+	tree.SetSelectedFunc(func(*tview.TreeNode) { tv.app.SetFocus(details) })
+
+	// the file and the severity are headers, the first finding is selected
+	tree.SetCurrentNode(firstFindingNode(root))
+	showDetails()
+
+	layout := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(tview.NewFlex().
+			AddItem(tree, 0, 2, true).
+			AddItem(details, 0, 3, false), 0, 1, true).
+		AddItem(help, 1, 0, false)
+
+	tv.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			closeModal()
+			return nil
+		case tcell.KeyTAB:
+			if tree.HasFocus() {
+				tv.app.SetFocus(details)
+			} else {
+				tv.app.SetFocus(tree)
+			}
+			return nil
+		}
+		switch event.Rune() {
+		case 'e':
+			if i, ok := selected(); ok {
+				if err := tv.openEditor(findings[i].Finding); err != nil {
+					help.SetText(tview.Escape(fmt.Sprintf("Error opening the editor: %v", err)))
+				}
+			}
+			return nil
+		case 'r':
+			setStatus(genaimodel.StatusResolved)
+			return nil
+		case 'i':
+			setStatus(genaimodel.StatusIgnored)
+			return nil
+		case 'o':
+			setStatus(genaimodel.StatusOpen)
+			return nil
+		}
+		return event
+	})
+
+	tv.app.SetRoot(layout, true)
+}
+
+// findingFiles lists the files of the findings in order
+func findingFiles(findings []genaimodel.TrackedFinding) []string {
+	var files []string
+	for _, finding := range findings {
+		if !slices.Contains(files, finding.File) {
+			files = append(files, finding.File)
+		}
+	}
+	slices.Sort(files)
+
+	return files
+}
+
+// firstFindingNode returns the node of the first finding in the tree
+func firstFindingNode(root *tview.TreeNode) *tview.TreeNode {
+	for _, file := range root.GetChildren() {
+		for _, severity := range file.GetChildren() {
+			if children := severity.GetChildren(); len(children) > 0 {
+				return children[0]
+			}
+		}
+	}
+
+	return nil
+}
+
+// findingTitle is the line of the finding in the tree, with its status
+func findingTitle(finding genaimodel.TrackedFinding) string {
+	title := fmt.Sprintf("line %d: %s", finding.StartLine, finding.Message)
+	if finding.Status != genaimodel.StatusOpen {
+		return fmt.Sprintf("[gray]%s (%s)[-]", tview.Escape(title), finding.Status)
+	}
+
+	return tview.Escape(title)
+}
+
+// findingText shows the finding with the hunk of the diff and the suggestion
+func (tv *tviewApp) findingText(finding genaimodel.TrackedFinding) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[yellow]%s[-] %s, %s\n", strings.ToUpper(string(finding.Severity)),
+		tview.Escape(finding.Category), tview.Escape(findingLines(finding.Finding)))
+	if finding.Status != genaimodel.StatusOpen {
+		fmt.Fprintf(&sb, "[gray]marked %s[-]\n", finding.Status)
+	}
+	sb.WriteString("\n" + tview.Escape(finding.Message) + "\n")
+
+	if hunk, ok := findingHunk(tv.reviewFiles, finding.Finding); ok {
+		sb.WriteString("\n[yellow]Diff[-]\n")
+		sb.WriteString(colorDiff(strings.TrimSuffix(hunk.String(), "\n")))
+	} else {
+		sb.WriteString("\n[gray]The diff of the finding is not loaded, review the diff again to see it.[-]\n")
+	}
+	if finding.Suggestion != "" {
+		sb.WriteString("\n[yellow]Suggestion[-]\n")
+		sb.WriteString(tview.Escape(finding.Suggestion) + "\n")
+	}
+
+	return sb.String()
+}
+
+// findingLines describes the file and the lines of the finding, like "main.go lines 3-5"
+func findingLines(finding genaimodel.Finding) string {
+	if finding.EndLine > finding.StartLine {
+		return fmt.Sprintf("%s lines %d-%d", finding.File, finding.StartLine, finding.EndLine)
+	}
+
+	return fmt.Sprintf("%s line %d", finding.File, finding.StartLine)
+}
+
+// findingHunk returns the hunk of the diff with the first line of the finding
+func findingHunk(files []diff.File, finding genaimodel.Finding) (diff.Hunk, bool) {
+	file, ok := diff.FindFile(files, finding.File)
+	if !ok {
+		return diff.Hunk{}, false
+	}
+	find := file.FindNewLine
+	if file.NewPath == "" {
+		find = file.FindOldLine
+	}
+	for line := finding.StartLine; line <= max(finding.EndLine, finding.StartLine); line++ {
+		if i, ok := find(line); ok {
+			return file.Hunks[i], true
+		}
+	}
+
+	return diff.Hunk{}, false
+}
+
+// openEditor suspends the console and opens $VISUAL or
+// $EDITOR, vi without them, at the line of the finding
+func (tv *tviewApp) openEditor(finding genaimodel.Finding) error {
+	path := finding.File
+	if file, ok := diff.FindFile(tv.reviewFiles, finding.File); ok {
+		path = file.Path()
+	}
+	if tv.reviewSource != nil && tv.reviewSource.Dir != "" {
+		path = filepath.Join(tv.reviewSource.Dir, path)
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	cmd := editorCommand(editor, path, max(finding.StartLine, 1))
+
+	var err error
+	tv.app.Suspend(func() {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		err = cmd.Run()
+	})
+	log.Printf("Opened %s at line %d with %s: %v", path, finding.StartLine, cmd.Path, err)
+
+	return err
+}
+
+// editorCommand opens the file at the line, most editors take "+line",
+// the editors of the VS Code family and Sublime Text take "file:line"
+func editorCommand(editor, path string, line int) *exec.Cmd {
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		args = []string{"vi"}
+	}
+	switch filepath.Base(args[0]) {
+	case "code", "code-insiders", "codium", "cursor":
+		args = append(args, "--wait", "--goto", path+":"+strconv.Itoa(line))
+	case "subl":
+		args = append(args, "--wait", path+":"+strconv.Itoa(line))
+	default:
+		args = append(args, "+"+strconv.Itoa(line), path)
+	}
+
+	return exec.Command(args[0], args[1:]...)
+}
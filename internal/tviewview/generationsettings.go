@@ -0,0 +1,163 @@
+package tviewview
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	// preciseTemperature suits code reviews
+	preciseTemperature = "0.2"
+	// creativeTemperature suits brainstorming
+	creativeTemperature = "1.2"
+)
+
+// createGenerationSettingsModal shows a form with the generation
+// parameters of the session, an empty field uses the default of the backend
+func (tv *tviewApp) createGenerationSettingsModal() {
+	closeModal := func() {
+		tv.app.SetInputCapture(tv.inputCapture) // undo the override of the ESC key
+		tv.app.SetRoot(tv.flex, true)           // Close the modal
+	}
+
+	generation := tv.aimodel.GetGeneration()
+	maxOutputTokens := ""
+	if generation.MaxOutputTokens != 0 {
+		maxOutputTokens = strconv.Itoa(generation.MaxOutputTokens)
+	}
+	form := tview.NewForm().
+		AddInputField("Temperature", formatFloat(generation.Temperature), 10, nil, nil).
+		AddInputField("Top P", formatFloat(generation.TopP), 10, nil, nil).
+		AddInputField("Top K", formatInt(generation.TopK), 10, tview.InputFieldInteger, nil).
+		AddInputField("Max output tokens", maxOutputTokens, 10, tview.InputFieldInteger, nil).
+		AddInputField("Seed", formatInt(generation.Seed), 10, tview.InputFieldInteger, nil).
+		AddInputField("Stop sequences", strings.Join(generation.StopSequences, ","), 40, nil, nil).
+		AddInputField("Thinking budget", formatInt(generation.ThinkingBudget), 10, tview.InputFieldInteger, nil)
+	form.SetBorder(true).SetTitle("Generation settings (ESC to exit)")
+
+	text := func(label string) string {
+		return form.GetFormItemByLabel(label).(*tview.InputField).GetText()
+	}
+	setTemperature := func(temperature string) {
+		form.GetFormItemByLabel("Temperature").(*tview.InputField).SetText(temperature)
+	}
+
+	form.AddButton("Save", func() {
+		generation, err := parseGeneration(text)
+		if err != nil {
+			form.SetTitle(tview.Escape(fmt.Sprintf("Generation settings: %v", err)))
+			return
+		}
+		tv.aimodel.SetGeneration(generation)
+		log.Printf("Generation settings: %s", generation)
+		tv.progressView.SetText("Generation: " + tview.Escape(generation.String()))
+		closeModal()
+	}).
+		AddButton("Precise", func() { setTemperature(preciseTemperature) }).
+		AddButton("Creative", func() { setTemperature(creativeTemperature) }).
+		AddButton("Cancel", closeModal)
+
+	tv.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			closeModal()
+			return nil
+		}
+		return event
+	})
+
+	tv.app.SetRoot(form, true)
+}
+
+// parseGeneration reads the fields of the settings form,
+// text returns the contents of the field with the label
+func parseGeneration(text func(label string) string) (genaimodel.GenerationConfig, error) {
+	var generation genaimodel.GenerationConfig
+	var err error
+	if generation.Temperature, err = parseFloat(text("Temperature")); err != nil {
+		return generation, fmt.Errorf("temperature: %w", err)
+	}
+	if generation.TopP, err = parseFloat(text("Top P")); err != nil {
+		return generation, fmt.Errorf("top p: %w", err)
+	}
+	if generation.TopK, err = parseInt(text("Top K")); err != nil {
+		return generation, fmt.Errorf("top k: %w", err)
+	}
+	maxOutputTokens, err := parseInt(text("Max output tokens"))
+	if err != nil {
+		return generation, fmt.Errorf("max output tokens: %w", err)
+	}
+	if maxOutputTokens != nil {
+		generation.MaxOutputTokens = *maxOutputTokens
+	}
+	if generation.Seed, err = parseInt(text("Seed")); err != nil {
+		return generation, fmt.Errorf("seed: %w", err)
+	}
+	for _, stop := range strings.Split(text("Stop sequences"), ",") {
+		if stop != "" {
+			generation.StopSequences = append(generation.StopSequences, stop)
+		}
+	}
+
+	if generation.ThinkingBudget, err = parseInt(text("Thinking budget")); err != nil {
+		return generation, fmt.Errorf("thinking budget: %w", err)
+	}
+
+	return generation, generation.Validate()
+}
+
+// parseFloat returns nil for an empty field
+func parseFloat(s string) (*float32, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return nil, err
+	}
+	f := float32(v)
+
+	return &f, nil
+}
+
+// parseInt returns nil for an empty field
+func parseInt(s string) (*int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+func formatFloat(f *float32) string {
+	if f == nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(float64(*f), 'g', -1, 32)
+}
+
+func formatInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+
+	return strconv.Itoa(*i)
+}
+
+// GenerationSettings lets the user change the
+// generation parameters for the rest of the session
+func (tv *tviewApp) GenerationSettings() {
+	tv.createGenerationSettingsModal()
+}
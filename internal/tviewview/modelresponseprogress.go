@@ -1,6 +1,8 @@
 package tviewview
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -48,7 +50,7 @@ func (p *ModelResponseProgress) startSpinnerGoroutine(stopChan chan struct{}) {
 			elapsedDuration := time.Since(p.progressData.startTime)
 
 			p.tv.app.QueueUpdateDraw(func() {
-				thinkingString := fmt.Sprintf("Thinking... %c (%s)", spinnerRunes[i], elapsedDuration.String())
+				thinkingString := fmt.Sprintf("Thinking... %c (%s) ESC to cancel", spinnerRunes[i], elapsedDuration.String())
 				p.tv.progressView.SetText(thinkingString)
 			})
 			i = (i + 1) % len(spinnerRunes)
@@ -87,14 +89,105 @@ func (pd *ProgressData) String() string {
 		pd.chunkCount, pd.length, elapsedStr, pd.chunksPerSecond)
 }
 
+// requestRunningText asks to wait for the running request
+const requestRunningText = "A request is running, wait for it or press ESC to cancel it"
+
+// cancelledText marks a response in the outputView that was cancelled
+var cancelledText = "\n[gray]" + tview.Escape("[cancelled]") + "[-]\n"
+
+// finishText marks an answer that was continued or that did not
+// finish normally, like an answer cut off at the maximum output tokens
+func finishText(usage genaimodel.ContextUsage) string {
+	var notes []string
+	if usage.Continuations == 1 {
+		notes = append(notes, "continued once after it was cut off")
+	} else if usage.Continuations > 1 {
+		notes = append(notes, fmt.Sprintf("continued %d times after it was cut off", usage.Continuations))
+	}
+	if notice := usage.FinishReason.Notice(); notice != "" {
+		notes = append(notes, notice)
+	}
+	if usage.FinishReason == genaimodel.FinishMaxTokens {
+		notes = append(notes, `choose "Continue answer" to continue it`)
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+
+	return "\n[yellow]" + tview.Escape("["+strings.Join(notes, ", ")+"]") + "[-]\n"
+}
+
+// thoughtsText renders the thoughts of a thinking model, dimmed when
+// expanded or as a single line when collapsed
+func thoughtsText(thoughts string, expanded bool) string {
+	if thoughts == "" {
+		return ""
+	}
+	if !expanded {
+		return "\n[gray]" + tview.Escape(`[+] thoughts hidden, choose "Toggle thoughts" to show them`) + "[-]\n"
+	}
+
+	return "\n[gray]" + tview.Escape(thoughts) + "[-]\n"
+}
+
 type ModelResponseProgress struct {
 	progressData               ProgressData
 	originalOutputViewContents string
 	userCommandRendered        string
 	chunksReceived             strings.Builder
+	thoughtsReceived           strings.Builder
+	thoughts                   string // of the last answer
+	answerRendered             string // the last answer, to toggle its thoughts
+	lastAnswer                 string // the markdown of the last answer, to continue it
 	tv                         *tviewApp
 	StopSpinner                chan struct{}
 	closeSpinnerOnce           sync.Once
+	cancelMutex                sync.Mutex
+	cancelRequest              context.CancelFunc // set while a request runs
+}
+
+// newRequestContext returns the context for a model request. Until
+// the returned done func is called the request can be cancelled. One
+// request runs at a time as the requests write the chat history, ok
+// is false while another request runs, even one that is cancelled
+// but did not return yet.
+func (p *ModelResponseProgress) newRequestContext() (ctx context.Context, done func(), ok bool) {
+	p.cancelMutex.Lock()
+	defer p.cancelMutex.Unlock()
+	if p.cancelRequest != nil {
+		return nil, nil, false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancelRequest = cancel
+
+	return ctx, func() {
+		p.cancelMutex.Lock()
+		p.cancelRequest = nil
+		p.cancelMutex.Unlock()
+		cancel()
+	}, true
+}
+
+// requestRunning reports whether a model request runs
+func (p *ModelResponseProgress) requestRunning() bool {
+	p.cancelMutex.Lock()
+	defer p.cancelMutex.Unlock()
+
+	return p.cancelRequest != nil
+}
+
+// cancelRunningRequest cancels the running model request,
+// returns false when there is no request to cancel
+func (p *ModelResponseProgress) cancelRunningRequest() bool {
+	p.cancelMutex.Lock()
+	defer p.cancelMutex.Unlock()
+	if p.cancelRequest == nil {
+		return false
+	}
+	// the request keeps the slot until it returns
+	p.cancelRequest()
+
+	return true
 }
 
 func (p *ModelResponseProgress) StartCommand() {
@@ -138,7 +231,12 @@ func (p *ModelResponseProgress) appendUserCommandToOutput(command string) {
 // 3. Manage ongoing streaming updates via p.onChunkReceived (each requiring  QueueUpdateDraw ).
 // 4. Finally, perform a concluding update ( QueueUpdateDraw ).
 func (p *ModelResponseProgress) runModelCommand(command string) {
-	p.appendUserCommandToOutput(command)
+	ctx, done, ok := p.tv.startRequest()
+	if !ok {
+		return
+	}
+	p.tv.lastRequest = func() { p.runModelCommand(command) }
+	p.appendUserCommandToOutput(withAttachments(command, p.tv.aimodel.Attachments()))
 	// Start async operationas for model call, spinner, final result handling
 	go func() {
 		p.tv.app.QueueUpdateDraw(func() {
@@ -151,15 +249,21 @@ func (p *ModelResponseProgress) runModelCommand(command string) {
 			p.tv.app.SetFocus(p.tv.progressView)
 		})
 
+		defer done()
 		p.startProgress()
 		// the callback -can- update the outputview for intermediate results
-		result, chatErr := p.tv.aimodel.ChatMessage(command, p.onChunkReceived)
+		result, chatErr := p.tv.aimodel.ChatMessage(ctx, command, p.onChunkReceived)
 		// Final UI update after the model returns the result
 		p.tv.app.QueueUpdateDraw(func() {
 			p.tv.outputView.SetText(p.tv.progress.originalOutputViewContents) // reset back
 			p.handleFinalModelResult(result, chatErr)
-			// clear the command area
-			p.tv.commandArea.Replace(0, len(command), "")
+			// the attachments are cleared once they are send
+			p.tv.updateCommandTitle()
+			// clear the command area, unless this was a retry
+			// and the user already typed the next command
+			if p.tv.commandArea.GetText() == command {
+				p.tv.commandArea.SetText("", false)
+			}
 		})
 	}()
 }
@@ -175,15 +279,24 @@ func (p *ModelResponseProgress) handleFinalModelResult(result genaimodel.ChatRes
 		close(p.StopSpinner)
 	})
 
-	if chatErr != nil {
-		p.tv.outputView.SetText(p.tv.outputView.GetText(false) + result.Response + "\n" + chatErr.Error())
-	} else {
+	if errors.Is(chatErr, context.Canceled) {
+		// keep the partial response, marked as cancelled
 		renderedResult, _ := p.tv.mdRenderer.GetRendered(result.Response)
 		txtRendered := tview.TranslateANSI(renderedResult)
-		p.tv.outputView.SetText(p.tv.outputView.GetText(false) + txtRendered)
+		p.tv.outputView.SetText(p.tv.outputView.GetText(false) + txtRendered + cancelledText)
+		p.progressData.SetFinalResult(result.ChunkCount, len(result.Response))
+		p.tv.progressView.SetText("Cancelled / " + p.progressData.String())
+	} else if chatErr != nil {
+		p.tv.outputView.SetText(p.tv.outputView.GetText(false) + tview.Escape(result.Response) + errorText(chatErr))
+		p.tv.progressView.SetText(errorSummary(chatErr))
+	} else {
+		renderedResult, _ := p.tv.mdRenderer.GetRendered(result.Response)
+		txtRendered := tview.TranslateANSI(renderedResult) + finishText(p.tv.aimodel.GetContextUsage())
+		p.lastAnswer = result.Response
+		p.setAnswer(result.Thoughts, txtRendered)
 		// set last progress to progressView
 		p.progressData.SetFinalResult(result.ChunkCount, len(result.Response))
-		p.tv.progressView.SetText(p.progressData.String())
+		p.tv.progressView.SetText(p.progressData.String() + " / " + p.tv.aimodel.GetContextUsage().String())
 	}
 	p.tv.app.SetFocus(p.tv.outputView)
 }
@@ -193,6 +306,7 @@ func (p *ModelResponseProgress) startProgress() {
 		startTime: time.Now(),
 	}
 	p.chunksReceived = strings.Builder{}
+	p.thoughtsReceived = strings.Builder{}
 	p.StopSpinner = make(chan struct{})       // Create a NEW channel for each command
 	p.closeSpinnerOnce = sync.Once{}          // IMPORTANT: Reinitialize sync.Once for each command
 	go p.startSpinnerGoroutine(p.StopSpinner) // Start the spinner goroutine with the new channel
@@ -206,7 +320,40 @@ func (p *ModelResponseProgress) onChunkReceived(chunk string) {
 	p.chunksReceived.WriteString(chunk)
 	renderedProgress, _ := p.tv.mdRenderer.GetRendered(p.chunksReceived.String())
 	tviewProgressRendered := tview.TranslateANSI(renderedProgress)
-	p.updateUI(p.userCommandRendered + "\n" + tviewProgressRendered)
+	p.updateUI(p.userCommandRendered + thoughtsText(p.thoughtsReceived.String(), true) +
+		"\n" + tviewProgressRendered)
+}
+
+// onThoughtReceived shows the thoughts of a thinking
+// model above the answer while they stream in
+func (p *ModelResponseProgress) onThoughtReceived(thought string) {
+	p.closeSpinnerOnce.Do(func() {
+		close(p.StopSpinner)
+	})
+	p.thoughtsReceived.WriteString(thought)
+	renderedProgress, _ := p.tv.mdRenderer.GetRendered(p.chunksReceived.String())
+	p.updateUI(p.userCommandRendered + thoughtsText(p.thoughtsReceived.String(), true) +
+		"\n" + tview.TranslateANSI(renderedProgress))
+}
+
+// setAnswer shows the final answer below the user command, the
+// thoughts are collapsed unless the user chose to show them.
+// Must be called on the main thread.
+func (p *ModelResponseProgress) setAnswer(thoughts string, txtRendered string) {
+	p.thoughts = thoughts
+	p.answerRendered = txtRendered
+	p.tv.outputView.SetText(p.originalOutputViewContents +
+		thoughtsText(thoughts, p.tv.showThoughts) + txtRendered)
+}
+
+// toggleThoughts expands or collapses the thoughts of the last answer
+func (p *ModelResponseProgress) toggleThoughts() {
+	p.tv.showThoughts = !p.tv.showThoughts
+	if p.thoughts == "" {
+		p.tv.progressView.SetText("The last answer has no thoughts")
+		return
+	}
+	p.setAnswer(p.thoughts, p.answerRendered)
 }
 
 func (p *ModelResponseProgress) updateUI(txtRendered string) {
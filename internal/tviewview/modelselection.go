@@ -0,0 +1,72 @@
+package tviewview
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// createModelSelectionModal shows the models of the backend,
+// selecting one makes it the active model for the session
+func (tv *tviewApp) createModelSelectionModal(models []genaimodel.ModelInfo) {
+	closeModal := func() {
+		tv.app.SetInputCapture(tv.inputCapture) // undo the override of the ESC key
+		tv.app.SetRoot(tv.flex, true)           // Close the modal
+	}
+
+	modelList := tview.NewList()
+	for _, model := range models {
+		details := model.Details()
+		if details == "" {
+			details = model.DisplayName
+		}
+		modelList.AddItem(tview.Escape(model.Name), tview.Escape(details), 0, nil)
+		if model.Name == tv.aimodel.GetModel() {
+			modelList.SetCurrentItem(modelList.GetItemCount() - 1)
+		}
+	}
+	modelList.SetBorder(true).SetTitle("Select model (ESC to exit)")
+
+	modelList.SetSelectedFunc(func(index int, mainText, secondaryText string, shortcut rune) {
+		tv.aimodel.SetModel(models[index].Name)
+		log.Printf("Selected model: %s", models[index].Name)
+		tv.titleView.SetText(tv.title(""))
+		tv.progressView.SetText(fmt.Sprintf("Model: %s", models[index].Name))
+		closeModal()
+	})
+
+	tv.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			closeModal()
+			return nil
+		}
+		return event
+	})
+
+	tv.app.SetRoot(modelList, true)
+}
+
+// SelectModel lists the models of the backend in a modal,
+// listing the models can take a while so it runs async
+func (tv *tviewApp) SelectModel() {
+	tv.progressView.SetText("Listing models...")
+	go func() {
+		models, err := tv.aimodel.ListModels(context.Background())
+		tv.app.QueueUpdateDraw(func() {
+			if err != nil {
+				log.Printf("Error listing models: %v", err)
+				tv.progressView.SetText(fmt.Sprintf("Error listing models: %v", err))
+				return
+			}
+			if len(models) == 0 {
+				tv.progressView.SetText("No models found")
+				return
+			}
+			tv.createModelSelectionModal(models)
+		})
+	}()
+}
@@ -0,0 +1,104 @@
+package tviewview
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/MelleKoning/ai-chat/internal/diff"
+	"github.com/MelleKoning/ai-chat/internal/diffsource"
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+	"github.com/MelleKoning/ai-chat/internal/report"
+)
+
+// structuredReview reviews the diff of the source with the findings as
+// JSON, the findings are shown grouped by file when the answer is complete.
+// Like the chunked review it leaves out the vendored and generated files.
+func (tv *tviewApp) structuredReview(source *diffsource.Source) {
+	ctx, done, ok := tv.startRequest()
+	if !ok {
+		return
+	}
+	tv.lastRequest = func() { tv.structuredReview(source) }
+	tv.progress.appendUserCommandToOutput("[StructuredReview] " + source.String())
+	tv.progress.originalOutputViewContents = tv.outputView.GetText(false)
+	tv.progress.chunksReceived.Reset()
+	tv.progress.thoughtsReceived.Reset()
+	go func() { // async for the chunk updates
+		defer done()
+		name, files, err := source.Files(ctx)
+		if err != nil {
+			log.Printf("Error loading %s: %v", source, err)
+			tv.UpdateOutputView("", err)
+			return
+		}
+		contents := genaimodel.ReviewSource{Name: name, Contents: []byte(diff.Format(files))}
+		review, err := tv.aimodel.StructuredReview(ctx, contents, tv.progress.onChunkReceived)
+		if err != nil {
+			// the partial JSON is not worth rendering
+			tv.UpdateOutputView("", err)
+			return
+		}
+		// the navigator shows the hunks of the findings
+		tv.showReview(review, files, "")
+	}()
+}
+
+// SetChunking sets the size of the batches of a chunked review and the
+// number of batches that are reviewed at once, zero for the defaults
+func (tv *tviewApp) SetChunking(batchTokens, workers int) {
+	tv.batchTokens = batchTokens
+	tv.reviewWorkers = workers
+}
+
+// chunkedReview splits a large diff into batches of files, reviews the
+// batches concurrently and shows the merged findings grouped by file
+func (tv *tviewApp) chunkedReview(source *diffsource.Source) {
+	ctx, done, ok := tv.startRequest()
+	if !ok {
+		return
+	}
+	tv.lastRequest = func() { tv.chunkedReview(source) }
+	tv.progress.appendUserCommandToOutput("[ChunkedReview] " + source.String())
+	tv.progress.originalOutputViewContents = tv.outputView.GetText(false)
+	tv.progress.chunksReceived.Reset()
+	tv.progress.thoughtsReceived.Reset()
+	go func() {
+		defer done()
+		name, files, err := source.Files(ctx)
+		if err != nil {
+			log.Printf("Error loading %s: %v", source, err)
+			tv.UpdateOutputView("", err)
+			return
+		}
+		batches := diffsource.Batches(name, files, tv.batchTokens)
+		var total int
+		review, err := tv.aimodel.ChunkedReview(ctx, batches, tv.reviewWorkers, func(done, reviewed int) {
+			total = reviewed
+			tv.app.QueueUpdateDraw(func() {
+				tv.progressView.SetText(fmt.Sprintf("Reviewing file %d/%d", done, reviewed))
+			})
+		})
+		if err != nil {
+			tv.UpdateOutputView("", err)
+			return
+		}
+		tv.showReview(review, files, fmt.Sprintf("\nReviewed %d files in %d batches.\n", total, len(batches)))
+	}()
+}
+
+// showReview tracks the findings of the review with the session and
+// shows the new and the unresolved findings, the files of the diff are
+// kept for the hunks in the findings navigator
+func (tv *tviewApp) showReview(review genaimodel.Review, files []diff.File, footer string) {
+	// the findings navigator reads and marks the findings on the
+	// event loop, QueueUpdate waits until they are tracked
+	var left int
+	tv.app.QueueUpdate(func() {
+		review, left = tv.aimodel.TrackReview(review)
+		tv.reviewFiles = files
+	})
+	if left > 0 {
+		footer += fmt.Sprintf("\n%d resolved or ignored findings are left out, choose \"Findings\" to see them.\n", left)
+	}
+	tv.UpdateOutputView(report.Markdown(review)+footer, nil)
+}
@@ -0,0 +1,182 @@
+package tviewview
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MelleKoning/ai-chat/internal/diffsource"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// the options of the review source modal
+const (
+	sourceFile     = "File"
+	sourceStaged   = "Staged changes"
+	sourceWorktree = "Working tree"
+	sourceBranch   = "Branch against main"
+	sourceRange    = "Git range"
+	sourceStdin    = "Standard input"
+)
+
+// SetReviewSource sets the source that the review modal starts with,
+// a diff from standard input stays available during the session
+func (tv *tviewApp) SetReviewSource(source *diffsource.Source) {
+	tv.reviewSource = source
+	if source.Kind == diffsource.KindStdin {
+		tv.stdinSource = source
+	}
+}
+
+// SelectReviewSource shows a modal to choose the diff to review,
+// review runs with the chosen source
+func (tv *tviewApp) SelectReviewSource(review func(*diffsource.Source)) {
+	closeModal := func() {
+		tv.app.SetInputCapture(tv.inputCapture) // undo the override of the ESC key
+		tv.app.SetRoot(tv.flex, true)           // Close the modal
+	}
+
+	options := []string{sourceFile, sourceStaged, sourceWorktree, sourceBranch, sourceRange}
+	if tv.stdinSource != nil {
+		options = append(options, sourceStdin)
+	}
+	current, text := sourceOption(tv.reviewSource)
+
+	form := tview.NewForm()
+	form.SetBorder(true).SetTitle("Review source (ESC to exit)")
+	form.AddDropDown("Source", options, max(slices.Index(options, current), 0), nil)
+	form.AddInputField("Path or range", text, 60, nil, nil)
+	sourceField := form.GetFormItemByLabel("Source").(*tview.DropDown)
+	textField := form.GetFormItemByLabel("Path or range").(*tview.InputField)
+	textField.SetAutocompleteFunc(completePath)
+
+	capture := func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			closeModal()
+			return nil
+		}
+		return event
+	}
+	backToForm := func() {
+		tv.app.SetInputCapture(capture)
+		tv.app.SetRoot(form, true)
+	}
+
+	form.AddButton("Browse", func() {
+		dir := filepath.Dir(strings.TrimSpace(textField.GetText()))
+		tv.pickFile(dir, func(path string) {
+			sourceField.SetCurrentOption(slices.Index(options, sourceFile))
+			textField.SetText(path)
+			backToForm()
+		}, backToForm)
+	})
+	form.AddButton("Review", func() {
+		_, option := sourceField.GetCurrentOption()
+		source, err := tv.newReviewSource(option, strings.TrimSpace(textField.GetText()))
+		if err != nil {
+			form.SetTitle(tview.Escape(fmt.Sprintf("Review source: %v", err)))
+			return
+		}
+		log.Printf("Review source: %s", source)
+		tv.reviewSource = source
+		closeModal()
+		review(source)
+	}).
+		AddButton("Cancel", closeModal)
+
+	tv.app.SetInputCapture(capture)
+	tv.app.SetRoot(form, true)
+}
+
+// pickFile lists the directories and the files of dir to choose the
+// diff file from, a directory shows its own list and ESC goes back
+func (tv *tviewApp) pickFile(dir string, pick func(string), back func()) {
+	list := tview.NewList().ShowSecondaryText(false)
+	list.SetBorder(true)
+
+	var show func(dir string)
+	show = func(dir string) {
+		list.Clear()
+		list.SetTitle(tview.Escape(fmt.Sprintf("Choose the diff in %s (ESC to go back)", dir)))
+		list.AddItem("../", "", 0, func() { show(filepath.Join(dir, "..")) })
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Printf("Error reading %s: %v", dir, err)
+			list.SetTitle(tview.Escape(fmt.Sprintf("Error reading %s: %v", dir, err)))
+			return
+		}
+		// the directories come before the files
+		for _, entry := range entries {
+			if path := filepath.Join(dir, entry.Name()); entry.IsDir() {
+				list.AddItem(tview.Escape(entry.Name()+"/"), "", 0, func() { show(path) })
+			}
+		}
+		for _, entry := range entries {
+			if path := filepath.Join(dir, entry.Name()); !entry.IsDir() {
+				list.AddItem(tview.Escape(entry.Name()), "", 0, func() { pick(path) })
+			}
+		}
+	}
+	show(dir)
+
+	tv.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			back()
+			return nil
+		}
+		return event
+	})
+	tv.app.SetRoot(list, true)
+}
+
+// newReviewSource creates the source of the option of the modal,
+// text is the path of a file or the range of git
+func (tv *tviewApp) newReviewSource(option, text string) (*diffsource.Source, error) {
+	switch option {
+	case sourceFile:
+		if text == "" {
+			return nil, errors.New("type the path of the file")
+		}
+		return &diffsource.Source{Kind: diffsource.KindFile, Path: text}, nil
+	case sourceStaged:
+		return diffsource.Git(diffsource.RangeStaged)
+	case sourceWorktree:
+		return diffsource.Git(diffsource.RangeWorktree)
+	case sourceBranch:
+		return diffsource.Git(diffsource.RangeBranch)
+	case sourceRange:
+		return diffsource.Git(text)
+	case sourceStdin:
+		return tv.stdinSource, nil
+	}
+
+	return nil, fmt.Errorf("unknown source %q", option)
+}
+
+// sourceOption returns the option of the modal for the
+// source and the text of its path or range
+func sourceOption(source *diffsource.Source) (string, string) {
+	switch {
+	case source == nil:
+		return sourceFile, diffsource.DefaultFile
+	case source.Kind == diffsource.KindStdin:
+		return sourceStdin, ""
+	case source.Kind == diffsource.KindFile:
+		return sourceFile, source.Path
+	}
+	switch source.Range {
+	case diffsource.RangeStaged:
+		return sourceStaged, ""
+	case diffsource.RangeWorktree:
+		return sourceWorktree, ""
+	case diffsource.RangeBranch:
+		return sourceBranch, ""
+	}
+
+	return sourceRange, source.Range
+}
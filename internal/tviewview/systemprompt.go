@@ -63,8 +63,8 @@ func (tv *tviewApp) createPromptSelectionModal() chan prompts.Prompt {
 		// This sets the selected prompt for further use
 		selectedPromptChan <- prompts.PromptList[index]
 		log.Printf("selected prompt %s", tv.selectedPrompt)
-		tv.app.SetInputCapture(nil)   // undo the override of the TAB key
-		tv.app.SetRoot(tv.flex, true) // Close the modal
+		tv.app.SetInputCapture(tv.inputCapture) // undo the override of the TAB key
+		tv.app.SetRoot(tv.flex, true)           // Close the modal
 	})
 
 	// Set the modal as the root of the application
@@ -74,6 +74,11 @@ func (tv *tviewApp) createPromptSelectionModal() chan prompts.Prompt {
 }
 
 func (tv *tviewApp) SelectSystemPrompt() {
+	// the prompt is sent to the model right after it is chosen
+	if tv.progress.requestRunning() {
+		tv.progressView.SetText(requestRunningText)
+		return
+	}
 	tv.progress.originalOutputViewContents = tv.outputView.GetText(false)
 
 	// Open the prompt selection modal
@@ -83,12 +88,18 @@ func (tv *tviewApp) SelectSystemPrompt() {
 	// we have to await the modal response in a goroutine
 	go func() {
 		prompt := <-selectedPromptChan
+		ctx, done, ok := tv.progress.newRequestContext()
+		if !ok {
+			tv.app.QueueUpdateDraw(func() { tv.progressView.SetText(requestRunningText) })
+			return
+		}
+		defer done()
 		tv.selectedPrompt = prompt.Prompt
 		log.Println("Selected prompt:", prompt.Name)
 		tv.aimodel.UpdateSystemInstruction(tv.selectedPrompt)
 		// the callback -can- update the outputview for intermediate results
 		tv.progress.startProgress()
-		finalResult, chatErr := tv.aimodel.SendSystemPrompt(tv.progress.onChunkReceived)
+		finalResult, chatErr := tv.aimodel.SendSystemPrompt(ctx, tv.progress.onChunkReceived)
 		// as we run in an async routine we have
 		// to use the QueueUpdateDraw for UI updates
 		tv.app.QueueUpdateDraw(func() {
@@ -0,0 +1,155 @@
+package tviewview
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MelleKoning/ai-chat/internal/genaimodel"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// maxArgLength shortens long arguments like the content of a file
+// write in the approval modal, the preview shows what changes
+const maxArgLength = 200
+
+// approveToolCall asks the user to approve a tool that writes files
+// or runs commands. It is called from the goroutine of the model
+// request and blocks until the user decided, a cancelled request denies.
+func (tv *tviewApp) approveToolCall(ctx context.Context, request genaimodel.ApprovalRequest) genaimodel.Approval {
+	decision := make(chan genaimodel.Approval, 1)
+	closeModal := func() {
+		tv.app.SetInputCapture(tv.inputCapture) // undo the override of the ESC key
+		tv.app.SetRoot(tv.flex, true)           // Close the modal
+		tv.app.SetFocus(tv.progressView)
+	}
+	decide := func(approval genaimodel.Approval) {
+		select {
+		case decision <- approval:
+			closeModal()
+		default:
+			// already decided
+		}
+	}
+	tv.app.QueueUpdateDraw(func() {
+		tv.createToolApprovalModal(request, decide)
+	})
+
+	select {
+	case approval := <-decision:
+		log.Printf("Tool %s: %s", request.Call.Name, approvalText(approval))
+		return approval
+	case <-ctx.Done():
+		tv.app.QueueUpdateDraw(func() { decide(genaimodel.ApprovalDeny) })
+		return genaimodel.ApprovalDeny
+	}
+}
+
+// createToolApprovalModal shows the tool call with its preview and the
+// buttons to decide, ESC denies and Ctrl-C cancels the whole request
+func (tv *tviewApp) createToolApprovalModal(request genaimodel.ApprovalRequest, decide func(genaimodel.Approval)) {
+	details := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true).
+		SetText(toolCallText(request))
+	details.SetBorder(true).
+		SetTitle(tview.Escape(fmt.Sprintf("The model wants to run %s (TAB to scroll, ESC to deny)", request.Call.Name)))
+
+	buttons := tview.NewForm().
+		AddButton("Approve", func() { decide(genaimodel.ApprovalApprove) }).
+		AddButton("Deny", func() { decide(genaimodel.ApprovalDeny) }).
+		AddButton("Always allow this session", func() { decide(genaimodel.ApprovalAlways) })
+
+	modal := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(details, 0, 1, false).
+		AddItem(buttons, 3, 0, true)
+
+	tv.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			decide(genaimodel.ApprovalDeny)
+			return nil
+		case tcell.KeyCtrlC:
+			tv.progress.cancelRunningRequest()
+			decide(genaimodel.ApprovalDeny)
+			return nil
+		case tcell.KeyTAB:
+			if details.HasFocus() {
+				tv.app.SetFocus(buttons)
+				return nil
+			}
+			if _, button := buttons.GetFocusedItemIndex(); button == buttons.GetButtonCount()-1 {
+				tv.app.SetFocus(details)
+				return nil
+			}
+		}
+		return event
+	})
+
+	tv.app.SetRoot(modal, true)
+}
+
+// toolCallText renders the arguments and the preview, the
+// added and removed lines of a diff preview are coloured
+func toolCallText(request genaimodel.ApprovalRequest) string {
+	var sb strings.Builder
+	sb.WriteString("[yellow]Arguments[-]\n")
+	args := map[string]any{}
+	for name, value := range request.Call.Args {
+		if s, ok := value.(string); ok && len(s) > maxArgLength {
+			// cut before the rune that does not fit
+			cut := maxArgLength
+			for cut > 0 && !utf8.RuneStart(s[cut]) {
+				cut--
+			}
+			value = s[:cut] + "..."
+		}
+		args[name] = value
+	}
+	argsJSON, err := json.MarshalIndent(args, "", "  ")
+	if err != nil {
+		argsJSON = []byte(fmt.Sprint(request.Call.Args))
+	}
+	sb.WriteString(tview.Escape(string(argsJSON)))
+	sb.WriteString("\n")
+
+	if request.Preview != "" {
+		sb.WriteString("\n[yellow]Preview[-]\n")
+		sb.WriteString(colorDiff(request.Preview))
+	}
+
+	return sb.String()
+}
+
+// colorDiff escapes the lines of a diff and colours the added and removed lines
+func colorDiff(text string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			sb.WriteString("[green]" + tview.Escape(line) + "[-]\n")
+		case strings.HasPrefix(line, "-"):
+			sb.WriteString("[red]" + tview.Escape(line) + "[-]\n")
+		default:
+			sb.WriteString(tview.Escape(line) + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+func approvalText(approval genaimodel.Approval) string {
+	switch approval {
+	case genaimodel.ApprovalApprove:
+		return "approved"
+	case genaimodel.ApprovalAlways:
+		return "always allowed this session"
+	default:
+		return "denied"
+	}
+}
@@ -1,9 +1,13 @@
 package tviewview
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 
+	"github.com/MelleKoning/ai-chat/internal/diff"
+	"github.com/MelleKoning/ai-chat/internal/diffsource"
 	"github.com/MelleKoning/ai-chat/internal/genaimodel"
 	"github.com/MelleKoning/ai-chat/internal/terminal"
 
@@ -34,13 +38,22 @@ type tviewApp struct {
 	progress          ModelResponseProgress
 	aimodel           genaimodel.Action
 	selectedPrompt    string
-	pages             *tview.Pages // to support modal dialog
+	pages             *tview.Pages       // to support modal dialog
+	lastRequest       func()             // resends the last prompt or review
+	showThoughts      bool               // expands the thoughts of a thinking model
+	reviewSource      *diffsource.Source // the diff that was reviewed last
+	stdinSource       *diffsource.Source // the diff piped to standard input, if any
+	batchTokens       int                // the size of a batch of a chunked review
+	reviewWorkers     int                // the batches of a chunked review that run at once
+	reviewFiles       []diff.File        // the diff of the last review, for the findings navigator
 }
 
 type TviewApp interface {
 	Run() error
 	SetDefaultView()
 	Output() string
+	SetReviewSource(*diffsource.Source)
+	SetChunking(batchTokens, workers int)
 }
 
 func (tv *tviewApp) Output() string {
@@ -65,7 +78,11 @@ func New(mdrenderer terminal.GlamourRenderer,
 			tview.FlexRow,
 		),
 	}
-	tv.progress = ModelResponseProgress{tv: tv}
+	// the spinner only runs for chats, a review can close it before any chat
+	tv.progress = ModelResponseProgress{tv: tv, StopSpinner: make(chan struct{})}
+	tv.aimodel.SetThoughtHandler(tv.progress.onThoughtReceived)
+	tv.aimodel.SetToolApprover(tv.approveToolCall)
+	tv.app.SetInputCapture(tv.inputCapture)
 	tv.createTitleView()
 	tv.createOutputView()
 	tv.createTextArea()
@@ -73,6 +90,7 @@ func New(mdrenderer terminal.GlamourRenderer,
 	tv.createDropDown()
 	tv.createProgressView()
 	tv.SetDefaultView()
+	tv.SetReviewSource(&diffsource.Source{Kind: diffsource.KindFile, Path: diffsource.DefaultFile})
 	tv.app.SetRoot(tv.flex, true)
 
 	return tv
@@ -80,7 +98,7 @@ func New(mdrenderer terminal.GlamourRenderer,
 
 func (tv *tviewApp) createTitleView() {
 	tv.titleView = tview.NewTextView().
-		SetText("AI Chat").
+		SetText(tv.title("")).
 		SetTextAlign(tview.AlignCenter).
 		SetDynamicColors(true)
 	tv.titleView.SetBorder(false)
@@ -89,6 +107,41 @@ func (tv *tviewApp) createTitleView() {
 	tv.titleView.SetTextColor(tcell.ColorDefault)
 }
 
+// startRequest returns the context of a new model request, while
+// another request runs it asks the user to wait and returns false
+func (tv *tviewApp) startRequest() (context.Context, func(), bool) {
+	ctx, done, ok := tv.progress.newRequestContext()
+	if !ok {
+		tv.progressView.SetText(requestRunningText)
+	}
+
+	return ctx, done, ok
+}
+
+// title returns the text for the titleView, showing the
+// active model and optionally a hint for the focused view
+func (tv *tviewApp) title(hint string) string {
+	title := fmt.Sprintf("AI Chat (%s)", tview.Escape(tv.aimodel.GetModel()))
+	if hint != "" {
+		title = title + " " + hint
+	}
+
+	return title
+}
+
+// inputCapture is the application wide key handling, modals
+// that override the input capture restore this one when closed.
+// While a model request runs, ESC and Ctrl-C cancel the request.
+func (tv *tviewApp) inputCapture(event *tcell.EventKey) *tcell.EventKey {
+	if event.Key() == tcell.KeyEscape || event.Key() == tcell.KeyCtrlC {
+		if tv.progress.cancelRunningRequest() {
+			log.Println("Cancelled the running model request")
+			return nil // Consume the event, do not quit on Ctrl-C
+		}
+	}
+	return event
+}
+
 func (tv *tviewApp) createProgressView() {
 	tv.progressView = tview.NewTextView().
 		SetText("").SetDynamicColors(true)
@@ -120,11 +173,11 @@ func (tv *tviewApp) createOutputView() {
 		SetFocusFunc(func() {
 			tv.titleView.SetTextColor(tcell.ColorWhite)
 			tv.titleView.SetBackgroundColor(tcell.ColorDarkMagenta)
-			tv.titleView.SetText("AI Chat <ENTER to toggle view, TAB to focus next>")
+			tv.titleView.SetText(tv.title("<ENTER to toggle view, TAB to focus next>"))
 		}).SetBlurFunc(func() {
 		tv.titleView.SetTextColor(tcell.ColorGray)
 		tv.titleView.SetBackgroundColor(tcell.ColorDarkBlue)
-		tv.titleView.SetText("AI Chat")
+		tv.titleView.SetText(tv.title(""))
 	}).SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey { // <-- Use SetInputCapture
 		if event.Key() == tcell.KeyTAB {
 			log.Println("TAB in outputView (InputCapture) - focusing DropDown")
@@ -168,12 +221,12 @@ func (tv *tviewApp) createOutputView() {
 	tv.outputTextArea.SetFocusFunc(func() {
 		tv.titleView.SetTextColor(tcell.ColorWhite)
 		tv.titleView.SetBackgroundColor(tcell.ColorDarkCyan)
-		tv.titleView.SetText("AI Chat <ESC to toggle view, ALT-C to copy to clipboard>")
+		tv.titleView.SetText(tv.title("<ESC to toggle view, ALT-C to copy to clipboard>"))
 
 	}).SetBlurFunc(func() {
 		tv.titleView.SetTextColor(tcell.ColorGray)
 		tv.titleView.SetBackgroundColor(tcell.ColorDarkBlue)
-		tv.titleView.SetText("AI Chat")
+		tv.titleView.SetText(tv.title(""))
 
 	})
 
@@ -246,10 +299,20 @@ func (tv *tviewApp) createDropDown() {
 		SetLabel("Select option: ").
 		SetOptions([]string{
 			"ReviewFile",
+			"Structured review",
+			"Chunked review",
+			"Findings",
+			"Retry",
+			"Continue answer",
+			"Attach file",
 			"Select system prompt",
+			"Generation settings",
+			"Toggle thoughts",
+			"Pin last answer",
 			"Store Chat History",
 			"Load Chat History",
-			"ListModels",
+			"Select model",
+			"Pull Model",
 			"Exit"}, func(option string, index int) {
 			switch option {
 			case "Exit":
@@ -258,24 +321,39 @@ func (tv *tviewApp) createDropDown() {
 			case "Select system prompt":
 				tv.SelectSystemPrompt()
 			case "ReviewFile":
-				// Prompt user for file path (simple version: use textArea input)
-				filePath := "gitdiff.txt"
-				tv.progress.appendUserCommandToOutput("[ReviewFile] " + filePath)
-				tv.progress.originalOutputViewContents = tv.outputView.GetText(false)
-				go func() { // async for the chunk updates
-					result, err := tv.aimodel.ReviewFile(tv.progress.onChunkReceived)
-					tv.UpdateOutputView(result, err)
-				}()
+				tv.SelectReviewSource(tv.reviewFile)
+			case "Structured review":
+				tv.SelectReviewSource(tv.structuredReview)
+			case "Chunked review":
+				tv.SelectReviewSource(tv.chunkedReview)
+			case "Findings":
+				tv.ShowFindings()
+			case "Retry":
+				tv.retryLastRequest()
+			case "Continue answer":
+				tv.continueAnswer()
+			case "Attach file":
+				tv.AttachFile()
+			case "Generation settings":
+				tv.GenerationSettings()
+			case "Toggle thoughts":
+				tv.progress.toggleThoughts()
+			case "Pin last answer":
+				if tv.aimodel.PinLastTurn() {
+					tv.progressView.SetText("Pinned the last answer, it is kept when the history is trimmed")
+				} else {
+					tv.progressView.SetText("Nothing to pin yet")
+				}
 			case "Store Chat History":
 				tv.storeChatHistory()
 
 			case "Load Chat History":
 				tv.SelectChatHistoryFile()
 
-			case "ListModels":
-				go func() {
-					tv.UpdateOutputView(tv.aimodel.ListModels())
-				}()
+			case "Select model":
+				tv.SelectModel()
+			case "Pull Model":
+				tv.pullModel()
 			}
 		}).SetDoneFunc(func(key tcell.Key) {
 		if key == tcell.KeyTAB {
@@ -284,14 +362,118 @@ func (tv *tviewApp) createDropDown() {
 	})
 }
 
+// reviewFile reviews the diff of the source, loading
+// the diff can run git so it is done async as well
+func (tv *tviewApp) reviewFile(source *diffsource.Source) {
+	ctx, done, ok := tv.startRequest()
+	if !ok {
+		return
+	}
+	tv.lastRequest = func() { tv.reviewFile(source) }
+	tv.progress.appendUserCommandToOutput("[ReviewFile] " + source.String())
+	tv.progress.originalOutputViewContents = tv.outputView.GetText(false)
+	tv.progress.chunksReceived.Reset()
+	tv.progress.thoughtsReceived.Reset()
+	go func() { // async for the chunk updates
+		defer done()
+		diff, err := source.Load(ctx)
+		if err != nil {
+			log.Printf("Error loading %s: %v", source, err)
+			tv.UpdateOutputView("", err)
+			return
+		}
+		result, err := tv.aimodel.ReviewFile(ctx, diff, tv.progress.onChunkReceived)
+		tv.UpdateOutputView(result, err)
+	}()
+}
+
+// retryLastRequest sends the last prompt or review again,
+// for example after a rate limit or a network error
+func (tv *tviewApp) retryLastRequest() {
+	if tv.lastRequest == nil {
+		tv.progressView.SetText("Nothing to retry yet")
+		return
+	}
+	tv.lastRequest()
+}
+
+// continueAnswer asks the model to continue the last answer that was
+// cut off, the continuation is shown in the same block as the answer
+func (tv *tviewApp) continueAnswer() {
+	if tv.aimodel.GetContextUsage().FinishReason != genaimodel.FinishMaxTokens {
+		tv.progressView.SetText("The last answer was not cut off")
+		return
+	}
+	ctx, done, ok := tv.startRequest()
+	if !ok {
+		return
+	}
+	tv.lastRequest = tv.continueAnswer
+	tv.progress.startProgress()
+	tv.progress.chunksReceived.WriteString(tv.progress.lastAnswer)
+	go func() {
+		defer done()
+		result, err := tv.aimodel.ContinueAnswer(ctx, tv.progress.onChunkReceived)
+		tv.UpdateOutputView(result.Response, err)
+	}()
+}
+
+// pullModel downloads the model typed in the command area,
+// the progress of the download is shown in the progressView
+func (tv *tviewApp) pullModel() {
+	modelName := tv.commandArea.GetText()
+	if modelName == "" {
+		tv.progressView.SetText("Type the name of the model to pull in the command area")
+		return
+	}
+	// ESC or Ctrl-C stops a large download like any other request
+	ctx, done, ok := tv.startRequest()
+	if !ok {
+		return
+	}
+	go func() {
+		defer done()
+		err := tv.aimodel.PullModel(ctx, modelName, func(status string) {
+			tv.app.QueueUpdateDraw(func() {
+				tv.progressView.SetText(fmt.Sprintf("Pulling %s: %s", modelName, status))
+			})
+		})
+		tv.app.QueueUpdateDraw(func() {
+			if errors.Is(err, context.Canceled) {
+				tv.progressView.SetText(fmt.Sprintf("Cancelled pulling %s", modelName))
+				return
+			}
+			if err != nil {
+				tv.progressView.SetText(fmt.Sprintf("Error pulling %s: %v", modelName, err))
+				return
+			}
+			tv.progressView.SetText(fmt.Sprintf("Pulled %s", modelName))
+			tv.commandArea.SetText("", false)
+		})
+	}()
+}
+
 func (tv *tviewApp) UpdateOutputView(result string, err error) {
 	tv.app.QueueUpdateDraw(func() {
-		if err != nil {
-			tv.outputView.SetText(tv.outputView.GetText(false) + err.Error())
+		// a failure can come before the first chunk
+		tv.progress.closeSpinnerOnce.Do(func() {
+			close(tv.progress.StopSpinner)
+		})
+		if errors.Is(err, context.Canceled) {
+			renderedResult, _ := tv.mdRenderer.GetRendered(result)
+			tv.outputView.SetText(tv.progress.originalOutputViewContents +
+				tview.TranslateANSI(renderedResult) + cancelledText)
+			tv.progressView.SetText("Cancelled")
+		} else if err != nil {
+			tv.outputView.SetText(tv.outputView.GetText(false) + errorText(err))
+			tv.progressView.SetText(errorSummary(err))
 		} else {
 			renderedResult, _ := tv.mdRenderer.GetRendered(result)
-			txtRendered := tview.TranslateANSI(renderedResult)
-			tv.outputView.SetText(tv.progress.originalOutputViewContents + txtRendered)
+			txtRendered := tview.TranslateANSI(renderedResult) +
+				finishText(tv.aimodel.GetContextUsage())
+			tv.progress.lastAnswer = result
+			tv.progress.setAnswer(tv.progress.thoughtsReceived.String(), txtRendered)
+			tv.progressView.SetText(tv.aimodel.GetContextUsage().String())
 		}
 		tv.app.SetFocus(tv.outputView)
 	})